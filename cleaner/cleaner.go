@@ -0,0 +1,886 @@
+// Package cleaner implements a pass that applies cleanup rules to torrents, by default
+// removing those whose files are missing
+package cleaner
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mallox/qbittorrent-cleaner/journal"
+	"github.com/mallox/qbittorrent-cleaner/pending"
+	"github.com/mallox/qbittorrent-cleaner/qbittorrent"
+	"github.com/mallox/qbittorrent-cleaner/rules"
+)
+
+// RuleMissingFiles is the default rule, which removes complete torrents with missing files
+const RuleMissingFiles = rules.MissingFiles
+
+// RuleHitAndRun is recorded for torrents with missing files that hit-and-run protection
+// kept from being removed, and that were tagged instead
+const RuleHitAndRun = "hit-and-run"
+
+// Actions recorded in the journal
+const (
+	ActionDelete         = rules.ActionDelete
+	ActionDeleteKeepData = rules.ActionDeleteKeepData
+	ActionTag            = rules.ActionTag
+	ActionPause          = rules.ActionPause
+)
+
+// Decisions a Confirm callback can make for a candidate
+const (
+	DecisionKeep           = "keep"
+	DecisionRemove         = "remove"
+	DecisionRemoveKeepData = "remove-keep-data"
+)
+
+// Cleaner checks torrents against its rules and removes, tags, pauses or reports those that match
+type Cleaner struct {
+	Client       *qbittorrent.Client
+	DownloadDirs []string
+	// Rules are evaluated in order for every torrent, and the first that matches applies
+	Rules []rules.Rule
+	// LibraryDirs is the media library that rules can look for imported payloads in
+	LibraryDirs []string
+	// Verify is how missing files are detected, VerifyFiles unless set. With Recheck set,
+	// VerifyState rechecks torrents before trusting their state, waiting up to RecheckTimeout.
+	Verify         string
+	Recheck        bool
+	RecheckTimeout time.Duration
+	// VerifyRecheck rechecks at most RecheckMax torrents per pass, RecheckBatch at a time, and
+	// each torrent at most once per RecheckInterval. Rechecks remembers when that was.
+	RecheckBatch    int
+	RecheckMax      int
+	RecheckInterval time.Duration
+	Rechecks        *Rechecks
+	// PollInterval is how often rechecked torrents are polled, two seconds unless set
+	PollInterval time.Duration
+	// UnregisteredPatterns are the tracker messages, matched case-insensitively, that mark a
+	// torrent as unregistered when every tracker reports one
+	UnregisteredPatterns []string
+	// Sightings remembers since when rules with a grace period have matched torrents
+	Sightings *Sightings
+	// Protections veto removing torrents of private trackers before they met the tracker's
+	// seeding requirements. Torrents with missing files are tagged with ProtectedTag instead.
+	Protections  []rules.Protection
+	ProtectedTag string
+	Journal      *journal.Journal
+	Logger       *slog.Logger
+	// Exclusions lists torrents that are never removed
+	Exclusions *Exclusions
+	// Pending enables stage mode: candidates are queued and only removed once approved
+	Pending *pending.Queue
+	// BackupDir, if set, receives the .torrent file of every torrent before it is removed,
+	// so it can be restored later
+	BackupDir string
+	// Confirm is called with the candidates before anything is removed and returns a decision
+	// per hash. Candidates without a decision are kept, and an error aborts the pass.
+	Confirm func(candidates []Removal) (map[string]string, error)
+
+	// MaxRemovals aborts the pass if more torrents would be removed. Zero means no limit.
+	MaxRemovals int
+	// MaxRemovalPercent aborts the pass if a larger share of the checked torrents would be removed. Zero means no limit.
+	MaxRemovalPercent float64
+}
+
+// candidate is a torrent matched by a rule
+type candidate struct {
+	torrent      qbittorrent.Torrent
+	rule         string
+	action       string
+	tags         []string
+	missingFiles []string
+	missing      bool // The files are missing, even if qBittorrent doesn't say which
+	size         int64
+	keepData     bool
+}
+
+// Options control a single pass
+type Options struct {
+	// RunID identifies the pass. A new ID is generated if empty.
+	RunID string `json:"run_id,omitempty"`
+	// DryRun reports the torrents that would be removed without removing them
+	DryRun bool `json:"dry_run"`
+	// Hashes limits the pass to these torrents. Empty means all torrents.
+	Hashes []string `json:"hashes,omitempty"`
+}
+
+// deletes reports whether the candidate is to be removed
+func (cand candidate) deletes() bool {
+	return cand.action == ActionDelete || cand.action == ActionDeleteKeepData
+}
+
+// done returns why the action has nothing left to do for the torrent, or an empty string
+func (cand candidate) done() string {
+	switch cand.action {
+	case ActionTag:
+		tags := cand.torrent.TagList()
+		for _, tag := range cand.tags {
+			if !slices.Contains(tags, tag) {
+				return ""
+			}
+		}
+		return "already tagged"
+	case ActionPause:
+		if cand.torrent.State.IsPaused() {
+			return "already paused"
+		}
+	}
+	return ""
+}
+
+// removal describes the candidate as a Removal
+func (cand candidate) removal() Removal {
+	action := cand.action
+	if cand.deletes() && cand.keepData {
+		action = ActionDeleteKeepData
+	}
+	// Clients iterate the files, so rules that don't look at them report none instead of null
+	missingFiles := cand.missingFiles
+	if missingFiles == nil {
+		missingFiles = []string{}
+	}
+	return Removal{
+		Hash:         cand.torrent.Hash,
+		Name:         cand.torrent.Name,
+		Category:     cand.torrent.Category,
+		SavePath:     cand.torrent.SavePath,
+		Rule:         cand.rule,
+		MissingFiles: missingFiles,
+		Missing:      cand.missing,
+		Size:         cand.size,
+		Action:       action,
+		KeepData:     cand.keepData,
+	}
+}
+
+// New creates a new Cleaner
+func New(client *qbittorrent.Client, downloadDirs []string) *Cleaner {
+	return &Cleaner{
+		Client:               client,
+		DownloadDirs:         downloadDirs,
+		Rules:                rules.Default(),
+		ProtectedTag:         DefaultProtectedTag,
+		Sightings:            &Sightings{entries: map[string]Sighting{}},
+		Rechecks:             &Rechecks{entries: map[string]time.Time{}},
+		UnregisteredPatterns: DefaultUnregisteredPatterns,
+		Logger:               slog.Default(),
+	}
+}
+
+// Run performs a single pass over all torrents and returns its summary. A pass that
+// trips a safety check removes nothing and is reported through Summary.Aborted.
+func (c *Cleaner) Run(opts Options) (*Summary, error) {
+	if opts.RunID == "" {
+		opts.RunID = journal.NewRunID()
+	}
+	summary := newSummary(opts.RunID)
+	summary.DryRun = opts.DryRun
+	logger := c.logger().With("run_id", summary.RunID)
+
+	// Refuse to run against unmounted or unreadable download directories, since
+	// every torrent would look like it is missing its files
+	if c.ChecksDownloadDirs() {
+		if err := c.CheckDownloadDirs(); err != nil {
+			c.abort(logger, summary, err.Error())
+			return summary, nil
+		}
+	}
+
+	lib, err := c.loadLibrary()
+	if err != nil {
+		c.abort(logger, summary, err.Error())
+		return summary, nil
+	}
+
+	// List torrents
+	torrents, err := c.Client.ListTorrents()
+	if err != nil {
+		return nil, fmt.Errorf("listing torrents failed: %w", err)
+	}
+
+	if len(opts.Hashes) > 0 {
+		torrents = filterHashes(torrents, opts.Hashes)
+	}
+
+	if len(torrents) == 0 {
+		logger.Info("No torrents found")
+	}
+
+	if c.Verify == VerifyRecheck && c.checksFiles() && !opts.DryRun {
+		summary.rechecked = c.recheckDue(logger, summary, torrents, len(opts.Hashes) == 0)
+	}
+
+	// Check each torrent before acting on any
+	var candidates, actions []candidate
+	seen := map[string]string{}
+	for _, torrent := range torrents {
+		cand, exp := c.check(logger, summary, lib, torrent, false)
+		if !exp.GraceUntil.IsZero() {
+			seen[torrent.Hash] = exp.Rule
+		}
+		switch {
+		case cand == nil:
+		case cand.deletes():
+			candidates = append(candidates, *cand)
+			summary.Candidates = append(summary.Candidates, cand.removal())
+		default:
+			actions = append(actions, *cand)
+		}
+	}
+
+	// Dry runs leave grace periods alone, so they only report what a real pass would do
+	if !opts.DryRun {
+		if err := c.Sightings.Update(seen, time.Now(), len(opts.Hashes) == 0); err != nil {
+			logger.Error("Failed to save sightings", "error", err)
+		}
+	}
+
+	if reason := c.checkLimits(len(candidates), summary.Checked); reason != "" {
+		c.abort(logger, summary, reason)
+		return summary, nil
+	}
+
+	if opts.DryRun {
+		for _, cand := range candidates {
+			logger.Info("Would remove torrent", "hash", cand.torrent.Hash, "torrent", cand.torrent.Name, "rule", cand.rule, "missing", len(cand.missingFiles))
+		}
+		for _, cand := range actions {
+			logger.Info("Would apply action to torrent", "hash", cand.torrent.Hash, "torrent", cand.torrent.Name, "rule", cand.rule, "action", cand.action)
+			summary.Actions = append(summary.Actions, cand.removal())
+		}
+		summary.Finished = time.Now()
+		return summary, nil
+	}
+
+	// Tagging, pausing and notifying can be undone, so they need no approval
+	for _, cand := range actions {
+		c.apply(logger, summary, cand)
+	}
+
+	if c.Pending != nil {
+		// A pass limited to some torrents must not drop the others from the queue
+		if err := c.stage(logger, summary, candidates, len(opts.Hashes) == 0); err != nil {
+			return nil, err
+		}
+		summary.Finished = time.Now()
+		return summary, nil
+	}
+
+	if c.Confirm != nil {
+		var err error
+		if candidates, err = c.confirm(logger, candidates); err != nil {
+			c.abort(logger, summary, err.Error())
+			return summary, nil
+		}
+	}
+
+	for _, cand := range candidates {
+		c.remove(logger, summary, cand)
+	}
+
+	summary.Finished = time.Now()
+	return summary, nil
+}
+
+// confirm asks the Confirm callback which candidates to remove and returns those
+func (c *Cleaner) confirm(logger *slog.Logger, candidates []candidate) ([]candidate, error) {
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	removals := make([]Removal, len(candidates))
+	for i, cand := range candidates {
+		removals[i] = cand.removal()
+	}
+	decisions, err := c.Confirm(removals)
+	if err != nil {
+		return nil, err
+	}
+
+	var confirmed []candidate
+	for _, cand := range candidates {
+		switch decisions[cand.torrent.Hash] {
+		case DecisionRemove:
+			confirmed = append(confirmed, cand)
+		case DecisionRemoveKeepData:
+			cand.keepData = true
+			confirmed = append(confirmed, cand)
+		default:
+			logger.Info("Keeping torrent", "hash", cand.torrent.Hash, "torrent", cand.torrent.Name)
+		}
+	}
+	return confirmed, nil
+}
+
+// stage removes the candidates that were approved, whose files this pass has just verified
+// to still be missing, and queues the others for approval. With prune set, queued torrents
+// that are no longer candidates are dropped from the queue.
+func (c *Cleaner) stage(logger *slog.Logger, summary *Summary, candidates []candidate, prune bool) error {
+	queued, err := c.Pending.List()
+	if err != nil {
+		return err
+	}
+	approved := map[string]bool{}
+	for _, item := range queued {
+		approved[strings.ToLower(item.Hash)] = item.Status == pending.StatusApproved
+	}
+
+	var staged []pending.Item
+	var removed []string
+	for _, cand := range candidates {
+		torrent := cand.torrent
+		if approved[strings.ToLower(torrent.Hash)] {
+			if c.remove(logger, summary, cand) {
+				removed = append(removed, torrent.Hash)
+				continue
+			}
+			// Keep a failed removal approved so the next pass retries it
+		} else {
+			logger.Info("Staged torrent for approval", "hash", torrent.Hash, "torrent", torrent.Name, "rule", cand.rule, "missing", len(cand.missingFiles))
+			summary.Staged = append(summary.Staged, cand.removal())
+		}
+
+		r := cand.removal()
+		staged = append(staged, pending.Item{
+			Hash:         r.Hash,
+			Name:         r.Name,
+			Category:     r.Category,
+			SavePath:     r.SavePath,
+			Rule:         r.Rule,
+			MissingFiles: r.MissingFiles,
+			Size:         r.Size,
+			RunID:        summary.RunID,
+		})
+	}
+
+	if err := c.Pending.Stage(staged, prune); err != nil {
+		return err
+	}
+	return c.Pending.Remove(removed...)
+}
+
+// check evaluates the rules against a single torrent and returns a candidate if one matches,
+// along with an explanation of the outcome. The library is only used by rules that look for
+// payloads in it. With trace set, the explanation also records every file and path that was checked.
+func (c *Cleaner) check(logger *slog.Logger, summary *Summary, lib *library, torrent qbittorrent.Torrent, trace bool) (*candidate, Explanation) {
+	log := logger.With("hash", torrent.Hash, "torrent", torrent.Name)
+	summary.record(torrent.Category, func(n *Counts) { n.Total++ })
+	exp := Explanation{
+		Hash:     torrent.Hash,
+		Name:     torrent.Name,
+		Category: torrent.Category,
+		State:    string(torrent.State),
+		Verdict:  VerdictKeep,
+	}
+
+	if c.Exclusions.Excluded(torrent.Hash) {
+		log.Debug("Skipping because it's excluded")
+		summary.record(torrent.Category, func(n *Counts) { n.Skipped++ })
+		exp.step(StepExclusions, "excluded from removal")
+		exp.Status, exp.Reason = StatusExcluded, "the torrent is excluded from removal"
+		return nil, exp
+	}
+	exp.step(StepExclusions, "not excluded")
+
+	// Files and trackers are only listed and looked at once, by the first rule that needs them
+	var files []qbittorrent.TorrentFile
+	var filesListed, filesChecked, missing, libraryChecked, imported bool
+	var missingFiles []string
+	var presentSize int64
+
+	var trackers []qbittorrent.Tracker
+	var trackersListed, trackersChecked, unregistered bool
+	listTrackers := func() error {
+		if trackersListed {
+			return nil
+		}
+		var err error
+		if trackers, err = c.Client.Trackers(torrent.Hash); err != nil {
+			log.Error("Failed to get trackers for torrent", "error", err)
+			c.fail(summary, torrent, StageTrackers, err)
+			exp.Status, exp.Reason = StatusFailed, "getting the trackers of the torrent failed: "+err.Error()
+			return err
+		}
+		trackersListed = true
+		return nil
+	}
+
+	// Rechecking only verifies files right away, so other torrents can't be judged by them
+	verified := c.Verify != VerifyRecheck || summary.rechecked[strings.ToLower(torrent.Hash)]
+
+	var matched *rules.Rule
+	var waiting, unverified bool
+	now := time.Now()
+	for i := range c.Rules {
+		rule := &c.Rules[i]
+		if ok, reason := rule.Check(torrent, now); !ok {
+			exp.step(StepRule, rule.Name+": no match, "+reason)
+			continue
+		}
+
+		// Trusting qBittorrent's state needs no files, unless the library is searched too
+		needsFiles := (rule.ChecksFiles() && c.Verify != VerifyState && verified) || rule.ChecksLibrary()
+		if needsFiles && !filesListed {
+			var err error
+			if files, err = c.Client.TorrentFiles(torrent.Hash); err != nil {
+				log.Error("Failed to get files for torrent", "error", err)
+				exp.step(StepFiles, "listing files failed: "+err.Error())
+				c.fail(summary, torrent, StageFiles, err)
+				exp.Status, exp.Reason = StatusFailed, "getting the files of the torrent failed: "+err.Error()
+				return nil, exp
+			}
+			filesListed = true
+		}
+
+		if rule.ChecksFiles() {
+			if !verified {
+				if !unverified {
+					exp.step(StepFiles, c.unverified(torrent, summary.DryRun))
+					unverified = true
+				}
+				exp.step(StepRule, rule.Name+": no match, the files were not verified")
+				continue
+			}
+			if !filesChecked && c.Verify == VerifyRecheck {
+				missingFiles, presentSize = c.checkProgress(log, files, trace, &exp)
+				missing = len(missingFiles) > 0
+				filesChecked = true
+			}
+			if !filesChecked && c.Verify == VerifyState {
+				var err error
+				if torrent, missing, err = c.checkState(log, torrent, !summary.DryRun, &exp); err != nil {
+					log.Error("Failed to recheck torrent", "error", err)
+					exp.step(StepFiles, "recheck failed: "+err.Error())
+					c.fail(summary, torrent, StageFiles, err)
+					exp.Status, exp.Reason = StatusFailed, "rechecking the torrent failed: "+err.Error()
+					return nil, exp
+				}
+				// Only a recheck tells how much of the data is still there
+				if c.Recheck && !summary.DryRun {
+					presentSize = torrent.Size - torrent.AmountLeft
+				}
+				filesChecked = true
+			}
+			if !filesChecked {
+				missingFiles, presentSize = c.checkFiles(log, files, trace, &exp)
+				missing = len(missingFiles) > 0
+				filesChecked = true
+			}
+			if missing != *rule.Match.MissingFiles {
+				if missing {
+					exp.step(StepRule, rule.Name+": no match, files are missing")
+				} else {
+					exp.step(StepRule, rule.Name+": no match, no files are missing")
+				}
+				continue
+			}
+		}
+
+		if rule.ChecksLibrary() {
+			if !libraryChecked {
+				imported = c.checkLibrary(lib, files, &exp)
+				libraryChecked = true
+			}
+			if imported != *rule.Match.InLibrary {
+				if imported {
+					exp.step(StepRule, rule.Name+": no match, the payload is in the library")
+				} else {
+					exp.step(StepRule, rule.Name+": no match, the payload is not in the library")
+				}
+				continue
+			}
+		}
+
+		if rule.ChecksTrackers() {
+			if err := listTrackers(); err != nil {
+				exp.step(StepTrackers, "listing trackers failed: "+err.Error())
+				return nil, exp
+			}
+			if !trackersChecked {
+				unregistered = c.checkUnregistered(trackers, &exp)
+				trackersChecked = true
+			}
+			if unregistered != *rule.Match.Unregistered {
+				if unregistered {
+					exp.step(StepRule, rule.Name+": no match, the torrent is unregistered")
+				} else {
+					exp.step(StepRule, rule.Name+": no match, the torrent is registered")
+				}
+				continue
+			}
+		}
+
+		matched = rule
+		if rule.Grace > 0 {
+			exp.GraceUntil = c.Sightings.FirstSeen(torrent.Hash, rule.Name, now).Add(time.Duration(rule.Grace))
+			if now.Before(exp.GraceUntil) {
+				exp.step(StepRule, rule.Name+": match, waiting for the grace period until "+exp.GraceUntil.Format(time.RFC3339))
+				waiting = true
+				break
+			}
+		}
+		exp.step(StepRule, rule.Name+": match")
+		break
+	}
+
+	switch {
+	case unverified && matched == nil:
+		summary.record(torrent.Category, func(n *Counts) { n.Skipped++ })
+		exp.Status, exp.Reason = StatusSkipped, "the files were not verified by a recheck in this pass"
+	case filesChecked && missing:
+		summary.record(torrent.Category, func(n *Counts) { n.Checked++; n.Missing++ })
+		exp.Status, exp.MissingFiles = StatusMissing, missingFiles
+		exp.Reason = fmt.Sprintf("%d of the wanted files are missing", len(missingFiles))
+		if c.Verify == VerifyState {
+			exp.Reason = "qBittorrent reports the files as missing"
+		}
+	case filesChecked:
+		log.Debug("All files are present")
+		summary.record(torrent.Category, func(n *Counts) { n.Checked++; n.Healthy++ })
+		exp.Status, exp.Reason = StatusHealthy, "all wanted files are present"
+		if c.Verify == VerifyState {
+			exp.Reason = "qBittorrent reports the files as present"
+		}
+	case matched != nil:
+		summary.record(torrent.Category, func(n *Counts) { n.Checked++ })
+		exp.Status = StatusMatched
+	default:
+		log.Debug("Skipping because no rule matches", "state", torrent.State)
+		summary.record(torrent.Category, func(n *Counts) { n.Skipped++ })
+		exp.Status = StatusSkipped
+	}
+
+	if matched == nil {
+		exp.addReason("no rule matches")
+		exp.step(StepVerdict, "keep, no rule matches")
+		return nil, exp
+	}
+
+	cand := &candidate{
+		torrent:      torrent,
+		rule:         matched.Name,
+		action:       matched.Action,
+		tags:         matched.Tags,
+		missingFiles: missingFiles,
+		missing:      missing,
+		size:         presentSize,
+		keepData:     matched.Action == rules.ActionDeleteKeepData,
+	}
+	if !filesChecked {
+		// Without looking at the files, everything on disk counts towards the size
+		cand.size = torrent.Size - torrent.AmountLeft
+	}
+
+	exp.Rule, exp.Action = matched.Name, matched.Action
+	exp.addReason("rule " + matched.Name + " matches")
+	if waiting {
+		exp.addReason("waiting for its grace period")
+		exp.step(StepVerdict, "keep, grace period until "+exp.GraceUntil.Format(time.RFC3339))
+		return nil, exp
+	}
+
+	if matched.Deletes() && len(c.Protections) > 0 {
+		// Without the trackers the torrent might be protected, so it is kept
+		if err := listTrackers(); err != nil {
+			exp.step(StepProtection, "listing trackers failed: "+err.Error())
+			return nil, exp
+		}
+		protection, host := c.protection(torrent, trackers)
+		if protection == nil {
+			exp.step(StepProtection, "no hit-and-run protection applies")
+		} else {
+			requirements := protection.Requirements(torrent)
+			exp.step(StepProtection, fmt.Sprintf("%s requires %s", host, requirements))
+			if !missing {
+				log.Info("Keeping torrent protected from hit and run", "rule", matched.Name, "tracker", host, "requirements", requirements)
+				exp.addReason("protected from hit and run until " + requirements)
+				exp.step(StepVerdict, "keep, protected from hit and run")
+				return nil, exp
+			}
+
+			// Files that are gone can't be seeded either, so someone has to look at it
+			cand.rule, cand.action, cand.tags, cand.keepData = RuleHitAndRun, ActionTag, []string{c.ProtectedTag}, false
+			exp.Action = ActionTag
+			exp.addReason("protected from hit and run until " + requirements)
+		}
+	}
+
+	if done := cand.done(); done != "" {
+		exp.step(StepVerdict, "keep, "+done)
+		return nil, exp
+	}
+	if cand.deletes() {
+		exp.Verdict = VerdictRemove
+	}
+	exp.step(StepVerdict, cand.action+" by rule "+cand.rule)
+	return cand, exp
+}
+
+// checkFiles looks for the wanted files of a torrent in the download directories and returns
+// those that are missing and the size of those that are present. The check is recorded in exp.
+func (c *Cleaner) checkFiles(log *slog.Logger, files []qbittorrent.TorrentFile, trace bool, exp *Explanation) ([]string, int64) {
+	var missingFiles []string
+	var presentSize int64
+	var wanted int
+	for _, file := range files {
+		fc := FileCheck{Name: file.Name, Size: file.Size, Priority: file.Priority}
+
+		// Skip files that are not downloaded
+		if file.Priority == 0 {
+			if trace {
+				exp.Files = append(exp.Files, fc)
+			}
+			continue
+		}
+		wanted++
+		fc.Wanted = true
+
+		fc.Found, fc.Paths = c.locate(file.Name, trace)
+		if trace {
+			exp.Files = append(exp.Files, fc)
+		}
+		if fc.Found == "" {
+			log.Info("File is missing", "file", file.Name)
+			missingFiles = append(missingFiles, file.Name)
+			continue
+		}
+		presentSize += file.Size
+	}
+	exp.step(StepFiles, fmt.Sprintf("%d of %d files wanted, %d missing", wanted, len(files), len(missingFiles)))
+
+	return missingFiles, presentSize
+}
+
+// remove deletes a candidate torrent and its data, records the outcome and reports whether it succeeded
+func (c *Cleaner) remove(logger *slog.Logger, summary *Summary, cand candidate) bool {
+	torrent := cand.torrent
+	log := logger.With("hash", torrent.Hash, "torrent", torrent.Name)
+
+	log.Warn("Removing torrent", "rule", cand.rule, "missing", len(cand.missingFiles), "keep_data", cand.keepData)
+	action := ActionDelete
+	if cand.keepData {
+		action = ActionDeleteKeepData
+	}
+	entry := journal.Entry{
+		RunID:        summary.RunID,
+		Hash:         torrent.Hash,
+		Name:         torrent.Name,
+		Category:     torrent.Category,
+		SavePath:     torrent.SavePath,
+		Rule:         cand.rule,
+		MissingFiles: cand.missingFiles,
+		Action:       action,
+		Outcome:      journal.OutcomeSuccess,
+	}
+
+	if err := c.backup(torrent.Hash); err != nil {
+		// Older qBittorrent versions can't export torrents, which must not block cleaning
+		log.Warn("Failed to back up torrent file, it can't be restored", "error", err)
+	}
+
+	if err := c.Client.RemoveTorrent(torrent.Hash, !cand.keepData); err != nil {
+		log.Error("Failed to remove torrent", "error", err)
+		entry.Outcome = journal.OutcomeFailed
+		entry.Error = err.Error()
+		c.fail(summary, torrent, StageRemove, err)
+	} else {
+		summary.record(torrent.Category, func(n *Counts) {
+			n.Removed++
+			if !cand.keepData {
+				n.BytesReclaimed += cand.size
+			}
+		})
+		summary.Removals = append(summary.Removals, cand.removal())
+	}
+
+	if err := c.Journal.Append(entry); err != nil {
+		log.Error("Failed to write journal entry", "error", err)
+	}
+	return entry.Outcome == journal.OutcomeSuccess
+}
+
+// apply tags, pauses or only reports a torrent matched by a rule and records the outcome
+func (c *Cleaner) apply(logger *slog.Logger, summary *Summary, cand candidate) {
+	torrent := cand.torrent
+	log := logger.With("hash", torrent.Hash, "torrent", torrent.Name, "rule", cand.rule)
+
+	var err error
+	switch cand.action {
+	case ActionTag:
+		log.Info("Tagging torrent", "tags", cand.tags)
+		err = c.Client.AddTags(torrent.Hash, cand.tags)
+	case ActionPause:
+		log.Info("Pausing torrent")
+		err = c.Client.PauseTorrent(torrent.Hash)
+	default:
+		// Notifying only reports the torrent through the summary
+		log.Info("Reporting torrent")
+		summary.Actions = append(summary.Actions, cand.removal())
+		return
+	}
+
+	entry := journal.Entry{
+		RunID:    summary.RunID,
+		Hash:     torrent.Hash,
+		Name:     torrent.Name,
+		Category: torrent.Category,
+		SavePath: torrent.SavePath,
+		Rule:     cand.rule,
+		Action:   cand.action,
+		Outcome:  journal.OutcomeSuccess,
+	}
+	if err != nil {
+		log.Error("Failed to apply action to torrent", "action", cand.action, "error", err)
+		entry.Outcome = journal.OutcomeFailed
+		entry.Error = err.Error()
+		c.fail(summary, torrent, StageAction, err)
+	} else {
+		summary.Actions = append(summary.Actions, cand.removal())
+	}
+
+	if err := c.Journal.Append(entry); err != nil {
+		log.Error("Failed to write journal entry", "error", err)
+	}
+}
+
+// backup saves the .torrent file of a torrent to the backup directory, if one is set
+func (c *Cleaner) backup(hash string) error {
+	if c.BackupDir == "" {
+		return nil
+	}
+
+	data, err := c.Client.ExportTorrent(hash)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(BackupPath(c.BackupDir, hash), data, 0o644)
+}
+
+// BackupPath returns where the .torrent file of a torrent is saved in the backup directory
+func BackupPath(dir, hash string) string {
+	return filepath.Join(dir, strings.ToLower(hash)+".torrent")
+}
+
+// loadLibrary indexes the media library if any rule looks for payloads in it
+func (c *Cleaner) loadLibrary() (*library, error) {
+	if !slices.ContainsFunc(c.Rules, func(r rules.Rule) bool { return r.ChecksLibrary() }) {
+		return nil, nil
+	}
+	return loadLibrary(c.LibraryDirs)
+}
+
+// checksFiles reports whether any rule looks for files in the download directories
+func (c *Cleaner) checksFiles() bool {
+	return slices.ContainsFunc(c.Rules, func(r rules.Rule) bool { return r.ChecksFiles() })
+}
+
+// ChecksDownloadDirs reports whether any rule looks for files, and looks for them in the download directories
+func (c *Cleaner) ChecksDownloadDirs() bool {
+	return c.checksFiles() && (c.Verify == "" || c.Verify == VerifyFiles)
+}
+
+// CheckDownloadDirs verifies that every download directory exists and can be read
+func (c *Cleaner) CheckDownloadDirs() error {
+	for _, dir := range c.DownloadDirs {
+		f, err := os.Open(dir)
+		if err != nil {
+			return fmt.Errorf("download directory %s is not accessible: %v", dir, err)
+		}
+
+		// Read a single entry to make sure the directory is actually listable
+		_, err = f.Readdirnames(1)
+		f.Close()
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("download directory %s is not readable: %v", dir, err)
+		}
+	}
+	return nil
+}
+
+// filterHashes returns the torrents whose hash is in hashes
+func filterHashes(torrents []qbittorrent.Torrent, hashes []string) []qbittorrent.Torrent {
+	wanted := map[string]bool{}
+	for _, hash := range hashes {
+		wanted[strings.ToLower(hash)] = true
+	}
+
+	var filtered []qbittorrent.Torrent
+	for _, torrent := range torrents {
+		if wanted[strings.ToLower(torrent.Hash)] {
+			filtered = append(filtered, torrent)
+		}
+	}
+	return filtered
+}
+
+// checkLimits returns a reason to abort if removing count torrents would exceed a safety limit
+func (c *Cleaner) checkLimits(count, checked int) string {
+	if c.MaxRemovals > 0 && count > c.MaxRemovals {
+		return fmt.Sprintf("%d torrents would be removed, more than the limit of %d", count, c.MaxRemovals)
+	}
+
+	if c.MaxRemovalPercent > 0 && checked > 0 {
+		percent := float64(count) / float64(checked) * 100
+		if percent > c.MaxRemovalPercent {
+			return fmt.Sprintf("%.1f%% of checked torrents would be removed, more than the limit of %.1f%%", percent, c.MaxRemovalPercent)
+		}
+	}
+	return ""
+}
+
+// abort marks the pass as stopped by a safety check
+func (c *Cleaner) abort(logger *slog.Logger, summary *Summary, reason string) {
+	logger.Error("Aborting pass, nothing was removed", "reason", reason)
+	summary.Aborted = true
+	summary.AbortReason = reason
+	summary.Finished = time.Now()
+}
+
+// locate returns the path at which a torrent file exists in the download directories,
+// or an empty string if it is missing. With trace set, every path tried is returned.
+func (c *Cleaner) locate(name string, trace bool) (string, []PathCheck) {
+	var checks []PathCheck
+	for _, dir := range c.DownloadDirs {
+		path := filepath.Join(dir, name)
+		info, err := os.Stat(path)
+		if trace {
+			check := PathCheck{Path: path, Found: err == nil}
+			if err != nil {
+				check.Error = err.Error()
+			} else {
+				check.Size = info.Size()
+			}
+			checks = append(checks, check)
+		}
+		if err == nil {
+			return path, checks
+		}
+	}
+	return "", checks
+}
+
+// fail records a torrent that could not be checked or removed
+func (c *Cleaner) fail(summary *Summary, torrent qbittorrent.Torrent, stage string, err error) {
+	summary.record(torrent.Category, func(n *Counts) { n.Failed++ })
+	summary.Failures = append(summary.Failures, Failure{
+		Hash:  torrent.Hash,
+		Name:  torrent.Name,
+		Stage: stage,
+		Error: err.Error(),
+	})
+}
+
+// logger returns the cleaner's logger, falling back to the default logger
+func (c *Cleaner) logger() *slog.Logger {
+	if c.Logger == nil {
+		return slog.Default()
+	}
+	return c.Logger
+}
@@ -0,0 +1,389 @@
+package cleaner
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mallox/qbittorrent-cleaner/journal"
+	"github.com/mallox/qbittorrent-cleaner/pending"
+	"github.com/mallox/qbittorrent-cleaner/qbittorrent"
+)
+
+// fakeServer is a minimal qBittorrent WebUI used to drive the cleaner in tests
+type fakeServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	torrents []qbittorrent.Torrent
+	files    map[string][]qbittorrent.TorrentFile
+	trackers map[string][]qbittorrent.Tracker
+	removed  []string
+	keptData []string // Removed torrents whose files were kept
+	added    []string // Uploaded .torrent files with their save path and category
+	tagged   []string // Tagged torrents with their tags
+	paused   []string
+	failures map[string]int // Status codes to return per endpoint path
+
+	rechecked    []string
+	afterRecheck map[string]qbittorrent.Torrent // How torrents look once they were rechecked
+}
+
+// newFakeServer starts a fake qBittorrent server serving the given torrents and files
+func newFakeServer(t *testing.T, torrents []qbittorrent.Torrent, files map[string][]qbittorrent.TorrentFile) *fakeServer {
+	f := &fakeServer{torrents: torrents, files: files, failures: map[string]int{}}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		if status, ok := f.failures[r.URL.Path]; ok {
+			w.WriteHeader(status)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/api/v2/auth/login":
+			http.SetCookie(w, &http.Cookie{Name: "SID", Value: "test-session-id"})
+		case "/api/v2/torrents/info":
+			json.NewEncoder(w).Encode(f.torrents)
+		case "/api/v2/torrents/files":
+			json.NewEncoder(w).Encode(f.files[r.URL.Query().Get("hash")])
+		case "/api/v2/torrents/trackers":
+			json.NewEncoder(w).Encode(f.trackers[r.URL.Query().Get("hash")])
+		case "/api/v2/torrents/export":
+			w.Write([]byte("torrent:" + r.URL.Query().Get("hash")))
+		case "/api/v2/torrents/add":
+			file, _, err := r.FormFile("torrents")
+			if err != nil {
+				t.Errorf("Expected torrent file: %v", err)
+				return
+			}
+			data, _ := io.ReadAll(file)
+			f.added = append(f.added, string(data)+"@"+r.FormValue("savepath")+"/"+r.FormValue("category"))
+		case "/api/v2/torrents/delete":
+			r.ParseForm()
+			f.removed = append(f.removed, r.Form.Get("hashes"))
+			if r.Form.Get("deleteFiles") != "true" {
+				f.keptData = append(f.keptData, r.Form.Get("hashes"))
+			}
+		case "/api/v2/torrents/addTags":
+			r.ParseForm()
+			f.tagged = append(f.tagged, r.Form.Get("hashes")+":"+r.Form.Get("tags"))
+		case "/api/v2/torrents/recheck":
+			r.ParseForm()
+			for _, hash := range strings.Split(r.Form.Get("hashes"), "|") {
+				f.rechecked = append(f.rechecked, hash)
+				for i := range f.torrents {
+					if after, ok := f.afterRecheck[hash]; ok && f.torrents[i].Hash == hash {
+						f.torrents[i] = after
+					}
+				}
+			}
+		case "/api/v2/torrents/stop":
+			r.ParseForm()
+			f.paused = append(f.paused, r.Form.Get("hashes"))
+		default:
+			t.Errorf("Unexpected request to %s", r.URL.Path)
+		}
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// newTestCleaner creates a cleaner logged in to the fake server
+func newTestCleaner(t *testing.T, f *fakeServer, dirs ...string) *Cleaner {
+	client := qbittorrent.NewClient(f.URL, "admin", "adminadmin")
+	if err := client.Login(); err != nil {
+		t.Fatalf("Failed to login: %v", err)
+	}
+	return New(client, dirs)
+}
+
+// writeFile creates a file with the given size below dir
+func writeFile(t *testing.T, dir, name string, size int) {
+	path := filepath.Join(dir, name)
+	os.MkdirAll(filepath.Dir(path), 0o755)
+	if err := os.WriteFile(path, make([]byte, size), 0o644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+// TestRun tests a pass over healthy, incomplete and broken torrents
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "complete/file1.txt", 10)
+	writeFile(t, dir, "broken/present.bin", 100)
+
+	f := newFakeServer(t, []qbittorrent.Torrent{
+		{Hash: "aaa", Name: "Complete", Category: "tv"},
+		{Hash: "bbb", Name: "Incomplete", Category: "tv", AmountLeft: 1024, State: "downloading"},
+		{Hash: "ccc", Name: "Broken", Category: "movies", SavePath: "/downloads/movies"},
+		{Hash: "ddd", Name: "Moving", AmountLeft: 1024, State: "moving"},
+	}, map[string][]qbittorrent.TorrentFile{
+		"aaa": {{Name: "complete/file1.txt", Size: 10, Priority: 1}, {Name: "complete/skipped.txt", Priority: 0}},
+		"ccc": {{Name: "broken/present.bin", Size: 100, Priority: 1}, {Name: "broken/gone.bin", Size: 50, Priority: 1}},
+		"ddd": {{Name: "moving/file.bin", Size: 10, Priority: 1}},
+	})
+
+	journalPath := filepath.Join(t.TempDir(), "journal.jsonl")
+	audit, err := journal.Open(journalPath)
+	if err != nil {
+		t.Fatalf("Failed to open journal: %v", err)
+	}
+	defer audit.Close()
+
+	c := newTestCleaner(t, f, dir)
+	c.Journal = audit
+
+	summary, err := c.Run(Options{})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if summary.Total != 4 || summary.Checked != 3 || summary.Skipped != 1 || summary.Healthy != 1 || summary.Removed != 2 || summary.Failed != 0 {
+		t.Errorf("Unexpected counts: %+v", summary.Counts)
+	}
+
+	if summary.BytesReclaimed != 100 {
+		t.Errorf("Expected 100 bytes reclaimed, got %d", summary.BytesReclaimed)
+	}
+
+	if tv := summary.Categories["tv"]; tv == nil || tv.Healthy != 1 || tv.Skipped != 1 {
+		t.Errorf("Unexpected tv counts: %+v", tv)
+	}
+
+	if none := summary.Categories[Uncategorized]; none == nil || none.Removed != 1 {
+		t.Errorf("Unexpected uncategorized counts: %+v", none)
+	}
+
+	if len(f.removed) != 2 || f.removed[0] != "ccc" || f.removed[1] != "ddd" {
+		t.Errorf("Expected ccc and ddd to be removed, got %v", f.removed)
+	}
+
+	if len(summary.Removals) != 2 || summary.Removals[0].MissingFiles[0] != "broken/gone.bin" {
+		t.Errorf("Unexpected removals: %+v", summary.Removals)
+	}
+
+	entries, err := journal.Read(journalPath, journal.Filter{})
+	if err != nil {
+		t.Fatalf("Failed to read journal: %v", err)
+	}
+	if len(entries) != 2 || entries[0].RunID != summary.RunID || entries[0].SavePath != "/downloads/movies" {
+		t.Errorf("Unexpected journal entries: %+v", entries)
+	}
+}
+
+// TestRunFailures tests that failed file lookups and removals are counted
+func TestRunFailures(t *testing.T) {
+	f := newFakeServer(t, []qbittorrent.Torrent{
+		{Hash: "aaa", Name: "Broken"},
+	}, map[string][]qbittorrent.TorrentFile{
+		"aaa": {{Name: "gone.bin", Priority: 1}},
+	})
+	f.failures["/api/v2/torrents/delete"] = http.StatusInternalServerError
+
+	c := newTestCleaner(t, f, t.TempDir())
+	summary, err := c.Run(Options{})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if summary.Failed != 1 || summary.Removed != 0 {
+		t.Errorf("Unexpected counts: %+v", summary.Counts)
+	}
+	if len(summary.Failures) != 1 || summary.Failures[0].Stage != StageRemove {
+		t.Errorf("Unexpected failures: %+v", summary.Failures)
+	}
+
+	f.failures["/api/v2/torrents/files"] = http.StatusInternalServerError
+	summary, _ = c.Run(Options{})
+	if len(summary.Failures) != 1 || summary.Failures[0].Stage != StageFiles {
+		t.Errorf("Unexpected failures: %+v", summary.Failures)
+	}
+}
+
+// TestRunListError tests that a failure to list torrents aborts the pass
+func TestRunListError(t *testing.T) {
+	f := newFakeServer(t, nil, nil)
+	c := newTestCleaner(t, f)
+	f.failures["/api/v2/torrents/info"] = http.StatusForbidden
+
+	if _, err := c.Run(Options{}); err == nil {
+		t.Error("Expected Run to fail when torrents cannot be listed")
+	}
+}
+
+// TestRunSafetyChecks tests that passes exceeding a safety limit remove nothing
+func TestRunSafetyChecks(t *testing.T) {
+	torrents := []qbittorrent.Torrent{
+		{Hash: "aaa", Name: "Broken 1"},
+		{Hash: "bbb", Name: "Broken 2"},
+		{Hash: "ccc", Name: "Healthy"},
+	}
+	files := map[string][]qbittorrent.TorrentFile{
+		"aaa": {{Name: "gone1.bin", Priority: 1}},
+		"bbb": {{Name: "gone2.bin", Priority: 1}},
+		"ccc": {{Name: "present.bin", Priority: 1}},
+	}
+
+	dir := t.TempDir()
+	writeFile(t, dir, "present.bin", 1)
+
+	tests := []struct {
+		name      string
+		configure func(c *Cleaner)
+		aborted   bool
+	}{
+		{"no limits", func(c *Cleaner) {}, false},
+		{"count within limit", func(c *Cleaner) { c.MaxRemovals = 2 }, false},
+		{"count over limit", func(c *Cleaner) { c.MaxRemovals = 1 }, true},
+		{"percent over limit", func(c *Cleaner) { c.MaxRemovalPercent = 50 }, true},
+		{"percent within limit", func(c *Cleaner) { c.MaxRemovalPercent = 70 }, false},
+		{"missing download dir", func(c *Cleaner) { c.DownloadDirs = append(c.DownloadDirs, filepath.Join(dir, "unmounted")) }, true},
+	}
+
+	for _, tt := range tests {
+		f := newFakeServer(t, torrents, files)
+		c := newTestCleaner(t, f, dir)
+		tt.configure(c)
+
+		summary, err := c.Run(Options{})
+		if err != nil {
+			t.Fatalf("%s: Run failed: %v", tt.name, err)
+		}
+
+		if summary.Aborted != tt.aborted {
+			t.Errorf("%s: expected aborted=%v, got %v (%s)", tt.name, tt.aborted, summary.Aborted, summary.AbortReason)
+		}
+
+		if tt.aborted && len(f.removed) != 0 {
+			t.Errorf("%s: expected nothing removed on abort, got %v", tt.name, f.removed)
+		}
+		if !tt.aborted && len(f.removed) != 2 {
+			t.Errorf("%s: expected 2 removals, got %v", tt.name, f.removed)
+		}
+	}
+}
+
+// TestRunDryRunAndHashes tests dry runs and passes scoped to specific hashes
+func TestRunDryRunAndHashes(t *testing.T) {
+	f := newFakeServer(t, []qbittorrent.Torrent{
+		{Hash: "aaa", Name: "Broken 1"},
+		{Hash: "bbb", Name: "Broken 2"},
+	}, map[string][]qbittorrent.TorrentFile{
+		"aaa": {{Name: "gone1.bin", Priority: 1}},
+		"bbb": {{Name: "gone2.bin", Priority: 1}},
+	})
+	c := newTestCleaner(t, f, t.TempDir())
+
+	summary, err := c.Run(Options{RunID: "dry", DryRun: true})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if summary.RunID != "dry" || !summary.DryRun {
+		t.Errorf("Expected dry run with the given ID, got %s %v", summary.RunID, summary.DryRun)
+	}
+	if len(summary.Candidates) != 2 || summary.Removed != 0 || len(f.removed) != 0 {
+		t.Errorf("Expected 2 candidates and no removals, got %d candidates, %v removed", len(summary.Candidates), f.removed)
+	}
+
+	summary, err = c.Run(Options{Hashes: []string{"BBB"}})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if summary.Total != 1 || len(f.removed) != 1 || f.removed[0] != "bbb" {
+		t.Errorf("Expected only bbb to be checked and removed, got total %d, removed %v", summary.Total, f.removed)
+	}
+}
+
+// TestRunStage tests that candidates are staged and only approved ones are removed
+func TestRunStage(t *testing.T) {
+	dir := t.TempDir()
+	f := newFakeServer(t, []qbittorrent.Torrent{
+		{Hash: "aaa", Name: "Broken 1"},
+		{Hash: "bbb", Name: "Broken 2"},
+	}, map[string][]qbittorrent.TorrentFile{
+		"aaa": {{Name: "gone1.bin", Priority: 1}},
+		"bbb": {{Name: "gone2.bin", Priority: 1}},
+	})
+	c := newTestCleaner(t, f, dir)
+	c.Pending = pending.Open(filepath.Join(t.TempDir(), "pending.json"))
+
+	summary, err := c.Run(Options{})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(summary.Staged) != 2 || summary.Removed != 0 || len(f.removed) != 0 {
+		t.Errorf("Expected 2 staged torrents and no removals, got %d staged, %v removed", len(summary.Staged), f.removed)
+	}
+
+	c.Pending.Approve("aaa", "bbb")
+
+	// The files of bbb came back, so it must not be removed and leaves the queue
+	writeFile(t, dir, "gone2.bin", 1)
+	summary, err = c.Run(Options{})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if summary.Removed != 1 || len(f.removed) != 1 || f.removed[0] != "aaa" || len(summary.Staged) != 0 {
+		t.Errorf("Expected only aaa to be removed, got %v removed, %d staged", f.removed, len(summary.Staged))
+	}
+	if items, _ := c.Pending.List(); len(items) != 0 {
+		t.Errorf("Expected empty queue, got %+v", items)
+	}
+}
+
+// TestRunConfirm tests that only confirmed candidates are removed
+func TestRunConfirm(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "two/present.bin", 50)
+	f := newFakeServer(t, []qbittorrent.Torrent{
+		{Hash: "aaa", Name: "Broken 1"},
+		{Hash: "bbb", Name: "Broken 2"},
+		{Hash: "ccc", Name: "Broken 3"},
+	}, map[string][]qbittorrent.TorrentFile{
+		"aaa": {{Name: "one/gone.bin", Priority: 1}},
+		"bbb": {{Name: "two/gone.bin", Priority: 1}, {Name: "two/present.bin", Size: 50, Priority: 1}},
+		"ccc": {{Name: "three/gone.bin", Priority: 1}},
+	})
+	c := newTestCleaner(t, f, dir)
+
+	var asked []Removal
+	c.Confirm = func(candidates []Removal) (map[string]string, error) {
+		asked = candidates
+		return map[string]string{"aaa": DecisionRemove, "bbb": DecisionRemoveKeepData, "ccc": DecisionKeep}, nil
+	}
+
+	summary, err := c.Run(Options{})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(asked) != 3 {
+		t.Errorf("Expected to be asked about 3 candidates, got %d", len(asked))
+	}
+	if len(f.removed) != 2 || len(f.keptData) != 1 || f.keptData[0] != "bbb" {
+		t.Errorf("Expected aaa and bbb to be removed, keeping the data of bbb, got %v, kept %v", f.removed, f.keptData)
+	}
+	if summary.Removed != 2 || summary.BytesReclaimed != 0 {
+		t.Errorf("Expected 2 removals and nothing reclaimed, got %d, %d bytes", summary.Removed, summary.BytesReclaimed)
+	}
+
+	// Declining the confirmation aborts without removing anything
+	f.removed = nil
+	c.Confirm = func(candidates []Removal) (map[string]string, error) {
+		return nil, errors.New("removal was not confirmed")
+	}
+	summary, err = c.Run(Options{})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if !summary.Aborted || len(f.removed) != 0 {
+		t.Errorf("Expected aborted pass without removals, got aborted %v, removed %v", summary.Aborted, f.removed)
+	}
+}
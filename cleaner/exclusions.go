@@ -0,0 +1,137 @@
+package cleaner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mallox/qbittorrent-cleaner/atomicfile"
+)
+
+// Exclusion keeps a torrent from being removed, either permanently or until a point in time
+type Exclusion struct {
+	Hash    string    `json:"hash"`
+	Name    string    `json:"name,omitempty"`
+	Added   time.Time `json:"added"`
+	Until   time.Time `json:"until,omitzero"` // Zero means the exclusion never expires
+	Comment string    `json:"comment,omitempty"`
+}
+
+// Exclusions is a set of excluded torrents, optionally persisted to a JSON file
+type Exclusions struct {
+	path string
+
+	mu      sync.Mutex
+	entries map[string]Exclusion
+	now     func() time.Time
+}
+
+// LoadExclusions reads the exclusions stored at path. A missing file yields an empty
+// set, and an empty path keeps the exclusions in memory only.
+func LoadExclusions(path string) (*Exclusions, error) {
+	e := &Exclusions{path: path, entries: map[string]Exclusion{}, now: time.Now}
+	if path == "" {
+		return e, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return e, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading exclusions failed: %w", err)
+	}
+
+	var list []Exclusion
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("parsing exclusions failed: %w", err)
+	}
+	for _, ex := range list {
+		e.entries[strings.ToLower(ex.Hash)] = ex
+	}
+	return e, nil
+}
+
+// Excluded reports whether a torrent is currently excluded. A nil set excludes nothing.
+func (e *Exclusions) Excluded(hash string) bool {
+	if e == nil {
+		return false
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ex, ok := e.entries[strings.ToLower(hash)]
+	return ok && (ex.Until.IsZero() || e.now().Before(ex.Until))
+}
+
+// Add excludes a torrent, replacing any existing exclusion for it
+func (e *Exclusions) Add(ex Exclusion) error {
+	if ex.Hash == "" {
+		return errors.New("exclusion requires a hash")
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if ex.Added.IsZero() {
+		ex.Added = e.now()
+	}
+	e.entries[strings.ToLower(ex.Hash)] = ex
+	return e.save()
+}
+
+// Remove deletes the exclusion for a torrent and reports whether there was one
+func (e *Exclusions) Remove(hash string) (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	key := strings.ToLower(hash)
+	if _, ok := e.entries[key]; !ok {
+		return false, nil
+	}
+	delete(e.entries, key)
+	return true, e.save()
+}
+
+// List returns the exclusions that have not expired, sorted by hash
+func (e *Exclusions) List() []Exclusion {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.active()
+}
+
+// active returns the unexpired exclusions sorted by hash. The lock must be held.
+func (e *Exclusions) active() []Exclusion {
+	now := e.now()
+	list := []Exclusion{}
+	for _, ex := range e.entries {
+		if ex.Until.IsZero() || now.Before(ex.Until) {
+			list = append(list, ex)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Hash < list[j].Hash })
+	return list
+}
+
+// save writes the unexpired exclusions to the file, replacing it atomically. The lock must be held.
+func (e *Exclusions) save() error {
+	if e.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(e.active(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling exclusions failed: %w", err)
+	}
+
+	if err := atomicfile.WriteFile(e.path, data, 0o644); err != nil {
+		return fmt.Errorf("writing exclusions failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package cleaner
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mallox/qbittorrent-cleaner/qbittorrent"
+)
+
+// TestExclusions tests adding, expiring, persisting and removing exclusions
+func TestExclusions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "exclusions.json")
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	e, err := LoadExclusions(path)
+	if err != nil {
+		t.Fatalf("LoadExclusions failed: %v", err)
+	}
+	e.now = func() time.Time { return now }
+
+	if err := e.Add(Exclusion{Hash: "AAA", Name: "Keep"}); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if err := e.Add(Exclusion{Hash: "bbb", Until: now.Add(time.Hour)}); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if !e.Excluded("aaa") || !e.Excluded("bbb") || e.Excluded("ccc") {
+		t.Errorf("Expected aaa and bbb to be excluded")
+	}
+
+	now = now.Add(2 * time.Hour)
+	if e.Excluded("bbb") {
+		t.Errorf("Expected exclusion of bbb to expire")
+	}
+
+	loaded, err := LoadExclusions(path)
+	if err != nil {
+		t.Fatalf("LoadExclusions failed: %v", err)
+	}
+	if list := loaded.List(); len(list) != 1 || list[0].Hash != "AAA" || list[0].Name != "Keep" {
+		t.Errorf("Expected the permanent exclusion to be persisted, got %+v", list)
+	}
+
+	if ok, err := loaded.Remove("aaa"); !ok || err != nil {
+		t.Errorf("Expected aaa to be removed, got %v %v", ok, err)
+	}
+	if ok, _ := loaded.Remove("aaa"); ok {
+		t.Errorf("Expected second removal to report nothing removed")
+	}
+
+	var none *Exclusions
+	if none.Excluded("aaa") {
+		t.Errorf("Expected nil exclusions to exclude nothing")
+	}
+}
+
+// TestRunExclusions tests that excluded torrents are skipped
+func TestRunExclusions(t *testing.T) {
+	f := newFakeServer(t, []qbittorrent.Torrent{{Hash: "aaa", Name: "Broken"}}, map[string][]qbittorrent.TorrentFile{
+		"aaa": {{Name: "gone.bin", Priority: 1}},
+	})
+	c := newTestCleaner(t, f, t.TempDir())
+	c.Exclusions, _ = LoadExclusions("")
+	c.Exclusions.Add(Exclusion{Hash: "aaa"})
+
+	summary, err := c.Run(Options{})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if summary.Skipped != 1 || summary.Removed != 0 || len(f.removed) != 0 {
+		t.Errorf("Expected excluded torrent to be skipped, got skipped %d, removed %v", summary.Skipped, f.removed)
+	}
+}
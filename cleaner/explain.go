@@ -0,0 +1,170 @@
+package cleaner
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Health statuses of a torrent
+const (
+	StatusHealthy  = "healthy"
+	StatusMissing  = "missing"
+	StatusSkipped  = "skipped"
+	StatusExcluded = "excluded"
+	StatusFailed   = "failed"
+	StatusMatched  = "matched" // A rule matched without looking at the files
+)
+
+// Verdicts for a torrent
+const (
+	VerdictRemove = "remove"
+	VerdictKeep   = "keep"
+)
+
+// Steps of the decision recorded in an explanation
+const (
+	StepExclusions = "exclusions"
+	StepRule       = "rule"
+	StepFiles      = "files"
+	StepLibrary    = "library"
+	StepTrackers   = "trackers"
+	StepProtection = "protection"
+	StepVerdict    = "verdict"
+)
+
+// Step is a single step of the decision about a torrent
+type Step struct {
+	Name   string `json:"name"`
+	Result string `json:"result"`
+}
+
+// FileCheck records how a single file of a torrent was checked
+type FileCheck struct {
+	Name     string      `json:"name"`
+	Size     int64       `json:"size"`
+	Priority int         `json:"priority"`
+	Wanted   bool        `json:"wanted"`          // Files with priority 0 are not downloaded and not checked
+	Paths    []PathCheck `json:"paths,omitempty"` // Paths tried, in order, until the file was found
+	Found    string      `json:"found,omitempty"`
+}
+
+// PathCheck records the result of looking for a file at one path
+type PathCheck struct {
+	Path  string `json:"path"`
+	Found bool   `json:"found"`
+	Size  int64  `json:"size,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// Explanation describes the health of a torrent and which rule, if any, applies to it
+type Explanation struct {
+	Hash         string   `json:"hash"`
+	Name         string   `json:"name"`
+	Category     string   `json:"category"`
+	State        string   `json:"state"`
+	Status       string   `json:"status"`
+	Verdict      string   `json:"verdict"`
+	Rule         string   `json:"rule,omitempty"`
+	Action       string   `json:"action,omitempty"`
+	Reason       string   `json:"reason"`
+	MissingFiles []string `json:"missing_files,omitempty"`
+	// GraceUntil is when the grace period of the matched rule ends, if it has one
+	GraceUntil time.Time `json:"grace_until,omitzero"`
+	// Steps lists every step of the decision in order
+	Steps []Step `json:"steps"`
+	// Files lists every file of the torrent and where it was looked for, when tracing
+	Files []FileCheck `json:"files,omitempty"`
+	// Notes list conditions outside the torrent itself that affect the verdict
+	Notes []string `json:"notes,omitempty"`
+}
+
+// List checks every torrent without removing anything and returns their health
+func (c *Cleaner) List() ([]Explanation, error) {
+	torrents, err := c.Client.ListTorrents()
+	if err != nil {
+		return nil, fmt.Errorf("listing torrents failed: %w", err)
+	}
+
+	lib, err := c.loadLibrary()
+	if err != nil {
+		return nil, err
+	}
+
+	notes := c.notes()
+	// Listing never acts on torrents, so it doesn't recheck them either
+	summary := newSummary("")
+	summary.DryRun = true
+	explanations := make([]Explanation, 0, len(torrents))
+	for _, torrent := range torrents {
+		_, exp := c.check(c.logger(), summary, lib, torrent, false)
+		exp.Notes = notes
+		explanations = append(explanations, exp)
+	}
+	return explanations, nil
+}
+
+// Explain checks the torrents matching a hash, or whose name contains the query, without
+// removing anything, and traces every step of the decision
+func (c *Cleaner) Explain(query string) ([]Explanation, error) {
+	torrents, err := c.Client.ListTorrents()
+	if err != nil {
+		return nil, fmt.Errorf("listing torrents failed: %w", err)
+	}
+
+	matches := filterHashes(torrents, []string{query})
+	if len(matches) == 0 {
+		for _, torrent := range torrents {
+			if strings.Contains(strings.ToLower(torrent.Name), strings.ToLower(query)) {
+				matches = append(matches, torrent)
+			}
+		}
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no torrent matches %q", query)
+	}
+
+	lib, err := c.loadLibrary()
+	if err != nil {
+		return nil, err
+	}
+
+	notes := c.notes()
+	explanations := make([]Explanation, 0, len(matches))
+	for _, torrent := range matches {
+		summary := newSummary("")
+		summary.DryRun = true
+		_, exp := c.check(c.logger(), summary, lib, torrent, true)
+		exp.Notes = notes
+		explanations = append(explanations, exp)
+	}
+	return explanations, nil
+}
+
+// addReason appends a reason for the outcome
+func (e *Explanation) addReason(reason string) {
+	if e.Reason != "" {
+		e.Reason += ", "
+	}
+	e.Reason += reason
+}
+
+// step appends a step to the explanation
+func (e *Explanation) step(name, result string) {
+	e.Steps = append(e.Steps, Step{Name: name, Result: result})
+}
+
+// notes describes the pass-wide conditions that would stop or delay a removal
+func (c *Cleaner) notes() []string {
+	var notes []string
+	if err := c.CheckDownloadDirs(); err != nil && c.ChecksDownloadDirs() {
+		notes = append(notes, "passes abort without removing anything: "+err.Error())
+	}
+	if c.Pending != nil {
+		notes = append(notes, "stage mode is enabled, so removals wait for approval")
+	}
+	if c.MaxRemovals > 0 || c.MaxRemovalPercent > 0 {
+		notes = append(notes, "a pass aborts if it would remove more torrents than the safety limits allow")
+	}
+	return notes
+}
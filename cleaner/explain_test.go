@@ -0,0 +1,109 @@
+package cleaner
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/mallox/qbittorrent-cleaner/qbittorrent"
+)
+
+// TestList tests the health status reported for each torrent
+func TestList(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "healthy.bin", 10)
+
+	f := newFakeServer(t, []qbittorrent.Torrent{
+		{Hash: "aaa", Name: "Healthy"},
+		{Hash: "bbb", Name: "Broken"},
+		{Hash: "ccc", Name: "Downloading", AmountLeft: 100, State: "downloading"},
+		{Hash: "ddd", Name: "Excluded"},
+	}, map[string][]qbittorrent.TorrentFile{
+		"aaa": {{Name: "healthy.bin", Priority: 1}},
+		"bbb": {{Name: "gone.bin", Priority: 1}},
+		"ddd": {{Name: "gone.bin", Priority: 1}},
+	})
+	c := newTestCleaner(t, f, dir)
+	c.Exclusions, _ = LoadExclusions("")
+	c.Exclusions.Add(Exclusion{Hash: "ddd"})
+
+	explanations, err := c.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+
+	want := map[string]string{"aaa": StatusHealthy, "bbb": StatusMissing, "ccc": StatusSkipped, "ddd": StatusExcluded}
+	for _, exp := range explanations {
+		if exp.Status != want[exp.Hash] {
+			t.Errorf("Expected %s to be %s, got %s", exp.Hash, want[exp.Hash], exp.Status)
+		}
+		if (exp.Verdict == VerdictRemove) != (exp.Hash == "bbb") {
+			t.Errorf("Expected only bbb to be removed, got %s for %s", exp.Verdict, exp.Hash)
+		}
+	}
+	if len(f.removed) != 0 {
+		t.Errorf("Expected nothing to be removed, got %v", f.removed)
+	}
+}
+
+// TestExplain tests tracing the decision about a single torrent
+func TestExplain(t *testing.T) {
+	first, second := t.TempDir(), t.TempDir()
+	writeFile(t, second, "present.bin", 10)
+
+	f := newFakeServer(t, []qbittorrent.Torrent{
+		{Hash: "aaa", Name: "Broken Show"},
+		{Hash: "bbb", Name: "Other"},
+	}, map[string][]qbittorrent.TorrentFile{
+		"aaa": {{Name: "gone.bin", Priority: 1}, {Name: "skipped.bin", Priority: 0}, {Name: "present.bin", Size: 10, Priority: 1}},
+	})
+	c := newTestCleaner(t, f, first, second)
+	c.MaxRemovals = 5
+
+	explanations, err := c.Explain("AAA")
+	if err != nil {
+		t.Fatalf("Explain failed: %v", err)
+	}
+	if len(explanations) != 1 {
+		t.Fatalf("Expected 1 explanation, got %d", len(explanations))
+	}
+	exp := explanations[0]
+	if exp.Verdict != VerdictRemove || exp.Rule != RuleMissingFiles || len(exp.MissingFiles) != 1 || exp.MissingFiles[0] != "gone.bin" {
+		t.Errorf("Expected removal for missing gone.bin, got %+v", exp)
+	}
+	if len(exp.Notes) != 1 {
+		t.Errorf("Expected a note about the safety limits, got %v", exp.Notes)
+	}
+
+	var steps []string
+	for _, step := range exp.Steps {
+		steps = append(steps, step.Name)
+	}
+	if want := []string{StepExclusions, StepFiles, StepRule, StepVerdict}; !slices.Equal(steps, want) {
+		t.Errorf("Expected steps %v, got %v", want, steps)
+	}
+
+	if len(exp.Files) != 3 {
+		t.Fatalf("Expected 3 traced files, got %d", len(exp.Files))
+	}
+	gone, skipped, present := exp.Files[0], exp.Files[1], exp.Files[2]
+	if len(gone.Paths) != 2 || gone.Paths[0].Found || gone.Paths[0].Error == "" || gone.Found != "" {
+		t.Errorf("Expected gone.bin to be looked for in both directories, got %+v", gone)
+	}
+	if skipped.Wanted || len(skipped.Paths) != 0 {
+		t.Errorf("Expected skipped.bin not to be looked for, got %+v", skipped)
+	}
+	if len(present.Paths) != 2 || !present.Paths[1].Found || present.Paths[1].Size != 10 || present.Found != filepath.Join(second, "present.bin") {
+		t.Errorf("Expected present.bin to be found in the second directory, got %+v", present)
+	}
+
+	// Names match case-insensitively when no hash does
+	explanations, err = c.Explain("broken")
+	if err != nil || len(explanations) != 1 || explanations[0].Hash != "aaa" {
+		t.Errorf("Expected the name to match aaa, got %v, %v", explanations, err)
+	}
+
+	if _, err := c.Explain("unknown"); err == nil {
+		t.Errorf("Expected an error for an unknown torrent")
+	}
+}
@@ -0,0 +1,94 @@
+package cleaner
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/mallox/qbittorrent-cleaner/qbittorrent"
+)
+
+// library indexes the files of the media library by size, so that payloads can be
+// found there even after a media manager renamed them
+type library struct {
+	bySize map[int64][]string
+}
+
+// loadLibrary indexes every file below the library directories
+func loadLibrary(dirs []string) (*library, error) {
+	lib := &library{bySize: map[int64][]string{}}
+	for _, dir := range dirs {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			lib.bySize[info.Size()] = append(lib.bySize[info.Size()], path)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("indexing media library %s failed: %w", dir, err)
+		}
+	}
+	return lib, nil
+}
+
+// find returns where a payload file is in the library, or an empty string. A library file
+// of the same size matches if it has the same name, or if it is a hardlink of the payload
+// file found at path.
+func (l *library) find(name string, size int64, path string) string {
+	var info os.FileInfo
+	if path != "" {
+		info, _ = os.Stat(path)
+	}
+
+	for _, candidate := range l.bySize[size] {
+		if filepath.Base(candidate) == filepath.Base(name) {
+			return candidate
+		}
+		if info == nil {
+			continue
+		}
+		if other, err := os.Stat(candidate); err == nil && os.SameFile(info, other) {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// payload returns the largest wanted file of a torrent, which is the one a media manager
+// imports, and whether there is one
+func payload(files []qbittorrent.TorrentFile) (qbittorrent.TorrentFile, bool) {
+	var largest qbittorrent.TorrentFile
+	found := false
+	for _, file := range files {
+		if file.Priority != 0 && (!found || file.Size > largest.Size) {
+			largest, found = file, true
+		}
+	}
+	return largest, found
+}
+
+// checkLibrary reports whether the payload of a torrent is in the library. The check is recorded in exp.
+func (c *Cleaner) checkLibrary(lib *library, files []qbittorrent.TorrentFile, exp *Explanation) bool {
+	file, ok := payload(files)
+	if !ok {
+		exp.step(StepLibrary, "no wanted files")
+		return false
+	}
+
+	found, _ := c.locate(file.Name, false)
+	if where := lib.find(file.Name, file.Size, found); where != "" {
+		exp.step(StepLibrary, fmt.Sprintf("%s found in the library at %s", file.Name, where))
+		return true
+	}
+	exp.step(StepLibrary, fmt.Sprintf("%s not found in the library", file.Name))
+	return false
+}
@@ -0,0 +1,100 @@
+package cleaner
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/mallox/qbittorrent-cleaner/qbittorrent"
+	"github.com/mallox/qbittorrent-cleaner/rules"
+)
+
+// TestRunSeedingGoals tests retiring torrents that met their seeding goal once their payload is in the library
+func TestRunSeedingGoals(t *testing.T) {
+	downloads, media := t.TempDir(), t.TempDir()
+	writeFile(t, downloads, "linked/show.mkv", 100)
+	writeFile(t, downloads, "linked/show.nfo", 1)
+	writeFile(t, downloads, "renamed/movie.mkv", 200)
+	writeFile(t, downloads, "unimported/other.mkv", 300)
+	writeFile(t, downloads, "seeding/more.mkv", 400)
+
+	// A hardlink under a new name, as media managers create them, and a copy with the same name
+	os.MkdirAll(filepath.Join(media, "Show"), 0o755)
+	if err := os.Link(filepath.Join(downloads, "linked/show.mkv"), filepath.Join(media, "Show", "Show - S01E01.mkv")); err != nil {
+		t.Skipf("Hardlinks are not supported: %v", err)
+	}
+	writeFile(t, media, "Movie (2024)/movie.mkv", 200)
+	writeFile(t, media, "Other/other - renamed.mkv", 300)
+
+	f := newFakeServer(t, []qbittorrent.Torrent{
+		{Hash: "aaa", Name: "Linked", Category: "tv", Ratio: 2},
+		{Hash: "bbb", Name: "Renamed", Category: "movies", SeedingTime: 15 * 86400},
+		{Hash: "ccc", Name: "Unimported", Category: "movies", Ratio: 5},
+		{Hash: "ddd", Name: "Seeding", Category: "tv", Ratio: 0.5},
+	}, map[string][]qbittorrent.TorrentFile{
+		"aaa": {{Name: "linked/show.mkv", Size: 100, Priority: 1}, {Name: "linked/show.nfo", Size: 1, Priority: 1}},
+		"bbb": {{Name: "renamed/movie.mkv", Size: 200, Priority: 1}},
+		"ccc": {{Name: "unimported/other.mkv", Size: 300, Priority: 1}},
+		"ddd": {{Name: "seeding/more.mkv", Size: 400, Priority: 1}},
+	})
+
+	c := newTestCleaner(t, f, downloads)
+	c.LibraryDirs = []string{media}
+	var err error
+	c.Rules, err = rules.Parse([]byte(`[
+		{"name": "tv-goal", "match": {"category": ["tv"], "goal": {"ratio": 1, "seeding_time": "7d"}, "in_library": true}, "action": "delete"},
+		{"name": "movies-goal", "match": {"category": ["movies"], "goal": {"ratio": 2, "seeding_time": "14d"}, "in_library": true}, "action": "delete"}
+	]`))
+	if err != nil {
+		t.Fatalf("Failed to parse rules: %v", err)
+	}
+
+	summary, err := c.Run(Options{})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if !slices.Equal(f.removed, []string{"aaa", "bbb"}) {
+		t.Errorf("Expected aaa and bbb to be removed, got %v", f.removed)
+	}
+	if summary.Checked != 2 || summary.Skipped != 2 {
+		t.Errorf("Unexpected counts: %+v", summary.Counts)
+	}
+
+	explanations, err := c.Explain("ccc")
+	if err != nil {
+		t.Fatalf("Explain failed: %v", err)
+	}
+	var steps []string
+	for _, step := range explanations[0].Steps {
+		steps = append(steps, step.Name+": "+step.Result)
+	}
+	want := []string{
+		"exclusions: not excluded",
+		`rule: tv-goal: no match, category "movies" is not one of tv`,
+		"library: unimported/other.mkv not found in the library",
+		"rule: movies-goal: no match, the payload is not in the library",
+		"verdict: keep, no rule matches",
+	}
+	if !slices.Equal(steps, want) {
+		t.Errorf("Expected steps %q, got %q", want, steps)
+	}
+}
+
+// TestRunLibraryUnavailable tests that a pass aborts when the media library can't be read
+func TestRunLibraryUnavailable(t *testing.T) {
+	f := newFakeServer(t, []qbittorrent.Torrent{{Hash: "aaa", Name: "Seeded", Ratio: 2}}, nil)
+
+	c := newTestCleaner(t, f)
+	c.LibraryDirs = []string{filepath.Join(t.TempDir(), "unmounted")}
+	c.Rules, _ = rules.Parse([]byte(`[{"name": "goal", "match": {"goal": {"ratio": 1}, "in_library": true}, "action": "delete"}]`))
+
+	summary, err := c.Run(Options{})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if !summary.Aborted || len(f.removed) != 0 {
+		t.Errorf("Expected the pass to abort without removing anything, got %+v", summary)
+	}
+}
@@ -0,0 +1,76 @@
+package cleaner
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// incompleteSuffix is appended by qBittorrent to files that are still downloading
+const incompleteSuffix = ".!qB"
+
+// Orphan is a file in a download directory that no torrent references
+type Orphan struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Orphans lists the files in the download directories that don't belong to any torrent.
+// It fails if the files of any torrent can't be listed, since they would all look orphaned.
+func (c *Cleaner) Orphans() ([]Orphan, error) {
+	if err := c.CheckDownloadDirs(); err != nil {
+		return nil, err
+	}
+
+	torrents, err := c.Client.ListTorrents()
+	if err != nil {
+		return nil, fmt.Errorf("listing torrents failed: %w", err)
+	}
+
+	// Collect the files of every torrent, including incomplete ones
+	known := map[string]bool{}
+	for _, torrent := range torrents {
+		files, err := c.Client.TorrentFiles(torrent.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("getting files for torrent %s failed: %w", torrent.Hash, err)
+		}
+		for _, file := range files {
+			known[filepath.ToSlash(filepath.Clean(file.Name))] = true
+		}
+	}
+
+	orphans := []Orphan{}
+	for _, dir := range c.DownloadDirs {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			if known[strings.TrimSuffix(filepath.ToSlash(rel), incompleteSuffix)] {
+				return nil
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			orphans = append(orphans, Orphan{Path: path, Size: info.Size(), ModTime: info.ModTime()})
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("scanning download directory %s failed: %w", dir, err)
+		}
+	}
+
+	return orphans, nil
+}
@@ -0,0 +1,51 @@
+package cleaner
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/mallox/qbittorrent-cleaner/qbittorrent"
+)
+
+// TestOrphans tests finding files that no torrent references
+func TestOrphans(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "movie/movie.mkv", 10)
+	writeFile(t, dir, "downloading/part.bin.!qB", 5)
+	writeFile(t, dir, "movie/sample.mkv", 3)
+	writeFile(t, dir, "leftover.iso", 7)
+
+	f := newFakeServer(t, []qbittorrent.Torrent{
+		{Hash: "aaa", Name: "Movie"},
+		{Hash: "bbb", Name: "Downloading", AmountLeft: 100},
+	}, map[string][]qbittorrent.TorrentFile{
+		"aaa": {{Name: "movie/movie.mkv", Priority: 1}},
+		"bbb": {{Name: "downloading/part.bin", Priority: 1}},
+	})
+	c := newTestCleaner(t, f, dir)
+
+	orphans, err := c.Orphans()
+	if err != nil {
+		t.Fatalf("Orphans failed: %v", err)
+	}
+
+	want := map[string]int64{
+		filepath.Join(dir, "leftover.iso"):     7,
+		filepath.Join(dir, "movie/sample.mkv"): 3,
+	}
+	if len(orphans) != len(want) {
+		t.Fatalf("Expected %d orphans, got %+v", len(want), orphans)
+	}
+	for _, orphan := range orphans {
+		if size, ok := want[orphan.Path]; !ok || size != orphan.Size {
+			t.Errorf("Unexpected orphan %+v", orphan)
+		}
+	}
+
+	// Unknown torrent files must not turn every file into an orphan
+	f.failures["/api/v2/torrents/files"] = http.StatusInternalServerError
+	if _, err := c.Orphans(); err == nil {
+		t.Errorf("Expected an error when torrent files can't be listed")
+	}
+}
@@ -0,0 +1,26 @@
+package cleaner
+
+import (
+	"github.com/mallox/qbittorrent-cleaner/qbittorrent"
+	"github.com/mallox/qbittorrent-cleaner/rules"
+)
+
+// DefaultProtectedTag is the tag added to torrents with missing files that hit-and-run
+// protection kept from being removed
+const DefaultProtectedTag = "hnr-protected"
+
+// protection returns the first protection whose requirements the torrent hasn't met yet on
+// any of its trackers, along with that tracker's host, or nil if the torrent may be removed.
+// Every tracker counts, not only the one currently working.
+func (c *Cleaner) protection(torrent qbittorrent.Torrent, trackers []qbittorrent.Tracker) (*rules.Protection, string) {
+	for _, tracker := range trackers {
+		host := tracker.Host()
+		for i := range c.Protections {
+			p := &c.Protections[i]
+			if p.Covers(host) && !p.Satisfied(torrent) {
+				return p, host
+			}
+		}
+	}
+	return nil, ""
+}
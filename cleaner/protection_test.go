@@ -0,0 +1,96 @@
+package cleaner
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/mallox/qbittorrent-cleaner/qbittorrent"
+	"github.com/mallox/qbittorrent-cleaner/rules"
+)
+
+// TestRunProtection tests that hit-and-run protection vetoes removals until the seeding requirements are met
+func TestRunProtection(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "old/file.bin", 10)
+
+	day := int64(86400)
+	private := []qbittorrent.Tracker{{URL: "** [DHT] **"}, {URL: "https://tracker.private.example.org/announce"}}
+	f := newFakeServer(t, []qbittorrent.Torrent{
+		{Hash: "aaa", Name: "Young", SeedingTime: day, Ratio: 0.2},
+		{Hash: "bbb", Name: "Seeded", SeedingTime: 5 * day, Ratio: 0.2},
+		{Hash: "ccc", Name: "Public", SeedingTime: day},
+		{Hash: "ddd", Name: "Old", Category: "old", SeedingTime: day},
+		{Hash: "eee", Name: "Tagged", SeedingTime: day, Tags: "hnr-protected"},
+	}, map[string][]qbittorrent.TorrentFile{
+		"aaa": {{Name: "young/gone.bin", Size: 10, Priority: 1}},
+		"bbb": {{Name: "seeded/gone.bin", Size: 10, Priority: 1}},
+		"ccc": {{Name: "public/gone.bin", Size: 10, Priority: 1}},
+		"ddd": {{Name: "old/file.bin", Size: 10, Priority: 1}},
+		"eee": {{Name: "tagged/gone.bin", Size: 10, Priority: 1}},
+	})
+	f.trackers = map[string][]qbittorrent.Tracker{
+		"aaa": private,
+		"bbb": private,
+		"ccc": {{URL: "udp://tracker.public.example.com:1337/announce"}},
+		"ddd": private,
+		"eee": private,
+	}
+
+	c := newTestCleaner(t, f, dir)
+	var err error
+	c.Rules, err = rules.Parse([]byte(`[
+		{"name": "old", "match": {"category": ["old"]}, "action": "delete"},
+		{"name": "missing-files", "match": {"complete": true, "missing_files": true}, "action": "delete"}
+	]`))
+	if err != nil {
+		t.Fatalf("Failed to parse rules: %v", err)
+	}
+	c.Protections, err = rules.ParseProtections([]byte(`[{"tracker": ["private.example.org"], "min_seeding_time": "3d", "min_ratio": 1}]`))
+	if err != nil {
+		t.Fatalf("Failed to parse protections: %v", err)
+	}
+
+	summary, err := c.Run(Options{})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if !slices.Equal(f.removed, []string{"bbb", "ccc"}) {
+		t.Errorf("Expected bbb and ccc to be removed, got %v", f.removed)
+	}
+	if !slices.Equal(f.tagged, []string{"aaa:hnr-protected"}) {
+		t.Errorf("Expected aaa to be tagged, got %v", f.tagged)
+	}
+	if len(summary.Actions) != 1 || summary.Actions[0].Rule != RuleHitAndRun || len(summary.Actions[0].MissingFiles) != 1 {
+		t.Errorf("Expected the protected torrent to be reported, got %+v", summary.Actions)
+	}
+
+	explanations, err := c.Explain("ddd")
+	if err != nil {
+		t.Fatalf("Explain failed: %v", err)
+	}
+	exp := explanations[0]
+	want := Step{Name: StepProtection, Result: "tracker.private.example.org requires seeding time 24h0m0s of 72h0m0s or ratio 0.00 of 1.00"}
+	if exp.Verdict != VerdictKeep || !slices.Contains(exp.Steps, want) {
+		t.Errorf("Expected the torrent to be kept by protection, got %+v", exp)
+	}
+}
+
+// TestRunProtectionTrackersFailed tests that torrents whose trackers can't be listed are kept
+func TestRunProtectionTrackersFailed(t *testing.T) {
+	f := newFakeServer(t, []qbittorrent.Torrent{{Hash: "aaa", Name: "Broken"}}, map[string][]qbittorrent.TorrentFile{
+		"aaa": {{Name: "gone.bin", Size: 10, Priority: 1}},
+	})
+	f.failures["/api/v2/torrents/trackers"] = 500
+
+	c := newTestCleaner(t, f, t.TempDir())
+	c.Protections, _ = rules.ParseProtections([]byte(`[{"tracker": ["example.org"], "min_ratio": 1}]`))
+
+	summary, err := c.Run(Options{})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(f.removed) != 0 || summary.Failed != 1 || summary.Failures[0].Stage != StageTrackers {
+		t.Errorf("Expected the torrent to be kept and the failure recorded, got removed %v, %+v", f.removed, summary.Failures)
+	}
+}
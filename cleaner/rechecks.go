@@ -0,0 +1,256 @@
+package cleaner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mallox/qbittorrent-cleaner/atomicfile"
+	"github.com/mallox/qbittorrent-cleaner/qbittorrent"
+)
+
+// Defaults for throttling rechecks in VerifyRecheck mode
+const (
+	DefaultRecheckBatch    = 5
+	DefaultRecheckMax      = 20
+	DefaultRecheckInterval = 7 * 24 * time.Hour
+)
+
+// Rechecks remembers when each torrent was last rechecked, so that passes work through
+// the library a few torrents at a time. It is optionally persisted to a JSON file.
+type Rechecks struct {
+	path string
+
+	mu      sync.Mutex
+	entries map[string]time.Time
+}
+
+// LoadRechecks reads the recheck times stored at path. A missing file yields an empty
+// set, and an empty path keeps them in memory only.
+func LoadRechecks(path string) (*Rechecks, error) {
+	r := &Rechecks{path: path, entries: map[string]time.Time{}}
+	if path == "" {
+		return r, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading rechecks failed: %w", err)
+	}
+	if err := json.Unmarshal(data, &r.entries); err != nil {
+		return nil, fmt.Errorf("parsing rechecks failed: %w", err)
+	}
+	return r, nil
+}
+
+// Last returns when a torrent was last rechecked, or the zero time if never. A nil set
+// has never rechecked anything.
+func (r *Rechecks) Last(hash string) time.Time {
+	if r == nil {
+		return time.Time{}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.entries[strings.ToLower(hash)]
+}
+
+// Record notes that torrents were rechecked. With present set, torrents that are no longer
+// in it are forgotten.
+func (r *Rechecks) Record(hashes []string, now time.Time, present []string) error {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, hash := range hashes {
+		r.entries[strings.ToLower(hash)] = now
+	}
+	if present != nil {
+		keep := map[string]bool{}
+		for _, hash := range present {
+			keep[strings.ToLower(hash)] = true
+		}
+		for hash := range r.entries {
+			if !keep[hash] {
+				delete(r.entries, hash)
+			}
+		}
+	}
+	return r.save()
+}
+
+// save writes the recheck times to the file, replacing it atomically. The lock must be held.
+func (r *Rechecks) save() error {
+	if r.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(r.entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling rechecks failed: %w", err)
+	}
+
+	if err := atomicfile.WriteFile(r.path, data, 0o644); err != nil {
+		return fmt.Errorf("writing rechecks failed: %w", err)
+	}
+	return nil
+}
+
+// recheckDue rechecks the torrents that a rule could look for missing files in, starting
+// with those rechecked longest ago and skipping those rechecked within RecheckInterval. At
+// most RecheckMax torrents are rechecked, RecheckBatch at a time, so qBittorrent never
+// verifies the whole library at once. It returns the lowercase hashes of the torrents that
+// were rechecked. With prune set, torrents that are gone are forgotten.
+//
+// Rules are still checked against the torrents as they were before the recheck, since a
+// torrent whose data is gone has data left to download afterwards and would no longer
+// count as complete.
+func (c *Cleaner) recheckDue(logger *slog.Logger, summary *Summary, torrents []qbittorrent.Torrent, prune bool) map[string]bool {
+	now := time.Now()
+	interval := c.RecheckInterval
+	if interval <= 0 {
+		interval = DefaultRecheckInterval
+	}
+
+	var due []qbittorrent.Torrent
+	for _, torrent := range torrents {
+		if c.Exclusions.Excluded(torrent.Hash) || !c.mayCheckFiles(torrent, now) {
+			continue
+		}
+		if last := c.Rechecks.Last(torrent.Hash); last.IsZero() || now.Sub(last) >= interval {
+			due = append(due, torrent)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool {
+		return c.Rechecks.Last(due[i].Hash).Before(c.Rechecks.Last(due[j].Hash))
+	})
+
+	limit := c.RecheckMax
+	if limit <= 0 {
+		limit = DefaultRecheckMax
+	}
+	if len(due) > limit {
+		logger.Info("Rechecking some of the torrents that are due", "due", len(due), "rechecking", limit)
+		due = due[:limit]
+	}
+
+	batch := c.RecheckBatch
+	if batch <= 0 {
+		batch = DefaultRecheckBatch
+	}
+	rechecked := map[string]bool{}
+	for start := 0; start < len(due); start += batch {
+		var hashes []string
+		for _, torrent := range due[start:min(start+batch, len(due))] {
+			hashes = append(hashes, torrent.Hash)
+		}
+
+		logger.Info("Rechecking torrents", "count", len(hashes))
+		result, err := c.recheck(hashes)
+		if err != nil {
+			logger.Error("Failed to recheck torrents", "error", err)
+			for _, torrent := range due[start:min(start+batch, len(due))] {
+				c.fail(summary, torrent, StageFiles, fmt.Errorf("recheck failed: %w", err))
+			}
+			continue
+		}
+		var done []string
+		for hash := range result {
+			rechecked[hash] = true
+			done = append(done, hash)
+		}
+		if err := c.Rechecks.Record(done, time.Now(), nil); err != nil {
+			logger.Error("Failed to save rechecks", "error", err)
+		}
+	}
+
+	if prune {
+		var present []string
+		for _, torrent := range torrents {
+			present = append(present, torrent.Hash)
+		}
+		if err := c.Rechecks.Record(nil, time.Now(), present); err != nil {
+			logger.Error("Failed to save rechecks", "error", err)
+		}
+	}
+	return rechecked
+}
+
+// mayCheckFiles reports whether a rule that looks for missing files could match the
+// torrent, going by its other conditions
+func (c *Cleaner) mayCheckFiles(torrent qbittorrent.Torrent, now time.Time) bool {
+	for i := range c.Rules {
+		rule := &c.Rules[i]
+		if ok, _ := rule.Check(torrent, now); ok && rule.ChecksFiles() {
+			return true
+		}
+	}
+	return false
+}
+
+// unverified describes why the files of a torrent that wasn't rechecked in this pass can't be judged
+func (c *Cleaner) unverified(torrent qbittorrent.Torrent, dryRun bool) string {
+	last := c.Rechecks.Last(torrent.Hash)
+	switch {
+	case dryRun:
+		return "files are only verified by a pass that rechecks the torrent"
+	case last.IsZero():
+		return "not rechecked yet, a later pass rechecks it"
+	default:
+		return "not rechecked in this pass, last rechecked at " + last.Format(time.RFC3339)
+	}
+}
+
+// checkProgress decides which wanted files of a torrent are missing from their progress
+// after a recheck, and returns those and the size of the others. Only files without any
+// verified data count as missing: a single bad piece, or a piece shared with a skipped
+// file, leaves a file incomplete, and such a torrent should be repaired rather than
+// removed. The check is recorded in exp.
+func (c *Cleaner) checkProgress(log *slog.Logger, files []qbittorrent.TorrentFile, trace bool, exp *Explanation) ([]string, int64) {
+	var missingFiles []string
+	var presentSize int64
+	var wanted, incomplete int
+	for _, file := range files {
+		if trace {
+			fc := FileCheck{Name: file.Name, Size: file.Size, Priority: file.Priority, Wanted: file.Priority != 0}
+			switch {
+			case file.Priority == 0 || file.Progress <= 0:
+			case file.Progress >= 1:
+				fc.Found = "verified by qBittorrent"
+			default:
+				fc.Found = fmt.Sprintf("%.1f%% verified by qBittorrent", file.Progress*100)
+			}
+			exp.Files = append(exp.Files, fc)
+		}
+		if file.Priority == 0 {
+			continue
+		}
+		wanted++
+		if file.Progress <= 0 {
+			log.Info("File is missing", "file", file.Name)
+			missingFiles = append(missingFiles, file.Name)
+			continue
+		}
+		if file.Progress < 1 {
+			incomplete++
+			log.Warn("File is incomplete after the recheck", "file", file.Name, "progress", file.Progress)
+		}
+		presentSize += file.Size
+	}
+	exp.step(StepFiles, fmt.Sprintf("%d of %d files wanted, %d missing and %d incomplete after the recheck", wanted, len(files), len(missingFiles), incomplete))
+
+	return missingFiles, presentSize
+}
@@ -0,0 +1,87 @@
+package cleaner
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mallox/qbittorrent-cleaner/qbittorrent"
+)
+
+// TestRunVerifyRecheck tests rechecking torrents a few at a time and going by the progress of their files
+func TestRunVerifyRecheck(t *testing.T) {
+	f := newFakeServer(t, []qbittorrent.Torrent{
+		{Hash: "aaa", Name: "Healthy", State: "stalledUP", Size: 100},
+		{Hash: "bbb", Name: "Broken", State: "stalledUP", Size: 100},
+		{Hash: "ccc", Name: "Recent", State: "stalledUP", Size: 100},
+		{Hash: "ddd", Name: "Old", State: "stalledUP", Size: 100},
+		{Hash: "eee", Name: "Downloading", State: "downloading", Size: 100, AmountLeft: 50},
+	}, map[string][]qbittorrent.TorrentFile{
+		// A file with a bad piece is incomplete, but not missing
+		"aaa": {{Name: "healthy.bin", Size: 60, Priority: 1, Progress: 1}, {Name: "damaged.bin", Size: 40, Priority: 1, Progress: 0.97}},
+		"bbb": {{Name: "present.bin", Size: 60, Priority: 1, Progress: 1}, {Name: "gone.bin", Size: 40, Priority: 1}, {Name: "skipped.bin", Size: 10}},
+		"ccc": {{Name: "recent.bin", Size: 100, Priority: 1, Progress: 0}},
+		"ddd": {{Name: "old.bin", Size: 100, Priority: 1, Progress: 1}},
+	})
+
+	path := filepath.Join(t.TempDir(), "rechecks.json")
+	now := time.Now()
+	earlier := &Rechecks{path: path, entries: map[string]time.Time{
+		"ccc": now.Add(-24 * time.Hour),
+		"ddd": now.Add(-8 * 24 * time.Hour),
+		"zzz": now.Add(-8 * 24 * time.Hour),
+	}}
+	if err := earlier.save(); err != nil {
+		t.Fatalf("Failed to save rechecks: %v", err)
+	}
+
+	// After the recheck, qBittorrent wants to download what is missing again
+	f.afterRecheck = map[string]qbittorrent.Torrent{
+		"bbb": {Hash: "bbb", Name: "Broken", State: "downloading", Size: 100, AmountLeft: 40},
+	}
+
+	c := newTestCleaner(t, f)
+	c.Rechecks, _ = LoadRechecks(path)
+	c.Verify, c.PollInterval, c.RecheckMax, c.RecheckBatch = VerifyRecheck, time.Millisecond, 2, 1
+
+	// A dry run never rechecks and can't judge the files
+	summary, err := c.Run(Options{DryRun: true})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(f.rechecked) != 0 || len(summary.Candidates) != 0 {
+		t.Errorf("Expected a dry run to recheck nothing, got %v, %+v", f.rechecked, summary.Candidates)
+	}
+
+	summary, err = c.Run(Options{})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if !slices.Equal(f.rechecked, []string{"aaa", "bbb"}) {
+		t.Errorf("Expected the two torrents never rechecked to be rechecked, got %v", f.rechecked)
+	}
+	if !slices.Equal(f.removed, []string{"bbb"}) || summary.BytesReclaimed != 60 {
+		t.Errorf("Expected bbb to be removed with its 60 present bytes, got %v, %d", f.removed, summary.BytesReclaimed)
+	}
+	if summary.Checked != 2 || summary.Missing != 1 || summary.Healthy != 1 || summary.Skipped != 3 {
+		t.Errorf("Unexpected counts: %+v", summary.Counts)
+	}
+
+	// The next pass moves on to the torrent rechecked longest ago
+	f.rechecked, f.removed = nil, nil
+	if _, err := c.Run(Options{}); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if !slices.Equal(f.rechecked, []string{"ddd"}) || len(f.removed) != 0 {
+		t.Errorf("Expected only ddd to be rechecked and nothing removed, got %v, removed %v", f.rechecked, f.removed)
+	}
+
+	loaded, err := LoadRechecks(path)
+	if err != nil {
+		t.Fatalf("LoadRechecks failed: %v", err)
+	}
+	if loaded.Last("AAA").IsZero() || !loaded.Last("zzz").IsZero() || loaded.Last("ddd").Before(now) {
+		t.Errorf("Expected the recheck times to be persisted and gone torrents forgotten, got %+v", loaded.entries)
+	}
+}
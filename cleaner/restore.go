@@ -0,0 +1,57 @@
+package cleaner
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/mallox/qbittorrent-cleaner/journal"
+	"github.com/mallox/qbittorrent-cleaner/qbittorrent"
+)
+
+// ActionRestore is recorded in the journal when a removed torrent is added back
+const ActionRestore = "restore"
+
+// Restore adds a removed torrent back to qBittorrent from its backed up .torrent file,
+// using the save path and category recorded when it was removed. The torrent is added
+// paused unless start is set, since its files are usually still missing.
+func (c *Cleaner) Restore(removed journal.Entry, start bool) error {
+	if c.BackupDir == "" {
+		return errors.New("no backup directory configured")
+	}
+
+	entry := journal.Entry{
+		RunID:    removed.RunID,
+		Hash:     removed.Hash,
+		Name:     removed.Name,
+		Category: removed.Category,
+		SavePath: removed.SavePath,
+		Rule:     removed.Rule,
+		Action:   ActionRestore,
+		Outcome:  journal.OutcomeSuccess,
+	}
+
+	err := c.restore(removed, start)
+	if err != nil {
+		entry.Outcome = journal.OutcomeFailed
+		entry.Error = err.Error()
+	}
+	if jerr := c.Journal.Append(entry); jerr != nil {
+		c.logger().Error("Failed to write journal entry", "hash", removed.Hash, "error", jerr)
+	}
+	return err
+}
+
+// restore reads the backup of a torrent and adds it
+func (c *Cleaner) restore(removed journal.Entry, start bool) error {
+	data, err := os.ReadFile(BackupPath(c.BackupDir, removed.Hash))
+	if err != nil {
+		return fmt.Errorf("reading torrent backup failed: %w", err)
+	}
+
+	return c.Client.AddTorrent(data, qbittorrent.AddOptions{
+		SavePath: removed.SavePath,
+		Category: removed.Category,
+		Paused:   !start,
+	})
+}
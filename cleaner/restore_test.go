@@ -0,0 +1,59 @@
+package cleaner
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/mallox/qbittorrent-cleaner/journal"
+	"github.com/mallox/qbittorrent-cleaner/qbittorrent"
+)
+
+// TestBackupAndRestore tests that removed torrents are backed up and can be added back
+func TestBackupAndRestore(t *testing.T) {
+	f := newFakeServer(t, []qbittorrent.Torrent{
+		{Hash: "AAA", Name: "Broken", Category: "tv", SavePath: "/downloads/tv"},
+	}, map[string][]qbittorrent.TorrentFile{
+		"AAA": {{Name: "gone.bin", Priority: 1}},
+	})
+	c := newTestCleaner(t, f, t.TempDir())
+	c.BackupDir = t.TempDir()
+
+	journalPath := filepath.Join(t.TempDir(), "journal.jsonl")
+	j, err := journal.Open(journalPath)
+	if err != nil {
+		t.Fatalf("Failed to open journal: %v", err)
+	}
+	c.Journal = j
+
+	if _, err := c.Run(Options{}); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	j.Close()
+
+	entries, err := journal.Read(journalPath, journal.Filter{})
+	if err != nil || len(entries) != 1 || entries[0].Category != "tv" {
+		t.Fatalf("Expected removal with category in the journal, got %+v %v", entries, err)
+	}
+
+	j, _ = journal.Open(journalPath)
+	c.Journal = j
+	if err := c.Restore(entries[0], false); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	j.Close()
+
+	if len(f.added) != 1 || f.added[0] != "torrent:AAA@/downloads/tv/tv" {
+		t.Errorf("Expected backed up torrent to be added to its save path and category, got %v", f.added)
+	}
+
+	entries, _ = journal.Read(journalPath, journal.Filter{})
+	if len(entries) != 2 || entries[1].Action != ActionRestore || entries[1].Outcome != journal.OutcomeSuccess {
+		t.Errorf("Expected successful restore in the journal, got %+v", entries)
+	}
+
+	// Without a backup the torrent can't be restored
+	c.BackupDir = t.TempDir()
+	if err := c.Restore(entries[0], false); err == nil {
+		t.Errorf("Expected restore without a backup to fail")
+	}
+}
@@ -0,0 +1,122 @@
+package cleaner
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mallox/qbittorrent-cleaner/qbittorrent"
+	"github.com/mallox/qbittorrent-cleaner/rules"
+)
+
+// TestRunRules tests that the first matching rule applies to each torrent
+func TestRunRules(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "seeded/file.bin", 10)
+
+	f := newFakeServer(t, []qbittorrent.Torrent{
+		{Hash: "aaa", Name: "Seeded", Category: "linux", Ratio: 3, Size: 10},
+		{Hash: "bbb", Name: "Broken", Category: "linux", Ratio: 3},
+		{Hash: "ccc", Name: "Stalled", AmountLeft: 10, State: "stalledDL"},
+		{Hash: "ddd", Name: "Tagged", AmountLeft: 10, State: "stalledDL", Tags: "stalled"},
+		{Hash: "eee", Name: "Sample", Category: "tv"},
+	}, map[string][]qbittorrent.TorrentFile{
+		"aaa": {{Name: "seeded/file.bin", Size: 10, Priority: 1}},
+		"bbb": {{Name: "broken/gone.bin", Priority: 1}},
+	})
+
+	c := newTestCleaner(t, f, dir)
+	var err error
+	c.Rules, err = rules.Parse([]byte(`[
+		{"name": "missing-files", "match": {"complete": true, "missing_files": true}, "action": "delete"},
+		{"name": "seeded", "match": {"category": ["linux"], "min_ratio": 2}, "action": "delete-keep-data"},
+		{"name": "stalled", "match": {"state": ["stalledDL"]}, "action": "tag", "tags": ["stalled"]},
+		{"name": "samples", "match": {"name": "(?i)sample"}, "action": "pause"}
+	]`))
+	if err != nil {
+		t.Fatalf("Failed to parse rules: %v", err)
+	}
+
+	summary, err := c.Run(Options{})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if !slices.Equal(f.removed, []string{"aaa", "bbb"}) || !slices.Equal(f.keptData, []string{"aaa"}) {
+		t.Errorf("Expected bbb to be deleted and aaa removed keeping its data, got %v removed, %v kept", f.removed, f.keptData)
+	}
+	if !slices.Equal(f.tagged, []string{"ccc:stalled"}) {
+		t.Errorf("Expected only ccc to be tagged, got %v", f.tagged)
+	}
+	if !slices.Equal(f.paused, []string{"eee"}) {
+		t.Errorf("Expected eee to be paused, got %v", f.paused)
+	}
+	if len(summary.Actions) != 2 || summary.Actions[0].Action != ActionTag || summary.Actions[1].Rule != "samples" {
+		t.Errorf("Unexpected actions: %+v", summary.Actions)
+	}
+	if summary.Removals[0].Rule != "seeded" || !summary.Removals[0].KeepData || summary.Removals[0].Action != ActionDeleteKeepData {
+		t.Errorf("Unexpected removal: %+v", summary.Removals[0])
+	}
+	if summary.BytesReclaimed != 0 {
+		t.Errorf("Expected nothing reclaimed, got %d", summary.BytesReclaimed)
+	}
+
+	// Dry runs report the actions without applying them
+	f.tagged, f.paused = nil, nil
+	summary, _ = c.Run(Options{DryRun: true})
+	if len(summary.Actions) != 2 || len(f.tagged) != 0 || len(f.paused) != 0 {
+		t.Errorf("Expected 2 actions reported and none applied, got %d reported, %v tagged, %v paused", len(summary.Actions), f.tagged, f.paused)
+	}
+}
+
+// TestRunRulesWithoutFiles tests that download directories are not needed when no rule checks files
+func TestRunRulesWithoutFiles(t *testing.T) {
+	f := newFakeServer(t, []qbittorrent.Torrent{{Hash: "aaa", Name: "Old", Ratio: 1}}, nil)
+
+	c := newTestCleaner(t, f, "/nonexistent")
+	c.Rules, _ = rules.Parse([]byte(`[{"name": "notify", "match": {"min_ratio": 1}, "action": "notify"}]`))
+
+	summary, err := c.Run(Options{})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if summary.Aborted || summary.Checked != 1 || len(summary.Actions) != 1 || summary.Actions[0].Action != rules.ActionNotify {
+		t.Errorf("Expected aaa to be reported, got %+v", summary)
+	}
+}
+
+// TestRunStalled tests removing dead incomplete torrents with their partial data and tagging stalled ones
+func TestRunStalled(t *testing.T) {
+	now := time.Now()
+	week := now.Add(-7 * 24 * time.Hour).Unix()
+	f := newFakeServer(t, []qbittorrent.Torrent{
+		{Hash: "aaa", Name: "Dead", State: "stalledDL", Size: 1000, AmountLeft: 600, Progress: 0.4, Availability: 0, LastActivity: week},
+		{Hash: "bbb", Name: "Stalled", State: "stalledDL", Size: 1000, AmountLeft: 100, Progress: 0.9, Availability: 1.2, AddedOn: week},
+		{Hash: "ccc", Name: "Paused", State: "pausedDL", Size: 1000, AmountLeft: 1000, Availability: -1, LastActivity: week},
+		{Hash: "ddd", Name: "Downloading", State: "downloading", Size: 1000, AmountLeft: 500, Availability: 0, LastActivity: now.Unix()},
+	}, nil)
+
+	c := newTestCleaner(t, f)
+	var err error
+	c.Rules, err = rules.Parse([]byte(`[
+		{"name": "dead", "match": {"complete": false, "max_availability": 0, "min_inactive": "3d"}, "action": "delete"},
+		{"name": "stalled", "match": {"state": ["stalledDL"], "min_inactive": "3d"}, "action": "tag", "tags": ["stalled"]}
+	]`))
+	if err != nil {
+		t.Fatalf("Failed to parse rules: %v", err)
+	}
+
+	summary, err := c.Run(Options{})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if !slices.Equal(f.removed, []string{"aaa"}) || len(f.keptData) != 0 {
+		t.Errorf("Expected aaa to be removed with its partial data, got removed %v, kept data %v", f.removed, f.keptData)
+	}
+	if summary.BytesReclaimed != 400 {
+		t.Errorf("Expected the 400 downloaded bytes to be reclaimed, got %d", summary.BytesReclaimed)
+	}
+	if !slices.Equal(f.tagged, []string{"bbb:stalled"}) {
+		t.Errorf("Expected bbb to be tagged, got %v", f.tagged)
+	}
+}
@@ -0,0 +1,137 @@
+package cleaner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mallox/qbittorrent-cleaner/atomicfile"
+)
+
+// Sighting records when a rule with a grace period first matched a torrent
+type Sighting struct {
+	Hash      string    `json:"hash"`
+	Rule      string    `json:"rule"`
+	FirstSeen time.Time `json:"first_seen"`
+}
+
+// Sightings remembers since when rules with a grace period have matched torrents, so the
+// grace period survives restarts. It is optionally persisted to a JSON file.
+type Sightings struct {
+	path string
+
+	mu      sync.Mutex
+	entries map[string]Sighting
+}
+
+// LoadSightings reads the sightings stored at path. A missing file yields an empty set,
+// and an empty path keeps the sightings in memory only.
+func LoadSightings(path string) (*Sightings, error) {
+	s := &Sightings{path: path, entries: map[string]Sighting{}}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading sightings failed: %w", err)
+	}
+
+	var list []Sighting
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("parsing sightings failed: %w", err)
+	}
+	for _, sighting := range list {
+		s.entries[strings.ToLower(sighting.Hash)] = sighting
+	}
+	return s, nil
+}
+
+// FirstSeen returns when the rule first matched the torrent, or now if it was not seen
+// matching before. A nil set has seen nothing.
+func (s *Sightings) FirstSeen(hash, rule string, now time.Time) time.Time {
+	if s == nil {
+		return now
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sighting, ok := s.entries[strings.ToLower(hash)]
+	if !ok || sighting.Rule != rule {
+		return now
+	}
+	return sighting.FirstSeen
+}
+
+// Update records the rule each torrent in seen matched during a pass, keeping the time
+// it was first seen for torrents that still match the same rule. With prune set, torrents
+// not in seen are forgotten, so their grace period starts over if they match again.
+func (s *Sightings) Update(seen map[string]string, now time.Time, prune bool) error {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := map[string]Sighting{}
+	if !prune {
+		for key, sighting := range s.entries {
+			entries[key] = sighting
+		}
+	}
+	for hash, rule := range seen {
+		key := strings.ToLower(hash)
+		sighting, ok := s.entries[key]
+		if !ok || sighting.Rule != rule {
+			sighting = Sighting{Hash: hash, Rule: rule, FirstSeen: now}
+		}
+		entries[key] = sighting
+	}
+	s.entries = entries
+	return s.save()
+}
+
+// List returns the sightings sorted by hash
+func (s *Sightings) List() []Sighting {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.sorted()
+}
+
+// sorted returns the sightings sorted by hash. The lock must be held.
+func (s *Sightings) sorted() []Sighting {
+	list := []Sighting{}
+	for _, sighting := range s.entries {
+		list = append(list, sighting)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Hash < list[j].Hash })
+	return list
+}
+
+// save writes the sightings to the file, replacing it atomically. The lock must be held.
+func (s *Sightings) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(s.sorted(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling sightings failed: %w", err)
+	}
+
+	if err := atomicfile.WriteFile(s.path, data, 0o644); err != nil {
+		return fmt.Errorf("writing sightings failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package cleaner
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mallox/qbittorrent-cleaner/qbittorrent"
+)
+
+// Strategies for deciding whether the files of a torrent are missing
+const (
+	VerifyFiles   = "files"   // Look for the files in the download directories
+	VerifyState   = "state"   // Trust the missingFiles and error states qBittorrent reports
+	VerifyRecheck = "recheck" // Recheck torrents in batches and go by the progress of their files
+)
+
+// DefaultRecheckTimeout is how long a pass waits for qBittorrent to finish rechecking
+const DefaultRecheckTimeout = 10 * time.Minute
+
+// checkState decides whether the files of a torrent are missing from the state qBittorrent
+// reports, without looking at the filesystem. With Recheck set, torrents that look like they
+// are missing their files are rechecked first, and judged by their state afterwards. The
+// torrent is returned as it is after the recheck. The check is recorded in exp.
+func (c *Cleaner) checkState(log *slog.Logger, torrent qbittorrent.Torrent, recheck bool, exp *Explanation) (qbittorrent.Torrent, bool, error) {
+	if !torrent.State.IsErrored() {
+		exp.step(StepFiles, "qBittorrent reports state "+string(torrent.State))
+		return torrent, false, nil
+	}
+	if !c.Recheck {
+		exp.step(StepFiles, "qBittorrent reports state "+string(torrent.State))
+		return torrent, true, nil
+	}
+	if !recheck {
+		exp.step(StepFiles, "qBittorrent reports state "+string(torrent.State)+", a pass would recheck it first")
+		return torrent, true, nil
+	}
+
+	log.Info("Rechecking torrent", "state", torrent.State)
+	rechecked, err := c.recheck([]string{torrent.Hash})
+	if err != nil {
+		return torrent, false, err
+	}
+	after, ok := rechecked[strings.ToLower(torrent.Hash)]
+	if !ok {
+		return torrent, false, fmt.Errorf("torrent disappeared during the recheck")
+	}
+
+	// A recheck that doesn't find any data leaves the torrent without progress instead. One
+	// that finds most of it leaves the torrent incomplete, and it should be repaired.
+	missing := after.State.IsErrored() || after.Progress <= 0
+	exp.step(StepFiles, fmt.Sprintf("qBittorrent reports state %s with %.1f%% verified after a recheck, state was %s", after.State, after.Progress*100, torrent.State))
+	return after, missing, nil
+}
+
+// recheck makes qBittorrent verify the data of torrents and waits until it is done. It
+// returns the torrents after the recheck by lowercase hash.
+func (c *Cleaner) recheck(hashes []string) (map[string]qbittorrent.Torrent, error) {
+	if err := c.Client.Recheck(hashes...); err != nil {
+		return nil, err
+	}
+
+	timeout := c.RecheckTimeout
+	if timeout <= 0 {
+		timeout = DefaultRecheckTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		// qBittorrent only starts checking a moment after the request
+		time.Sleep(c.pollInterval())
+
+		torrents, err := c.Client.ListTorrentsByHash(hashes...)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.ContainsFunc(torrents, func(t qbittorrent.Torrent) bool { return t.State.IsChecking() }) {
+			byHash := map[string]qbittorrent.Torrent{}
+			for _, t := range filterHashes(torrents, hashes) {
+				byHash[strings.ToLower(t.Hash)] = t
+			}
+			return byHash, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("recheck did not finish within %s", timeout)
+		}
+	}
+}
+
+// pollInterval returns how often the state of rechecked torrents is polled
+func (c *Cleaner) pollInterval() time.Duration {
+	if c.PollInterval <= 0 {
+		return 2 * time.Second
+	}
+	return c.PollInterval
+}
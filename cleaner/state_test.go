@@ -0,0 +1,93 @@
+package cleaner
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mallox/qbittorrent-cleaner/qbittorrent"
+)
+
+// TestRunVerifyState tests trusting the states qBittorrent reports without looking at the files
+func TestRunVerifyState(t *testing.T) {
+	f := newFakeServer(t, []qbittorrent.Torrent{
+		{Hash: "aaa", Name: "Missing", State: "missingFiles", Size: 100},
+		{Hash: "bbb", Name: "Seeding", State: "stalledUP", Size: 100},
+		{Hash: "ccc", Name: "Errored", State: "error", Size: 100},
+	}, nil)
+	f.failures["/api/v2/torrents/files"] = 500
+
+	c := newTestCleaner(t, f, "/nonexistent")
+	c.Verify = VerifyState
+
+	summary, err := c.Run(Options{})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if summary.Aborted || !slices.Equal(f.removed, []string{"aaa", "ccc"}) {
+		t.Errorf("Expected aaa and ccc to be removed, got %v, %+v", f.removed, summary)
+	}
+	if summary.Missing != 2 || summary.Healthy != 1 || summary.Failed != 0 {
+		t.Errorf("Unexpected counts: %+v", summary.Counts)
+	}
+}
+
+// TestRunVerifyStateRecheck tests rechecking torrents before trusting their state
+func TestRunVerifyStateRecheck(t *testing.T) {
+	f := newFakeServer(t, []qbittorrent.Torrent{
+		{Hash: "aaa", Name: "Missing", State: "missingFiles", Size: 100},
+		{Hash: "bbb", Name: "Recovered", State: "error", Size: 100},
+		{Hash: "ccc", Name: "Seeding", State: "uploading", Size: 100},
+		{Hash: "ddd", Name: "Damaged", State: "error", Size: 100},
+		{Hash: "eee", Name: "Gone", State: "error", Size: 100},
+	}, nil)
+	f.afterRecheck = map[string]qbittorrent.Torrent{
+		"aaa": {Hash: "aaa", Name: "Missing", State: "missingFiles", Size: 100, AmountLeft: 60, Progress: 0.4},
+		"bbb": {Hash: "bbb", Name: "Recovered", State: "stalledUP", Size: 100, Progress: 1},
+		// A few bad pieces are worth repairing rather than removing the torrent
+		"ddd": {Hash: "ddd", Name: "Damaged", State: "stoppedDL", Size: 100, AmountLeft: 5, Progress: 0.95},
+		"eee": {Hash: "eee", Name: "Gone", State: "stoppedDL", Size: 100, AmountLeft: 100},
+	}
+
+	c := newTestCleaner(t, f)
+	c.Verify, c.Recheck, c.PollInterval = VerifyState, true, time.Millisecond
+
+	// Explaining never rechecks
+	explanations, err := c.Explain("aaa")
+	if err != nil {
+		t.Fatalf("Explain failed: %v", err)
+	}
+	want := Step{Name: StepFiles, Result: "qBittorrent reports state missingFiles, a pass would recheck it first"}
+	if !slices.Contains(explanations[0].Steps, want) || len(f.rechecked) != 0 {
+		t.Errorf("Expected explain to skip the recheck, got %+v, rechecked %v", explanations[0].Steps, f.rechecked)
+	}
+
+	summary, err := c.Run(Options{})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if !slices.Equal(f.rechecked, []string{"aaa", "bbb", "ddd", "eee"}) {
+		t.Errorf("Expected only torrents that look broken to be rechecked, got %v", f.rechecked)
+	}
+	if !slices.Equal(f.removed, []string{"aaa", "eee"}) || summary.BytesReclaimed != 40 {
+		t.Errorf("Expected aaa and eee to be removed with their 40 remaining bytes, got %v, %d", f.removed, summary.BytesReclaimed)
+	}
+}
+
+// TestRunVerifyStateRecheckTimeout tests that a torrent is kept when its recheck doesn't finish
+func TestRunVerifyStateRecheckTimeout(t *testing.T) {
+	f := newFakeServer(t, []qbittorrent.Torrent{{Hash: "aaa", Name: "Missing", State: "missingFiles"}}, nil)
+	f.afterRecheck = map[string]qbittorrent.Torrent{"aaa": {Hash: "aaa", Name: "Missing", State: "checkingUP"}}
+
+	c := newTestCleaner(t, f)
+	c.Verify, c.Recheck, c.PollInterval, c.RecheckTimeout = VerifyState, true, time.Millisecond, 5*time.Millisecond
+
+	summary, err := c.Run(Options{})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(f.removed) != 0 || summary.Failed != 1 || !strings.Contains(summary.Failures[0].Error, "did not finish") {
+		t.Errorf("Expected the torrent to be kept and the failure recorded, got removed %v, %+v", f.removed, summary.Failures)
+	}
+}
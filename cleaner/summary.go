@@ -0,0 +1,106 @@
+package cleaner
+
+import "time"
+
+// Uncategorized is the category key used for torrents without a category
+const Uncategorized = "uncategorized"
+
+// Counts holds the per-outcome torrent counts of a pass
+type Counts struct {
+	Total          int   `json:"total"`
+	Checked        int   `json:"checked"`
+	Skipped        int   `json:"skipped"`
+	Healthy        int   `json:"healthy"`
+	Missing        int   `json:"missing"`
+	Removed        int   `json:"removed"`
+	Failed         int   `json:"failed"`
+	BytesReclaimed int64 `json:"bytes_reclaimed"`
+}
+
+// Removal describes a torrent removed during a pass, or another action a rule took on it
+type Removal struct {
+	Hash         string   `json:"hash"`
+	Name         string   `json:"name"`
+	Category     string   `json:"category"`
+	SavePath     string   `json:"save_path"`
+	Rule         string   `json:"rule"`
+	MissingFiles []string `json:"missing_files"`
+	Missing      bool     `json:"missing,omitempty"` // Some files are missing, even if they aren't listed
+	Size         int64    `json:"size"`              // Bytes still on disk, reclaimed unless KeepData is set
+	Action       string   `json:"action"`
+	KeepData     bool     `json:"keep_data,omitempty"` // The torrent was removed but its files were kept
+}
+
+// Failure describes a torrent that could not be checked or removed
+type Failure struct {
+	Hash  string `json:"hash"`
+	Name  string `json:"name"`
+	Stage string `json:"stage"`
+	Error string `json:"error"`
+}
+
+// Stages at which a torrent can fail
+const (
+	StageFiles    = "files"
+	StageRemove   = "remove"
+	StageAction   = "action"   // Tagging or pausing
+	StageTrackers = "trackers" // Looking up trackers for hit-and-run protection
+)
+
+// Summary is the outcome of a single cleaner pass
+type Summary struct {
+	RunID       string             `json:"run_id"`
+	Started     time.Time          `json:"started"`
+	Finished    time.Time          `json:"finished"`
+	DryRun      bool               `json:"dry_run"`
+	Aborted     bool               `json:"aborted"`
+	AbortReason string             `json:"abort_reason,omitempty"`
+	Counts                         // Totals across all categories
+	Categories  map[string]*Counts `json:"categories"`
+	Candidates  []Removal          `json:"candidates"` // Torrents selected for removal, including in dry runs
+	Removals    []Removal          `json:"removals"`
+	Staged      []Removal          `json:"staged"`  // Candidates queued for approval in stage mode
+	Actions     []Removal          `json:"actions"` // Torrents tagged, paused or reported by rules, or that would be in dry runs
+	Failures    []Failure          `json:"failures"`
+
+	rechecked map[string]bool // Lowercase hashes of the torrents rechecked during the pass
+}
+
+// newSummary creates an empty summary for a run
+func newSummary(runID string) *Summary {
+	return &Summary{
+		RunID:      runID,
+		Started:    time.Now(),
+		Categories: map[string]*Counts{},
+		Candidates: []Removal{},
+		Removals:   []Removal{},
+		Staged:     []Removal{},
+		Actions:    []Removal{},
+		Failures:   []Failure{},
+	}
+}
+
+// Duration returns how long the pass took
+func (s *Summary) Duration() time.Duration {
+	return s.Finished.Sub(s.Started)
+}
+
+// category returns the counts for a category, creating them on first use
+func (s *Summary) category(name string) *Counts {
+	if name == "" {
+		name = Uncategorized
+	}
+
+	counts, ok := s.Categories[name]
+	if !ok {
+		counts = &Counts{}
+		s.Categories[name] = counts
+	}
+	return counts
+}
+
+// record applies fn to both the overall and the per-category counts
+func (s *Summary) record(category string, fn func(*Counts)) {
+	fn(&s.Counts)
+	fn(s.category(category))
+}
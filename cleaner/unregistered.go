@@ -0,0 +1,62 @@
+package cleaner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mallox/qbittorrent-cleaner/qbittorrent"
+)
+
+// DefaultUnregisteredPatterns are the messages trackers commonly answer with for torrents
+// they deleted. A bare "not found" is left out, since it is also how a tracker whose
+// host name doesn't resolve is reported.
+var DefaultUnregisteredPatterns = []string{
+	"unregistered",
+	"not registered",
+	"torrent not found",
+	"infohash not found",
+	"torrent does not exist",
+	"unknown torrent",
+	"trumped",
+	"torrent has been deleted",
+}
+
+// checkUnregistered reports whether every tracker of a torrent reports it as unregistered.
+// DHT, PeX and LSD don't count, and a torrent without real trackers is never unregistered.
+// The check is recorded in exp.
+func (c *Cleaner) checkUnregistered(trackers []qbittorrent.Tracker, exp *Explanation) bool {
+	var results []string
+	unregistered := 0
+	for _, tracker := range trackers {
+		host := tracker.Host()
+		if host == "" {
+			continue
+		}
+		if c.unregisteredMessage(tracker.Msg) {
+			unregistered++
+			results = append(results, fmt.Sprintf("%s: %s", host, tracker.Msg))
+		} else if tracker.Msg != "" {
+			results = append(results, fmt.Sprintf("%s: %s (registered)", host, tracker.Msg))
+		} else {
+			results = append(results, host+": registered")
+		}
+	}
+
+	if len(results) == 0 {
+		exp.step(StepTrackers, "no trackers")
+		return false
+	}
+	exp.step(StepTrackers, fmt.Sprintf("%d of %d trackers report unregistered: %s", unregistered, len(results), strings.Join(results, ", ")))
+	return unregistered == len(results)
+}
+
+// unregisteredMessage reports whether a tracker message matches one of the unregistered patterns
+func (c *Cleaner) unregisteredMessage(msg string) bool {
+	msg = strings.ToLower(msg)
+	for _, pattern := range c.UnregisteredPatterns {
+		if pattern != "" && strings.Contains(msg, strings.ToLower(pattern)) {
+			return true
+		}
+	}
+	return false
+}
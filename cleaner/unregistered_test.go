@@ -0,0 +1,120 @@
+package cleaner
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mallox/qbittorrent-cleaner/qbittorrent"
+	"github.com/mallox/qbittorrent-cleaner/rules"
+)
+
+// TestSightings tests recording, persisting and pruning when rules first matched torrents
+func TestSightings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sightings.json")
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	s, err := LoadSightings(path)
+	if err != nil {
+		t.Fatalf("LoadSightings failed: %v", err)
+	}
+	if err := s.Update(map[string]string{"AAA": "unregistered", "bbb": "unregistered"}, now, true); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	later := now.Add(time.Hour)
+	if err := s.Update(map[string]string{"aaa": "unregistered", "bbb": "stalled"}, later, true); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if got := s.FirstSeen("aaa", "unregistered", later); !got.Equal(now) {
+		t.Errorf("Expected aaa to be seen since %s, got %s", now, got)
+	}
+	if got := s.FirstSeen("bbb", "stalled", later); !got.Equal(later) {
+		t.Errorf("Expected a new rule to start over for bbb, got %s", got)
+	}
+
+	loaded, err := LoadSightings(path)
+	if err != nil {
+		t.Fatalf("LoadSightings failed: %v", err)
+	}
+	if list := loaded.List(); len(list) != 2 || list[0].Hash != "AAA" || !list[0].FirstSeen.Equal(now) {
+		t.Errorf("Expected the sightings to be persisted, got %+v", list)
+	}
+
+	if err := loaded.Update(map[string]string{"bbb": "stalled"}, later, false); err != nil || len(loaded.List()) != 2 {
+		t.Errorf("Expected a partial pass to keep other sightings, got %+v, %v", loaded.List(), err)
+	}
+	if err := loaded.Update(map[string]string{"bbb": "stalled"}, later, true); err != nil || len(loaded.List()) != 1 {
+		t.Errorf("Expected torrents that no longer match to be forgotten, got %+v, %v", loaded.List(), err)
+	}
+
+	var none *Sightings
+	if got := none.FirstSeen("aaa", "unregistered", later); !got.Equal(later) {
+		t.Errorf("Expected nil sightings to have seen nothing")
+	}
+}
+
+// TestRunUnregistered tests removing torrents that every tracker reports as unregistered after a grace period
+func TestRunUnregistered(t *testing.T) {
+	f := newFakeServer(t, []qbittorrent.Torrent{
+		{Hash: "aaa", Name: "Deleted"},
+		{Hash: "bbb", Name: "Mirrored"},
+		{Hash: "ccc", Name: "Offline"},
+		{Hash: "ddd", Name: "Trackerless"},
+	}, nil)
+	f.trackers = map[string][]qbittorrent.Tracker{
+		"aaa": {{URL: "** [DHT] **"}, {URL: "https://one.example.org/announce", Status: 4, Msg: "Unregistered torrent"}, {URL: "https://two.example.org/announce", Status: 4, Msg: "Torrent not found"}},
+		"bbb": {{URL: "https://one.example.org/announce", Status: 4, Msg: "Unregistered torrent"}, {URL: "https://two.example.org/announce", Status: 2}},
+		"ccc": {{URL: "https://one.example.org/announce", Status: 4, Msg: "Host not found (authoritative)"}},
+		"ddd": {{URL: "** [DHT] **"}},
+	}
+
+	path := filepath.Join(t.TempDir(), "sightings.json")
+	c := newTestCleaner(t, f)
+	c.Sightings, _ = LoadSightings(path)
+	var err error
+	c.Rules, err = rules.Parse([]byte(`[{"name": "unregistered", "match": {"unregistered": true}, "grace": "1h", "action": "delete"}]`))
+	if err != nil {
+		t.Fatalf("Failed to parse rules: %v", err)
+	}
+
+	// A dry run reports nothing yet and doesn't start the grace period
+	summary, err := c.Run(Options{DryRun: true})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(summary.Candidates) != 0 || len(c.Sightings.List()) != 0 {
+		t.Errorf("Expected a dry run to wait and record nothing, got %+v, %+v", summary.Candidates, c.Sightings.List())
+	}
+
+	if _, err := c.Run(Options{}); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if list := c.Sightings.List(); len(f.removed) != 0 || len(list) != 1 || list[0].Hash != "aaa" {
+		t.Errorf("Expected aaa to wait for the grace period, got removed %v, sightings %+v", f.removed, list)
+	}
+
+	explanations, err := c.Explain("aaa")
+	if err != nil {
+		t.Fatalf("Explain failed: %v", err)
+	}
+	exp := explanations[0]
+	wantTrackers := Step{Name: StepTrackers, Result: "2 of 2 trackers report unregistered: one.example.org: Unregistered torrent, two.example.org: Torrent not found"}
+	if exp.Verdict != VerdictKeep || exp.GraceUntil.IsZero() || !slices.Contains(exp.Steps, wantTrackers) {
+		t.Errorf("Expected aaa to be kept until its grace period ends, got %+v", exp)
+	}
+
+	// The grace period survives a restart
+	earlier := &Sightings{path: path, entries: map[string]Sighting{"aaa": {Hash: "aaa", Rule: "unregistered", FirstSeen: time.Now().Add(-2 * time.Hour)}}}
+	if err := earlier.save(); err != nil {
+		t.Fatalf("Failed to save sightings: %v", err)
+	}
+	c.Sightings, _ = LoadSightings(path)
+	if _, err := c.Run(Options{}); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if !slices.Equal(f.removed, []string{"aaa"}) {
+		t.Errorf("Expected only aaa to be removed, got %v", f.removed)
+	}
+}
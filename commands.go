@@ -0,0 +1,364 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mallox/qbittorrent-cleaner/cleaner"
+	"github.com/mallox/qbittorrent-cleaner/journal"
+	"github.com/mallox/qbittorrent-cleaner/report"
+)
+
+// parseExit returns the exit code for a command line that failed to parse. Asking for
+// the usage with -h is not an error.
+func parseExit(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return exitClean
+	}
+	return exitUsage
+}
+
+// runClean implements the "clean" subcommand, which removes torrents with missing files
+// once, or on every RUN_INTERVAL in daemon mode
+func runClean(cfg *config, args []string) int {
+	fs := flag.NewFlagSet("clean", flag.ContinueOnError)
+	interactive := fs.Bool("interactive", false, "ask before removing each torrent, with a final confirmation")
+	if err := fs.Parse(args); err != nil {
+		return parseExit(err)
+	}
+
+	if *interactive && (cfg.RunInterval > 0 || cfg.PendingPath != "") {
+		fmt.Println("Interactive mode can't be combined with RUN_INTERVAL or PENDING_PATH")
+		return exitUsage
+	}
+
+	// Prompts go to stdout, so logs must not end up between them
+	logOut := os.Stdout
+	if *interactive {
+		logOut = os.Stderr
+	}
+	a, code := newApp(cfg, logOut)
+	if a == nil {
+		return code
+	}
+	defer a.close()
+
+	if *interactive {
+		a.cleaner.Confirm = newPrompter(os.Stdin, os.Stdout).confirm
+	}
+
+	if cfg.RunInterval > 0 {
+		return a.runDaemon()
+	}
+	if cfg.SMTPHost != "" && cfg.SMTPDigestInterval > 0 {
+		a.logger.Warn("SMTP_DIGEST_INTERVAL only applies with RUN_INTERVAL, sending one email for this run")
+	}
+	return a.runOnce()
+}
+
+// runCheck implements the "check" subcommand, which reports what a pass would remove
+func runCheck(cfg *config, args []string) int {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: qbt-clean check [flags] [hash...]")
+		fs.PrintDefaults()
+	}
+	format := fs.String("format", cfg.ReportFormat, "report format: table, json or csv (default $REPORT_FORMAT)")
+	if err := fs.Parse(args); err != nil {
+		return parseExit(err)
+	}
+
+	a, code := newApp(cfg, os.Stderr)
+	if a == nil {
+		return code
+	}
+	defer a.close()
+
+	if err := a.login(); err != nil {
+		return exitError
+	}
+
+	summary, err := a.cleaner.Run(cleaner.Options{DryRun: true, Hashes: fs.Args()})
+	if err != nil {
+		a.logger.Error("Check failed", "error", err)
+		return exitError
+	}
+
+	if err := writeReport(cfg.ReportPath, *format, summary); err != nil {
+		a.logger.Error("Failed to write report", "path", cfg.ReportPath, "error", err)
+		return exitError
+	}
+	return exitCode(summary)
+}
+
+// runList implements the "list" subcommand, which shows the health of every torrent
+func runList(cfg *config, args []string) int {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	status := fs.String("status", "", "only list torrents with this status: healthy, missing, matched, skipped, excluded or failed")
+	asJSON := fs.Bool("json", false, "print the torrents as JSON lines")
+	if err := fs.Parse(args); err != nil {
+		return parseExit(err)
+	}
+
+	a, code := newApp(cfg, os.Stderr)
+	if a == nil {
+		return code
+	}
+	defer a.close()
+
+	if err := a.login(); err != nil {
+		return exitError
+	}
+
+	explanations, err := a.cleaner.List()
+	if err != nil {
+		a.logger.Error("Listing torrents failed", "error", err)
+		return exitError
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if !*asJSON {
+		fmt.Fprintln(tw, "HASH\tSTATUS\tSTATE\tCATEGORY\tNAME")
+	}
+	for _, exp := range explanations {
+		if *status != "" && exp.Status != *status {
+			continue
+		}
+		if *asJSON {
+			line, _ := json.Marshal(exp)
+			fmt.Println(string(line))
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", exp.Hash, exp.Status, exp.State, exp.Category, exp.Name)
+	}
+	tw.Flush()
+
+	return exitClean
+}
+
+// runExplain implements the "explain" subcommand, which shows why a torrent would or would not be removed
+func runExplain(cfg *config, args []string) int {
+	fs := flag.NewFlagSet("explain", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: qbt-clean explain [flags] <hash or name>")
+		fs.PrintDefaults()
+	}
+	asJSON := fs.Bool("json", false, "print the explanation as JSON")
+	if err := fs.Parse(args); err != nil {
+		return parseExit(err)
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	a, code := newApp(cfg, os.Stderr)
+	if a == nil {
+		return code
+	}
+	defer a.close()
+
+	if err := a.login(); err != nil {
+		return exitError
+	}
+
+	explanations, err := a.cleaner.Explain(fs.Arg(0))
+	if err != nil {
+		a.logger.Error("Explaining torrent failed", "error", err)
+		return exitError
+	}
+
+	if *asJSON {
+		line, _ := json.MarshalIndent(explanations, "", "  ")
+		fmt.Println(string(line))
+		return exitClean
+	}
+
+	for i, exp := range explanations {
+		if i > 0 {
+			fmt.Println()
+		}
+		printExplanation(exp)
+	}
+
+	return exitClean
+}
+
+// printExplanation prints the decision trace of a single torrent
+func printExplanation(exp cleaner.Explanation) {
+	fmt.Printf("%s (%s)\n", exp.Name, exp.Hash)
+	fmt.Printf("  Category: %s\n", exp.Category)
+	fmt.Printf("  State:    %s\n", exp.State)
+	fmt.Println("  Steps:")
+	for i, step := range exp.Steps {
+		fmt.Printf("    %d. %-10s %s\n", i+1, step.Name, step.Result)
+		if step.Name != cleaner.StepFiles {
+			continue
+		}
+		for _, file := range exp.Files {
+			if !file.Wanted {
+				fmt.Printf("       - %s (priority %d, not downloaded, skipped)\n", file.Name, file.Priority)
+				continue
+			}
+			fmt.Printf("       - %s (priority %d, %d bytes)\n", file.Name, file.Priority, file.Size)
+			for _, path := range file.Paths {
+				switch {
+				case !path.Found:
+					fmt.Printf("           %s: %s\n", path.Path, path.Error)
+				case path.Size != file.Size:
+					fmt.Printf("           %s: found, %d bytes on disk\n", path.Path, path.Size)
+				default:
+					fmt.Printf("           %s: found\n", path.Path)
+				}
+			}
+			if file.Found == "" {
+				fmt.Println("           => missing")
+			}
+		}
+	}
+	if exp.Rule != "" {
+		fmt.Printf("  Verdict:  %s (rule %s, action %s)\n", exp.Verdict, exp.Rule, exp.Action)
+	} else {
+		fmt.Printf("  Verdict:  %s\n", exp.Verdict)
+	}
+	fmt.Printf("  Reason:   %s\n", exp.Reason)
+	for _, note := range exp.Notes {
+		fmt.Printf("  Note:     %s\n", note)
+	}
+}
+
+// runOrphans implements the "orphans" subcommand, which lists files that belong to no torrent
+func runOrphans(cfg *config, args []string) int {
+	fs := flag.NewFlagSet("orphans", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the files as JSON lines")
+	if err := fs.Parse(args); err != nil {
+		return parseExit(err)
+	}
+
+	a, code := newApp(cfg, os.Stderr)
+	if a == nil {
+		return code
+	}
+	defer a.close()
+
+	if err := a.login(); err != nil {
+		return exitError
+	}
+
+	orphans, err := a.cleaner.Orphans()
+	if err != nil {
+		a.logger.Error("Finding orphaned files failed", "error", err)
+		return exitError
+	}
+
+	var total int64
+	for _, orphan := range orphans {
+		if *asJSON {
+			line, _ := json.Marshal(orphan)
+			fmt.Println(string(line))
+			continue
+		}
+		fmt.Printf("%10s  %s  %s\n", report.FormatBytes(orphan.Size), orphan.ModTime.Local().Format(time.DateTime), orphan.Path)
+		total += orphan.Size
+	}
+	if !*asJSON {
+		fmt.Printf("%d orphaned files, %s\n", len(orphans), report.FormatBytes(total))
+	}
+
+	return exitClean
+}
+
+// runRestore implements the "restore" subcommand, which adds removed torrents back
+func runRestore(cfg *config, args []string) int {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: qbt-clean restore [flags] [hash...]")
+		fs.PrintDefaults()
+	}
+	runID := fs.String("run", "", "restore every torrent removed by this run")
+	start := fs.Bool("start", false, "start the restored torrents instead of adding them paused")
+	if err := fs.Parse(args); err != nil {
+		return parseExit(err)
+	}
+
+	if cfg.JournalPath == "" || cfg.BackupDir == "" {
+		fmt.Println("Restoring needs both JOURNAL_PATH and BACKUP_DIR")
+		return exitUsage
+	}
+	if *runID == "" && fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	entries, err := removedEntries(cfg.JournalPath, *runID, fs.Args())
+	if err != nil {
+		fmt.Printf("Failed to read journal: %v\n", err)
+		return exitError
+	}
+	if len(entries) == 0 {
+		fmt.Println("No matching removals found in the journal")
+		return exitError
+	}
+
+	a, code := newApp(cfg, os.Stderr)
+	if a == nil {
+		return code
+	}
+	defer a.close()
+
+	if err := a.login(); err != nil {
+		return exitError
+	}
+
+	code = exitClean
+	for _, e := range entries {
+		if err := a.cleaner.Restore(e, *start); err != nil {
+			fmt.Printf("Failed to restore %s (%s): %v\n", e.Name, e.Hash, err)
+			code = exitPartial
+			continue
+		}
+		fmt.Printf("Restored %s (%s) to %s\n", e.Name, e.Hash, e.SavePath)
+	}
+	return code
+}
+
+// removedEntries returns the latest successful removal from the journal for each torrent
+// removed by the run or listed in hashes
+func removedEntries(path, runID string, hashes []string) ([]journal.Entry, error) {
+	entries, err := journal.Read(path, journal.Filter{})
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := map[string]bool{}
+	for _, hash := range hashes {
+		wanted[strings.ToLower(hash)] = true
+	}
+
+	latest := map[string]int{}
+	var removed []journal.Entry
+	for _, e := range entries {
+		if e.Outcome != journal.OutcomeSuccess || (e.Action != cleaner.ActionDelete && e.Action != cleaner.ActionDeleteKeepData) {
+			continue
+		}
+		if (runID == "" || e.RunID != runID) && !wanted[strings.ToLower(e.Hash)] {
+			continue
+		}
+
+		// A torrent removed again after being restored is restored from its latest removal
+		key := strings.ToLower(e.Hash)
+		if i, ok := latest[key]; ok {
+			removed[i] = e
+			continue
+		}
+		latest[key] = len(removed)
+		removed = append(removed, e)
+	}
+	return removed, nil
+}
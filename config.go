@@ -0,0 +1,397 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mallox/qbittorrent-cleaner/cleaner"
+	"github.com/mallox/qbittorrent-cleaner/rules"
+)
+
+// config holds the settings read from the environment
+type config struct {
+	DownloadDirs      []string      `json:"DOWNLOAD_DIRS"`
+	ServerURL         string        `json:"SERVER_URL"`
+	ServerUser        string        `json:"SERVER_USER"`
+	ServerPass        string        `json:"SERVER_PASS"`
+	LogLevel          string        `json:"LOG_LEVEL"`
+	LogFormat         string        `json:"LOG_FORMAT"`
+	JournalPath       string        `json:"JOURNAL_PATH"`
+	ExclusionsPath    string        `json:"EXCLUSIONS_PATH"`
+	PendingPath       string        `json:"PENDING_PATH"`
+	BackupDir         string        `json:"BACKUP_DIR"`
+	ReportFormat      string        `json:"REPORT_FORMAT"`
+	ReportPath        string        `json:"REPORT_PATH"`
+	MaxRemovals       int           `json:"MAX_REMOVALS"`
+	MaxRemovalPercent float64       `json:"MAX_REMOVAL_PERCENT"`
+	RunInterval       time.Duration `json:"RUN_INTERVAL"`
+	ListenAddr        string        `json:"LISTEN_ADDR"`
+	ReadyMaxIntervals int           `json:"READY_MAX_INTERVALS"`
+	MetricsTextfile   string        `json:"METRICS_TEXTFILE"`
+	APIToken          string        `json:"API_TOKEN"`
+	APIHistory        int           `json:"API_HISTORY"`
+	Rules             []rules.Rule  `json:"RULES"`
+	LibraryDirs       []string      `json:"LIBRARY_DIRS"`
+
+	VerifyMode     string        `json:"VERIFY_MODE"`
+	VerifyRecheck  bool          `json:"VERIFY_RECHECK"`
+	RecheckTimeout time.Duration `json:"RECHECK_TIMEOUT"`
+
+	RecheckBatch     int           `json:"RECHECK_BATCH"`
+	RecheckMax       int           `json:"RECHECK_MAX"`
+	RecheckInterval  time.Duration `json:"RECHECK_INTERVAL"`
+	RecheckStatePath string        `json:"RECHECK_STATE_PATH"`
+
+	SightingsPath        string   `json:"SIGHTINGS_PATH"`
+	UnregisteredPatterns []string `json:"UNREGISTERED_PATTERNS"`
+
+	HNRProtections []rules.Protection `json:"HNR_PROTECTIONS"`
+	HNRTag         string             `json:"HNR_TAG"`
+
+	WebhookURLs        []string `json:"WEBHOOK_URLS"`
+	WebhookTemplate    string   `json:"WEBHOOK_TEMPLATE"`
+	WebhookContentType string   `json:"WEBHOOK_CONTENT_TYPE"`
+	WebhookSecret      string   `json:"WEBHOOK_SECRET"`
+	WebhookEvents      string   `json:"WEBHOOK_EVENTS"`
+	WebhookRetries     int      `json:"WEBHOOK_RETRIES"`
+	WebhookNotifyEmpty bool     `json:"WEBHOOK_NOTIFY_EMPTY"`
+
+	SMTPHost           string        `json:"SMTP_HOST"`
+	SMTPPort           int           `json:"SMTP_PORT"`
+	SMTPUser           string        `json:"SMTP_USER"`
+	SMTPPass           string        `json:"SMTP_PASS"`
+	SMTPFrom           string        `json:"SMTP_FROM"`
+	SMTPTo             []string      `json:"SMTP_TO"`
+	SMTPTLS            string        `json:"SMTP_TLS"`
+	SMTPDigestInterval time.Duration `json:"SMTP_DIGEST_INTERVAL"`
+
+	MQTTBroker          string `json:"MQTT_BROKER"`
+	MQTTUser            string `json:"MQTT_USER"`
+	MQTTPass            string `json:"MQTT_PASS"`
+	MQTTClientID        string `json:"MQTT_CLIENT_ID"`
+	MQTTTopic           string `json:"MQTT_TOPIC"`
+	MQTTDiscoveryPrefix string `json:"MQTT_DISCOVERY_PREFIX"`
+}
+
+// loadConfig reads the configuration from environment variables
+func loadConfig() (*config, error) {
+	cfg := &config{
+		DownloadDirs:    envList("DOWNLOAD_DIRS"),
+		ServerURL:       os.Getenv("SERVER_URL"),
+		ServerUser:      os.Getenv("SERVER_USER"),
+		ServerPass:      os.Getenv("SERVER_PASS"),
+		LogLevel:        os.Getenv("LOG_LEVEL"),
+		LogFormat:       os.Getenv("LOG_FORMAT"),
+		JournalPath:     os.Getenv("JOURNAL_PATH"),
+		ExclusionsPath:  os.Getenv("EXCLUSIONS_PATH"),
+		PendingPath:     os.Getenv("PENDING_PATH"),
+		BackupDir:       os.Getenv("BACKUP_DIR"),
+		ReportFormat:    os.Getenv("REPORT_FORMAT"),
+		ReportPath:      os.Getenv("REPORT_PATH"),
+		ListenAddr:      os.Getenv("LISTEN_ADDR"),
+		MetricsTextfile: os.Getenv("METRICS_TEXTFILE"),
+		APIToken:        os.Getenv("API_TOKEN"),
+		LibraryDirs:     envList("LIBRARY_DIRS"),
+		HNRTag:          os.Getenv("HNR_TAG"),
+
+		VerifyMode:       os.Getenv("VERIFY_MODE"),
+		RecheckStatePath: os.Getenv("RECHECK_STATE_PATH"),
+
+		SightingsPath:        os.Getenv("SIGHTINGS_PATH"),
+		UnregisteredPatterns: envList("UNREGISTERED_PATTERNS"),
+
+		WebhookURLs:        envList("WEBHOOK_URLS"),
+		WebhookTemplate:    os.Getenv("WEBHOOK_TEMPLATE"),
+		WebhookContentType: os.Getenv("WEBHOOK_CONTENT_TYPE"),
+		WebhookSecret:      os.Getenv("WEBHOOK_SECRET"),
+		WebhookEvents:      os.Getenv("WEBHOOK_EVENTS"),
+
+		SMTPHost: os.Getenv("SMTP_HOST"),
+		SMTPUser: os.Getenv("SMTP_USER"),
+		SMTPPass: os.Getenv("SMTP_PASS"),
+		SMTPFrom: os.Getenv("SMTP_FROM"),
+		SMTPTo:   envList("SMTP_TO"),
+		SMTPTLS:  os.Getenv("SMTP_TLS"),
+
+		MQTTBroker:          os.Getenv("MQTT_BROKER"),
+		MQTTUser:            os.Getenv("MQTT_USER"),
+		MQTTPass:            os.Getenv("MQTT_PASS"),
+		MQTTClientID:        os.Getenv("MQTT_CLIENT_ID"),
+		MQTTTopic:           os.Getenv("MQTT_TOPIC"),
+		MQTTDiscoveryPrefix: "homeassistant",
+	}
+
+	// An explicitly empty prefix disables Home Assistant discovery
+	if prefix, ok := os.LookupEnv("MQTT_DISCOVERY_PREFIX"); ok {
+		cfg.MQTTDiscoveryPrefix = prefix
+	}
+
+	var err error
+	if cfg.MaxRemovals, err = envInt("MAX_REMOVALS"); err != nil {
+		return nil, err
+	}
+	if cfg.MaxRemovalPercent, err = envFloat("MAX_REMOVAL_PERCENT"); err != nil {
+		return nil, err
+	}
+	if cfg.RunInterval, err = envDuration("RUN_INTERVAL"); err != nil {
+		return nil, err
+	}
+	if cfg.ReadyMaxIntervals, err = envInt("READY_MAX_INTERVALS"); err != nil {
+		return nil, err
+	}
+	if cfg.ReadyMaxIntervals == 0 {
+		cfg.ReadyMaxIntervals = 3
+	}
+	if cfg.APIHistory, err = envInt("API_HISTORY"); err != nil {
+		return nil, err
+	}
+	if cfg.APIHistory == 0 {
+		cfg.APIHistory = 50
+	}
+	if cfg.WebhookRetries, err = envInt("WEBHOOK_RETRIES"); err != nil {
+		return nil, err
+	}
+	if cfg.WebhookNotifyEmpty, err = envBool("WEBHOOK_NOTIFY_EMPTY"); err != nil {
+		return nil, err
+	}
+	if cfg.SMTPPort, err = envInt("SMTP_PORT"); err != nil {
+		return nil, err
+	}
+	if cfg.SMTPDigestInterval, err = envDuration("SMTP_DIGEST_INTERVAL"); err != nil {
+		return nil, err
+	}
+	if cfg.VerifyRecheck, err = envBool("VERIFY_RECHECK"); err != nil {
+		return nil, err
+	}
+	if cfg.RecheckTimeout, err = envDuration("RECHECK_TIMEOUT"); err != nil {
+		return nil, err
+	}
+	if cfg.RecheckTimeout == 0 {
+		cfg.RecheckTimeout = cleaner.DefaultRecheckTimeout
+	}
+	if cfg.RecheckBatch, err = envInt("RECHECK_BATCH"); err != nil {
+		return nil, err
+	}
+	if cfg.RecheckBatch == 0 {
+		cfg.RecheckBatch = cleaner.DefaultRecheckBatch
+	}
+	if cfg.RecheckMax, err = envInt("RECHECK_MAX"); err != nil {
+		return nil, err
+	}
+	if cfg.RecheckMax == 0 {
+		cfg.RecheckMax = cleaner.DefaultRecheckMax
+	}
+	if cfg.RecheckInterval, err = envDuration("RECHECK_INTERVAL"); err != nil {
+		return nil, err
+	}
+	if cfg.RecheckInterval == 0 {
+		cfg.RecheckInterval = cleaner.DefaultRecheckInterval
+	}
+	switch cfg.VerifyMode {
+	case "":
+		cfg.VerifyMode = cleaner.VerifyFiles
+	case cleaner.VerifyFiles, cleaner.VerifyState, cleaner.VerifyRecheck:
+	default:
+		return nil, fmt.Errorf("VERIFY_MODE must be %s, %s or %s, got %q", cleaner.VerifyFiles, cleaner.VerifyState, cleaner.VerifyRecheck, cfg.VerifyMode)
+	}
+
+	// Without rules of their own, torrents with missing files are removed
+	cfg.Rules = rules.Default()
+	if text := os.Getenv("RULES"); text != "" {
+		if cfg.Rules, err = rules.Parse([]byte(text)); err != nil {
+			return nil, fmt.Errorf("RULES is invalid: %w", err)
+		}
+	}
+	if path := os.Getenv("RULES_FILE"); path != "" {
+		if cfg.Rules, err = rules.Load(path); err != nil {
+			return nil, fmt.Errorf("RULES_FILE is invalid: %w", err)
+		}
+	}
+
+	for _, rule := range cfg.Rules {
+		if rule.ChecksLibrary() && len(cfg.LibraryDirs) == 0 {
+			return nil, fmt.Errorf("rule %s looks for payloads in the media library, but LIBRARY_DIRS is not set", rule.Name)
+		}
+	}
+
+	if len(cfg.UnregisteredPatterns) == 0 {
+		cfg.UnregisteredPatterns = cleaner.DefaultUnregisteredPatterns
+	}
+
+	if text := os.Getenv("HNR_PROTECTIONS"); text != "" {
+		if cfg.HNRProtections, err = rules.ParseProtections([]byte(text)); err != nil {
+			return nil, fmt.Errorf("HNR_PROTECTIONS is invalid: %w", err)
+		}
+	}
+	if path := os.Getenv("HNR_PROTECTIONS_FILE"); path != "" {
+		if cfg.HNRProtections, err = rules.LoadProtections(path); err != nil {
+			return nil, fmt.Errorf("HNR_PROTECTIONS_FILE is invalid: %w", err)
+		}
+	}
+	if cfg.HNRTag == "" {
+		cfg.HNRTag = cleaner.DefaultProtectedTag
+	}
+
+	// Templates are usually multi-line JSON, so allow loading them from a file
+	if path := os.Getenv("WEBHOOK_TEMPLATE_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading WEBHOOK_TEMPLATE_FILE failed: %w", err)
+		}
+		cfg.WebhookTemplate = string(data)
+	}
+
+	return cfg, nil
+}
+
+// redactedValue replaces secrets in the redacted configuration
+const redactedValue = "REDACTED"
+
+// redacted returns a copy of the configuration that is safe to expose, with passwords,
+// secrets and credentials embedded in URLs removed
+func (cfg *config) redacted() *config {
+	c := *cfg
+	for _, secret := range []*string{&c.ServerPass, &c.APIToken, &c.WebhookSecret, &c.SMTPPass, &c.MQTTPass} {
+		if *secret != "" {
+			*secret = redactedValue
+		}
+	}
+
+	// Webhook URLs often carry tokens in their path or query, so only keep the host
+	c.WebhookURLs = make([]string, len(cfg.WebhookURLs))
+	for i, raw := range cfg.WebhookURLs {
+		c.WebhookURLs[i] = redactURL(raw, true)
+	}
+	c.ServerURL = redactURL(cfg.ServerURL, false)
+	c.MQTTBroker = redactURL(cfg.MQTTBroker, false)
+	return &c
+}
+
+// checkDownloadDirs verifies that download directories are set if a rule looks for files in
+// them. Only commands that check torrents need them, so loadConfig doesn't.
+func (cfg *config) checkDownloadDirs() error {
+	if cfg.VerifyMode != cleaner.VerifyFiles || len(cfg.DownloadDirs) > 0 {
+		return nil
+	}
+	// Without any download directory every file would look missing
+	for _, rule := range cfg.Rules {
+		if rule.ChecksFiles() {
+			return fmt.Errorf("rule %s looks for missing files, but DOWNLOAD_DIRS is not set", rule.Name)
+		}
+	}
+	return nil
+}
+
+// MarshalJSON encodes the configuration with durations in the same format as the environment
+func (cfg *config) MarshalJSON() ([]byte, error) {
+	type plain config
+	return json.Marshal(struct {
+		*plain
+		RunInterval        string `json:"RUN_INTERVAL"`
+		SMTPDigestInterval string `json:"SMTP_DIGEST_INTERVAL"`
+		RecheckTimeout     string `json:"RECHECK_TIMEOUT"`
+		RecheckInterval    string `json:"RECHECK_INTERVAL"`
+	}{
+		plain:              (*plain)(cfg),
+		RunInterval:        cfg.RunInterval.String(),
+		SMTPDigestInterval: cfg.SMTPDigestInterval.String(),
+		RecheckTimeout:     cfg.RecheckTimeout.String(),
+		RecheckInterval:    cfg.RecheckInterval.String(),
+	})
+}
+
+// redactURL strips credentials from a URL. If pathIsSecret is set, any path and
+// query are replaced as well.
+func redactURL(raw string, pathIsSecret bool) string {
+	if raw == "" {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return redactedValue
+	}
+
+	u.User = nil
+	if pathIsSecret && ((u.Path != "" && u.Path != "/") || u.RawQuery != "") {
+		u.Path = "/" + redactedValue
+		u.RawPath = ""
+		u.RawQuery = ""
+	}
+	u.Fragment = ""
+	return u.String()
+}
+
+// envList splits a comma-separated environment variable, dropping empty items
+func envList(name string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// envBool parses an optional boolean environment variable, returning false if unset
+func envBool(name string) (bool, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false: %w", name, err)
+	}
+	return b, nil
+}
+
+// envInt parses an optional integer environment variable, returning zero if unset
+func envInt(name string) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an integer: %w", name, err)
+	}
+	return n, nil
+}
+
+// envFloat parses an optional decimal environment variable, returning zero if unset
+func envFloat(name string) (float64, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0, nil
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a number: %w", name, err)
+	}
+	return f, nil
+}
+
+// envDuration parses an optional duration environment variable such as "30m", returning zero if unset
+func envDuration(name string) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a duration such as 30m or 6h: %w", name, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("%s must not be negative", name)
+	}
+	return d, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/mallox/qbittorrent-cleaner/cleaner"
+	"github.com/mallox/qbittorrent-cleaner/notify"
+	"github.com/mallox/qbittorrent-cleaner/server"
+)
+
+// runDaemon performs a pass every RunInterval until interrupted, serving metrics, health probes and the control API if a listen address is set
+func (a *app) runDaemon() int {
+	cfg, logger := a.cfg, a.logger
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Verifying through qBittorrent needs no download directories, so they may not be mounted
+	var checkDirs func() error
+	if a.cleaner.ChecksDownloadDirs() {
+		checkDirs = a.cleaner.CheckDownloadDirs
+	}
+	a.health = server.NewHealth(cfg.RunInterval, cfg.ReadyMaxIntervals, checkDirs)
+	runs := server.NewRuns(ctx, a.runPass, cfg.APIHistory)
+
+	if cfg.ListenAddr != "" {
+		srv := &server.Server{
+			Metrics: a.metrics.Registry,
+			Health:  a.health,
+			Token:   cfg.APIToken,
+			Runs:    runs,
+			Config:  cfg.redacted(),
+
+			JournalPath: cfg.JournalPath,
+			Orphans:     func(ctx context.Context) ([]cleaner.Orphan, error) { return a.orphans(runs) },
+			Exclusions:  a.cleaner.Exclusions,
+			Pending:     a.cleaner.Pending,
+			SkipFor:     cfg.RunInterval,
+		}
+
+		ln, err := net.Listen("tcp", cfg.ListenAddr)
+		if err != nil {
+			logger.Error("Failed to start HTTP server", "addr", cfg.ListenAddr, "error", err)
+			return exitError
+		}
+
+		httpServer := &http.Server{Handler: srv.Handler(), ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			if err := httpServer.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("HTTP server failed", "error", err)
+			}
+		}()
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			httpServer.Shutdown(shutdownCtx)
+		}()
+		logger.Info("Serving HTTP endpoints", "addr", ln.Addr().String())
+	}
+
+	logger.Info("Running in daemon mode", "interval", cfg.RunInterval)
+	ticker := time.NewTicker(cfg.RunInterval)
+	defer ticker.Stop()
+
+	for {
+		if run := runs.Execute(ctx, server.TriggerSchedule, cleaner.Options{}); run.Status == server.StatusFailed {
+			logger.Error("Cleaning pass failed", "error", run.Error)
+		}
+
+		select {
+		case <-ctx.Done():
+			logger.Info("Shutting down")
+
+			// Deliver digests collected since the last one was sent
+			flushCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			if err := notify.FlushAll(flushCtx, a.notifiers); err != nil {
+				logger.Error("Failed to flush notifications", "error", err)
+			}
+			return exitClean
+		case <-ticker.C:
+		}
+	}
+}
+
+// orphans lists the orphaned files, waiting for any pass in progress since both use the same client session
+func (a *app) orphans(runs *server.Runs) ([]cleaner.Orphan, error) {
+	var orphans []cleaner.Orphan
+	err := runs.Exclusive(func() error {
+		if err := a.cleaner.Client.Login(); err != nil {
+			return fmt.Errorf("failed to login: %w", err)
+		}
+
+		var err error
+		orphans, err = a.cleaner.Orphans()
+		return err
+	})
+	return orphans, err
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// runHealthcheck implements the "healthcheck" subcommand, which probes the daemon's own
+// HTTP server. It lets Docker HEALTHCHECK work in the scratch image, which has no curl.
+func runHealthcheck(cfg *config, args []string) int {
+	fs := flag.NewFlagSet("healthcheck", flag.ContinueOnError)
+	addr := fs.String("addr", cfg.ListenAddr, "address the daemon listens on (default $LISTEN_ADDR)")
+	ready := fs.Bool("ready", false, "probe /readyz instead of /healthz")
+	timeout := fs.Duration("timeout", 5*time.Second, "request timeout")
+	if err := fs.Parse(args); err != nil {
+		return parseExit(err)
+	}
+
+	if *addr == "" {
+		fmt.Println("No listen address configured, set LISTEN_ADDR or pass -addr")
+		return exitUsage
+	}
+
+	host, port, err := net.SplitHostPort(*addr)
+	if err != nil {
+		fmt.Printf("Invalid listen address %q: %v\n", *addr, err)
+		return exitUsage
+	}
+
+	// A wildcard listen address is reachable through loopback
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+
+	path := "/healthz"
+	if *ready {
+		path = "/readyz"
+	}
+
+	client := &http.Client{Timeout: *timeout}
+	resp, err := client.Get("http://" + net.JoinHostPort(host, port) + path)
+	if err != nil {
+		fmt.Printf("Health check failed: %v\n", err)
+		return exitError
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("Health check failed with status: %s\n", resp.Status)
+		return exitError
+	}
+
+	return exitClean
+}
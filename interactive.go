@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mallox/qbittorrent-cleaner/cleaner"
+	"github.com/mallox/qbittorrent-cleaner/report"
+)
+
+// errNotConfirmed aborts a pass whose removals were declined on the confirmation screen
+var errNotConfirmed = errors.New("removals were not confirmed")
+
+// prompter asks on a terminal what to do with each torrent selected for removal
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// newPrompter creates a prompter reading answers from in and writing questions to out
+func newPrompter(in io.Reader, out io.Writer) *prompter {
+	return &prompter{in: bufio.NewReader(in), out: out}
+}
+
+// confirm asks for a decision per candidate, then shows every planned removal for a final
+// confirmation. It implements cleaner.Cleaner.Confirm.
+func (p *prompter) confirm(candidates []cleaner.Removal) (map[string]string, error) {
+	decisions := map[string]string{}
+
+	for i, r := range candidates {
+		fmt.Fprintf(p.out, "\n[%d/%d] %s\n", i+1, len(candidates), r.Name)
+		fmt.Fprintf(p.out, "  Hash:       %s\n", r.Hash)
+		fmt.Fprintf(p.out, "  Save path:  %s\n", r.SavePath)
+		fmt.Fprintf(p.out, "  On disk:    %s\n", report.FormatBytes(r.Size))
+		fmt.Fprintf(p.out, "  Rule:       %s\n", r.Rule)
+		// Only candidates whose files were checked have a list of missing files
+		switch {
+		case len(r.MissingFiles) > 0:
+			fmt.Fprintf(p.out, "  Missing:    %d files\n", len(r.MissingFiles))
+			for _, name := range r.MissingFiles {
+				fmt.Fprintf(p.out, "    %s\n", name)
+			}
+		case r.Missing:
+			fmt.Fprintln(p.out, "  Missing:    data reported missing by qBittorrent")
+		}
+
+		answer, err := p.ask("[k]eep, [r]emove, remove but keep [d]ata, [s]kip all remaining? ", "k", "r", "d", "s")
+		if err != nil {
+			return nil, err
+		}
+
+		if answer == "s" {
+			break
+		}
+		switch answer {
+		case "r":
+			decisions[r.Hash] = cleaner.DecisionRemove
+		case "d":
+			decisions[r.Hash] = cleaner.DecisionRemoveKeepData
+		default:
+			decisions[r.Hash] = cleaner.DecisionKeep
+		}
+	}
+
+	// Show everything that is about to happen before anything is sent to qBittorrent
+	var planned int
+	fmt.Fprintln(p.out, "\nAbout to remove:")
+	for _, r := range candidates {
+		switch decisions[r.Hash] {
+		case cleaner.DecisionRemove:
+			fmt.Fprintf(p.out, "  %s (deleting %s of data)\n", r.Name, report.FormatBytes(r.Size))
+		case cleaner.DecisionRemoveKeepData:
+			fmt.Fprintf(p.out, "  %s (keeping data)\n", r.Name)
+		default:
+			continue
+		}
+		planned++
+	}
+	if planned == 0 {
+		fmt.Fprintln(p.out, "  nothing")
+		return decisions, nil
+	}
+
+	answer, err := p.ask(fmt.Sprintf("Remove %d torrents? [y/N] ", planned), "y", "n", "")
+	if err != nil {
+		return nil, err
+	}
+	if answer != "y" {
+		return nil, errNotConfirmed
+	}
+	return decisions, nil
+}
+
+// ask prints a question until one of the choices is answered. The first letter of an answer counts.
+func (p *prompter) ask(question string, choices ...string) (string, error) {
+	for {
+		fmt.Fprint(p.out, question)
+		line, err := p.in.ReadString('\n')
+		answer := strings.ToLower(strings.TrimSpace(line))
+		if len(answer) > 1 {
+			answer = answer[:1]
+		}
+
+		for _, choice := range choices {
+			if answer == choice {
+				return answer, nil
+			}
+		}
+		if err != nil {
+			// Running out of input must never be taken as consent
+			return "", fmt.Errorf("reading answer failed: %w", err)
+		}
+		fmt.Fprintln(p.out, "Please answer one of:", strings.Join(choices, ", "))
+	}
+}
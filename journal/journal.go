@@ -0,0 +1,162 @@
+// Package journal provides an append-only JSON-lines record of every action the cleaner takes
+package journal
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Outcomes recorded for an action
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailed  = "failed"
+)
+
+// Entry represents a single action recorded in the journal
+type Entry struct {
+	Time         time.Time `json:"time"`
+	RunID        string    `json:"run_id"`
+	Hash         string    `json:"hash"`
+	Name         string    `json:"name"`
+	Category     string    `json:"category,omitempty"`
+	SavePath     string    `json:"save_path"`
+	Rule         string    `json:"rule"`
+	MissingFiles []string  `json:"missing_files,omitempty"`
+	Action       string    `json:"action"`
+	Outcome      string    `json:"outcome"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// Journal appends entries to a JSON-lines file
+type Journal struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// Open opens the journal at path for appending, creating it if needed
+func Open(path string) (*Journal, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("opening journal failed: %w", err)
+	}
+
+	return &Journal{file: file}, nil
+}
+
+// Append writes an entry to the journal. A nil journal discards the entry.
+func (j *Journal) Append(e Entry) error {
+	if j == nil {
+		return nil
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("marshaling journal entry failed: %w", err)
+	}
+	line = append(line, '\n')
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	// Write the entry in a single call so concurrent writers never interleave lines
+	if _, err := j.file.Write(line); err != nil {
+		return fmt.Errorf("writing journal entry failed: %w", err)
+	}
+
+	return nil
+}
+
+// Close closes the underlying journal file
+func (j *Journal) Close() error {
+	if j == nil {
+		return nil
+	}
+
+	return j.file.Close()
+}
+
+// Filter selects journal entries. Zero-valued fields match everything.
+type Filter struct {
+	Since time.Time
+	Until time.Time
+	Hash  string
+	Name  string
+}
+
+// Match reports whether an entry satisfies the filter
+func (f Filter) Match(e Entry) bool {
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+
+	if !f.Until.IsZero() && !e.Time.Before(f.Until) {
+		return false
+	}
+
+	if f.Hash != "" && !strings.EqualFold(e.Hash, f.Hash) {
+		return false
+	}
+
+	// Names are matched as a case-insensitive substring
+	if f.Name != "" && !strings.Contains(strings.ToLower(e.Name), strings.ToLower(f.Name)) {
+		return false
+	}
+
+	return true
+}
+
+// Read returns all entries in the journal at path that match the filter
+func Read(path string, filter Filter) ([]Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening journal failed: %w", err)
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+
+		var e Entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return nil, fmt.Errorf("parsing journal line %d failed: %w", lineNo, err)
+		}
+
+		if filter.Match(e) {
+			entries = append(entries, e)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading journal failed: %w", err)
+	}
+
+	return entries, nil
+}
+
+// NewRunID returns a sortable, unique identifier for a cleaner run
+func NewRunID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+
+	return time.Now().UTC().Format("20060102T150405") + "-" + hex.EncodeToString(b)
+}
@@ -0,0 +1,129 @@
+package journal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestAppendAndRead tests that appended entries can be read back
+func TestAppendAndRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+
+	j, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open journal: %v", err)
+	}
+
+	base := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		{
+			Time:         base,
+			RunID:        "run-1",
+			Hash:         "abcdef123456",
+			Name:         "Test Torrent 1",
+			SavePath:     "/downloads",
+			Rule:         "missing-files",
+			MissingFiles: []string{"file1.txt"},
+			Action:       "delete",
+			Outcome:      OutcomeSuccess,
+		},
+		{
+			Time:    base.Add(24 * time.Hour),
+			RunID:   "run-2",
+			Hash:    "123456abcdef",
+			Name:    "Another Torrent",
+			Rule:    "missing-files",
+			Action:  "delete",
+			Outcome: OutcomeFailed,
+			Error:   "remove torrent failed",
+		},
+	}
+
+	for _, e := range entries {
+		if err := j.Append(e); err != nil {
+			t.Fatalf("Failed to append entry: %v", err)
+		}
+	}
+
+	if err := j.Close(); err != nil {
+		t.Fatalf("Failed to close journal: %v", err)
+	}
+
+	// Reopening must append rather than truncate
+	j, err = Open(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen journal: %v", err)
+	}
+	j.Append(Entry{RunID: "run-3", Hash: "ffff", Name: "Third"})
+	j.Close()
+
+	all, err := Read(path, Filter{})
+	if err != nil {
+		t.Fatalf("Failed to read journal: %v", err)
+	}
+
+	if len(all) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(all))
+	}
+
+	if all[0].MissingFiles[0] != "file1.txt" {
+		t.Errorf("Expected missing file 'file1.txt', got '%v'", all[0].MissingFiles)
+	}
+
+	if all[2].Time.IsZero() {
+		t.Error("Expected Append to set a timestamp on entries without one")
+	}
+}
+
+// TestFilter tests selecting entries by date, hash and name
+func TestFilter(t *testing.T) {
+	base := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	e := Entry{Time: base, Hash: "ABCDEF123456", Name: "Some.Show.S01E01"}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{"empty", Filter{}, true},
+		{"since before", Filter{Since: base.Add(-time.Hour)}, true},
+		{"since after", Filter{Since: base.Add(time.Hour)}, false},
+		{"until after", Filter{Until: base.Add(time.Hour)}, true},
+		{"until equal", Filter{Until: base}, false},
+		{"hash case-insensitive", Filter{Hash: "abcdef123456"}, true},
+		{"hash mismatch", Filter{Hash: "123456"}, false},
+		{"name substring", Filter{Name: "show.s01"}, true},
+		{"name mismatch", Filter{Name: "movie"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.filter.Match(e); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+// TestReadMalformed tests that a corrupt line is reported with its line number
+func TestReadMalformed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	os.WriteFile(path, []byte("{\"hash\":\"a\"}\nnot json\n"), 0o644)
+
+	_, err := Read(path, Filter{})
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected error mentioning line 2, got %v", err)
+	}
+}
+
+// TestNilJournal tests that a nil journal silently discards entries
+func TestNilJournal(t *testing.T) {
+	var j *Journal
+	if err := j.Append(Entry{Hash: "abc"}); err != nil {
+		t.Errorf("Expected nil journal to discard entries, got %v", err)
+	}
+	if err := j.Close(); err != nil {
+		t.Errorf("Expected nil journal to close cleanly, got %v", err)
+	}
+}
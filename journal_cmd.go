@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mallox/qbittorrent-cleaner/journal"
+)
+
+// runJournal implements the "journal" subcommand, which queries the audit journal
+func runJournal(cfg *config, args []string) int {
+	fs := flag.NewFlagSet("journal", flag.ContinueOnError)
+	path := fs.String("file", cfg.JournalPath, "path to the journal file (default $JOURNAL_PATH)")
+	since := fs.String("since", "", "only show entries at or after this date (YYYY-MM-DD or RFC3339)")
+	until := fs.String("until", "", "only show entries before the end of this date (YYYY-MM-DD or RFC3339)")
+	hash := fs.String("hash", "", "only show entries for this torrent hash")
+	name := fs.String("name", "", "only show entries whose torrent name contains this text")
+	asJSON := fs.Bool("json", false, "print matching entries as JSON lines")
+	if err := fs.Parse(args); err != nil {
+		return parseExit(err)
+	}
+
+	if *path == "" {
+		fmt.Fprintln(os.Stderr, "No journal configured, set JOURNAL_PATH or pass -file")
+		return exitUsage
+	}
+
+	filter := journal.Filter{Hash: *hash, Name: *name}
+	var err error
+	if *since != "" {
+		if filter.Since, _, err = parseJournalTime(*since); err != nil {
+			fmt.Printf("Invalid -since value: %v\n", err)
+			return exitUsage
+		}
+	}
+	if *until != "" {
+		var dateOnly bool
+		if filter.Until, dateOnly, err = parseJournalTime(*until); err != nil {
+			fmt.Printf("Invalid -until value: %v\n", err)
+			return exitUsage
+		}
+		// A bare date includes the whole day
+		if dateOnly {
+			filter.Until = filter.Until.AddDate(0, 0, 1)
+		}
+	}
+
+	entries, err := journal.Read(*path, filter)
+	if err != nil {
+		fmt.Printf("Failed to read journal: %v\n", err)
+		return exitError
+	}
+
+	for _, e := range entries {
+		if *asJSON {
+			line, _ := json.Marshal(e)
+			fmt.Println(string(line))
+			continue
+		}
+
+		fmt.Printf("%s  %s  %-7s  %-6s  %s  %s\n",
+			e.Time.Local().Format(time.DateTime), e.Hash, e.Outcome, e.Action, e.Rule, e.Name)
+		if len(e.MissingFiles) > 0 {
+			fmt.Printf("    missing: %s\n", strings.Join(e.MissingFiles, ", "))
+		}
+		if e.Error != "" {
+			fmt.Printf("    error: %s\n", e.Error)
+		}
+	}
+
+	return 0
+}
+
+// parseJournalTime parses a date or timestamp and reports whether only a date was given
+func parseJournalTime(value string) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation(time.DateOnly, value, time.Local); err == nil {
+		return t, true, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	return t, false, err
+}
@@ -1,88 +1,294 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
-	"path/filepath"
+	"slices"
 	"strings"
 
+	"github.com/mallox/qbittorrent-cleaner/cleaner"
+	"github.com/mallox/qbittorrent-cleaner/journal"
+	"github.com/mallox/qbittorrent-cleaner/metrics"
+	"github.com/mallox/qbittorrent-cleaner/notify"
+	"github.com/mallox/qbittorrent-cleaner/pending"
 	"github.com/mallox/qbittorrent-cleaner/qbittorrent"
+	"github.com/mallox/qbittorrent-cleaner/report"
+	"github.com/mallox/qbittorrent-cleaner/server"
 )
 
+// Exit codes reported by the cleaner, in increasing order of severity for a completed run
+const (
+	exitClean   = 0 // Run completed and nothing was removed
+	exitError   = 1 // Run could not complete, e.g. login or listing torrents failed
+	exitUsage   = 2 // Invalid configuration or command line
+	exitRemoved = 3 // Run completed and at least one torrent was removed, or would be by a check
+	exitPartial = 4 // Some torrents could not be checked or removed
+	exitAborted = 5 // Run was aborted by a safety check and nothing was removed
+)
+
+// app holds everything needed to perform passes
+type app struct {
+	cfg       *config
+	cleaner   *cleaner.Cleaner
+	metrics   *metrics.Metrics
+	notifiers []notify.Notifier
+	health    *server.Health
+	logger    *slog.Logger
+}
+
+// command is a subcommand of the binary
+type command struct {
+	name    string
+	summary string
+	run     func(cfg *config, args []string) int
+}
+
+// commands lists the subcommands in the order they are shown in the usage
+var commands = []command{
+	{"clean", "apply the cleanup rules to all torrents (default)", runClean},
+	{"check", "report the torrents that would be removed without removing them", runCheck},
+	{"list", "list all torrents with their health status", runList},
+	{"explain", "explain why a torrent would or would not be removed", runExplain},
+	{"orphans", "list files in the download directories that belong to no torrent", runOrphans},
+	{"restore", "add removed torrents back from their backed up .torrent files", runRestore},
+	{"journal", "query the audit journal", runJournal},
+	{"pending", "list, approve or reject staged removals", runPending},
+	{"healthcheck", "probe the daemon's health endpoints", runHealthcheck},
+}
+
 func main() {
-	// Get environment variables
-	downloadDirsStr := os.Getenv("DOWNLOAD_DIRS")
-	downloadDirs := strings.Split(downloadDirsStr, ",")
+	// Without a subcommand, or with only flags, the cleaner cleans as it always has
+	name, args := "clean", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
 
-	serverURL := os.Getenv("SERVER_URL")
-	serverUser := os.Getenv("SERVER_USER")
-	serverPass := os.Getenv("SERVER_PASS")
+	if name == "help" {
+		usage(os.Stdout)
+		os.Exit(exitClean)
+	}
 
-	// Create qBittorrent client
-	client := qbittorrent.NewClient(serverURL, serverUser, serverPass)
+	i := slices.IndexFunc(commands, func(c command) bool { return c.name == name })
+	if i < 0 {
+		fmt.Printf("Unknown command %q\n\n", name)
+		usage(os.Stdout)
+		os.Exit(exitUsage)
+	}
 
-	// Login to qBittorrent
-	if err := client.Login(); err != nil {
-		fmt.Printf("Failed to login: %v\n", err)
-		os.Exit(1)
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Invalid configuration: %v\n", err)
+		os.Exit(exitUsage)
+	}
+
+	os.Exit(commands[i].run(cfg, args))
+}
+
+// usage prints the available subcommands
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: qbt-clean [command] [flags]")
+	fmt.Fprintln(w, "\nCommands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-12s %s\n", c.name, c.summary)
 	}
+	fmt.Fprintln(w, "\nRun 'qbt-clean <command> -h' for the flags of a command. Settings are read from the environment.")
+}
 
-	// List torrents
-	torrents, err := client.ListTorrents()
+// newApp sets up logging, notifications, the journal and the qBittorrent client shared by
+// all commands that talk to qBittorrent. Logs are written to logOut. On failure the
+// error has been reported and the exit code is returned.
+func newApp(cfg *config, logOut io.Writer) (*app, int) {
+	// Set up logging first so every later failure is reported consistently
+	logger, err := newLogger(logOut, cfg.LogLevel, cfg.LogFormat)
 	if err != nil {
-		fmt.Printf("Failed to list torrents: %v\n", err)
-		os.Exit(1)
+		fmt.Printf("Failed to configure logging: %v\n", err)
+		return nil, exitUsage
 	}
+	slog.SetDefault(logger)
 
-	if len(torrents) == 0 {
-		fmt.Println("No torrents found")
-		os.Exit(0)
+	if err := cfg.checkDownloadDirs(); err != nil {
+		logger.Error("Invalid configuration", "error", err)
+		return nil, exitUsage
 	}
 
-	// Process each torrent
-	for _, torrent := range torrents {
-		// Skip incomplete torrents unless they're in moving or error state
-		if torrent.AmountLeft > 0 && torrent.State != "moving" && torrent.State != "error" {
-			fmt.Printf("Skipping because it's not complete: %s\n", torrent.Name)
-			continue
-		}
+	notifiers, err := newNotifiers(cfg)
+	if err != nil {
+		logger.Error("Invalid notification configuration", "error", err)
+		return nil, exitUsage
+	}
 
-		// Get files for this torrent
-		files, err := client.TorrentFiles(torrent.Hash)
+	// Open the audit journal if one is configured
+	var audit *journal.Journal
+	if cfg.JournalPath != "" {
+		audit, err = journal.Open(cfg.JournalPath)
 		if err != nil {
-			fmt.Printf("Failed to get files for torrent %s: %v\n", torrent.Name, err)
-			continue
+			logger.Error("Failed to open journal", "path", cfg.JournalPath, "error", err)
+			return nil, exitError
 		}
+	}
+
+	exclusions, err := cleaner.LoadExclusions(cfg.ExclusionsPath)
+	if err != nil {
+		logger.Error("Failed to load exclusions", "path", cfg.ExclusionsPath, "error", err)
+		audit.Close()
+		return nil, exitError
+	}
+
+	sightings, err := cleaner.LoadSightings(cfg.SightingsPath)
+	if err != nil {
+		logger.Error("Failed to load sightings", "path", cfg.SightingsPath, "error", err)
+		audit.Close()
+		return nil, exitError
+	}
+
+	rechecks, err := cleaner.LoadRechecks(cfg.RecheckStatePath)
+	if err != nil {
+		logger.Error("Failed to load rechecks", "path", cfg.RecheckStatePath, "error", err)
+		audit.Close()
+		return nil, exitError
+	}
+
+	// Create qBittorrent client
+	m := metrics.New()
+	client := qbittorrent.NewClient(cfg.ServerURL, cfg.ServerUser, cfg.ServerPass)
+	client.Logger = logger
+	client.Observer = m
+
+	c := cleaner.New(client, cfg.DownloadDirs)
+	c.Rules = cfg.Rules
+	c.LibraryDirs = cfg.LibraryDirs
+	c.Protections = cfg.HNRProtections
+	c.ProtectedTag = cfg.HNRTag
+	c.UnregisteredPatterns = cfg.UnregisteredPatterns
+	c.Verify = cfg.VerifyMode
+	c.Recheck = cfg.VerifyRecheck
+	c.RecheckTimeout = cfg.RecheckTimeout
+	c.RecheckBatch = cfg.RecheckBatch
+	c.RecheckMax = cfg.RecheckMax
+	c.RecheckInterval = cfg.RecheckInterval
+	c.Rechecks = rechecks
+	c.Sightings = sightings
+	c.Journal = audit
+	c.Exclusions = exclusions
+	if cfg.PendingPath != "" {
+		c.Pending = pending.Open(cfg.PendingPath)
+	}
+	c.BackupDir = cfg.BackupDir
+	c.Logger = logger
+	c.MaxRemovals = cfg.MaxRemovals
+	c.MaxRemovalPercent = cfg.MaxRemovalPercent
 
-		missing := false
-		for _, file := range files {
-			// Skip files that are not downloaded
-			if file.Priority == 0 {
-				continue
-			}
-
-			// Check if file exists in any download directory
-			found := false
-			for _, dir := range downloadDirs {
-				filePath := filepath.Join(dir, file.Name)
-				if _, err := os.Stat(filePath); err == nil {
-					found = true
-					break
-				}
-			}
-
-			if !found {
-				fmt.Printf("File %s is missing for %s -> REMOVING\n", file.Name, torrent.Name)
-				missing = true
-				if err := client.RemoveTorrent(torrent.Hash, true); err != nil {
-					fmt.Printf("Failed to remove torrent %s: %v\n", torrent.Name, err)
-				}
-				break
-			}
+	return &app{
+		cfg:       cfg,
+		cleaner:   c,
+		metrics:   m,
+		notifiers: notifiers,
+		logger:    logger,
+	}, exitClean
+}
+
+// close releases the resources held by the app
+func (a *app) close() {
+	if err := a.cleaner.Journal.Close(); err != nil {
+		a.logger.Error("Failed to close journal", "error", err)
+	}
+}
+
+// login logs in to qBittorrent, reporting a failure
+func (a *app) login() error {
+	if err := a.cleaner.Client.Login(); err != nil {
+		a.logger.Error("Failed to login", "error", err)
+		return err
+	}
+	return nil
+}
+
+// runOnce performs a single pass and returns the exit code describing its outcome
+func (a *app) runOnce() int {
+	ctx := context.Background()
+	summary, err := a.runPass(ctx, cleaner.Options{})
+
+	// Nothing outlives this run, so deliver any batched digests now
+	if err := notify.FlushAll(ctx, a.notifiers); err != nil {
+		a.logger.Error("Failed to flush notifications", "error", err)
+	}
+
+	// Leave the metrics for the node_exporter textfile collector, even if the pass failed
+	if a.cfg.MetricsTextfile != "" {
+		if err := a.metrics.WriteTextfile(a.cfg.MetricsTextfile); err != nil {
+			a.logger.Error("Failed to write metrics textfile", "path", a.cfg.MetricsTextfile, "error", err)
 		}
+	}
+
+	if err != nil {
+		a.logger.Error("Cleaning pass failed", "error", err)
+		return exitError
+	}
+
+	return exitCode(summary)
+}
+
+// runPass logs in, performs a pass, then reports, records and announces its outcome.
+// Dry runs only return their summary, since nothing was removed.
+func (a *app) runPass(ctx context.Context, opts cleaner.Options) (*cleaner.Summary, error) {
+	// Login to qBittorrent
+	err := a.cleaner.Client.Login()
+	a.health.RecordLogin(err)
+	if err != nil {
+		a.metrics.ObserveError()
+		return nil, fmt.Errorf("failed to login: %w", err)
+	}
+
+	summary, err := a.cleaner.Run(opts)
+	if err != nil {
+		a.metrics.ObserveError()
+		return nil, err
+	}
+	if opts.DryRun {
+		return summary, nil
+	}
+	a.metrics.ObserveRun(summary)
+	a.health.RecordPass(summary.Finished)
+
+	if err := writeReport(a.cfg.ReportPath, a.cfg.ReportFormat, summary); err != nil {
+		a.logger.Error("Failed to write report", "path", a.cfg.ReportPath, "error", err)
+	}
 
-		if !missing {
-			fmt.Printf("All files are present for %s\n", torrent.Name)
+	if err := notify.NotifyAll(ctx, a.notifiers, summary); err != nil {
+		a.logger.Error("Failed to send notifications", "error", err)
+	}
+
+	return summary, nil
+}
+
+// exitCode maps the outcome of a pass to the most severe exit code that applies
+func exitCode(summary *cleaner.Summary) int {
+	switch {
+	case summary.Aborted:
+		return exitAborted
+	case summary.Failed > 0:
+		return exitPartial
+	case summary.Removed > 0, summary.DryRun && len(summary.Candidates) > 0:
+		return exitRemoved
+	default:
+		return exitClean
+	}
+}
+
+// writeReport renders the run summary to the report path, or to stdout if none is set
+func writeReport(path, format string, summary *cleaner.Summary) error {
+	var w io.Writer = os.Stdout
+	if path != "" {
+		file, err := os.Create(path)
+		if err != nil {
+			return err
 		}
+		defer file.Close()
+		w = file
 	}
+
+	return report.Write(w, format, summary)
 }
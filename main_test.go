@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mallox/qbittorrent-cleaner/cleaner"
+)
+
+// clearEnv empties the environment for the duration of a test
+func clearEnv(t *testing.T) {
+	saved := os.Environ()
+	os.Clearenv()
+	t.Cleanup(func() {
+		os.Clearenv()
+		for _, kv := range saved {
+			name, value, _ := strings.Cut(kv, "=")
+			os.Setenv(name, value)
+		}
+	})
+}
+
+// TestCommandsWithoutDownloadDirs tests that commands that don't check torrents work with an empty environment
+func TestCommandsWithoutDownloadDirs(t *testing.T) {
+	clearEnv(t)
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("Expected an empty environment to load, got %v", err)
+	}
+	if err := cfg.checkDownloadDirs(); err == nil {
+		t.Error("Expected commands that check torrents to require DOWNLOAD_DIRS")
+	}
+
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatalf("Failed to write journal: %v", err)
+	}
+	if code := runJournal(cfg, []string{"-file", path}); code != exitClean {
+		t.Errorf("Expected journal to succeed, got exit code %d", code)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	if code := runHealthcheck(cfg, []string{"-addr", strings.TrimPrefix(srv.URL, "http://")}); code != exitClean {
+		t.Errorf("Expected healthcheck to succeed, got exit code %d", code)
+	}
+}
+
+// TestNotifiersInvalidAddress tests that SMTP addresses are checked when the configuration is loaded
+func TestNotifiersInvalidAddress(t *testing.T) {
+	clearEnv(t)
+	os.Setenv("SMTP_HOST", "mail.example.com")
+	os.Setenv("SMTP_FROM", "cleaner@example.com")
+	os.Setenv("SMTP_TO", "admin@example.com, not an address")
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if _, err := newNotifiers(cfg); err == nil || !strings.Contains(err.Error(), "SMTP_TO") {
+		t.Errorf("Expected an invalid SMTP_TO address to be rejected, got %v", err)
+	}
+
+	cfg.SMTPTo = []string{"admin@example.com"}
+	if _, err := newNotifiers(cfg); err != nil {
+		t.Errorf("Expected valid addresses to be accepted, got %v", err)
+	}
+}
+
+// TestPrompterReason tests that candidates without a list of missing files show why they were selected
+func TestPrompterReason(t *testing.T) {
+	var out strings.Builder
+	p := newPrompter(strings.NewReader("k\nk\nk\n"), &out)
+	_, err := p.confirm([]cleaner.Removal{
+		{Hash: "aaa", Name: "Files", Rule: cleaner.RuleMissingFiles, MissingFiles: []string{"a.bin"}, Missing: true},
+		{Hash: "bbb", Name: "State", Rule: cleaner.RuleMissingFiles, MissingFiles: []string{}, Missing: true},
+		{Hash: "ccc", Name: "Ratio", Rule: "ratio", MissingFiles: []string{}},
+	})
+	if err != nil {
+		t.Fatalf("confirm failed: %v", err)
+	}
+
+	text := out.String()
+	if strings.Count(text, "Missing:    1 files") != 1 || strings.Contains(text, "0 files") {
+		t.Errorf("Expected a file count only for the file-based candidate, got:\n%s", text)
+	}
+	if !strings.Contains(text, "data reported missing by qBittorrent") || !strings.Contains(text, "Rule:       ratio") {
+		t.Errorf("Expected the reason for the other candidates, got:\n%s", text)
+	}
+}
+
+// TestCommandsHelp tests that asking a command for its usage is not an error
+func TestCommandsHelp(t *testing.T) {
+	clearEnv(t)
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	for _, c := range commands {
+		if code := c.run(cfg, []string{"-h"}); code != exitClean {
+			t.Errorf("Expected %s -h to exit with %d, got %d", c.name, exitClean, code)
+		}
+		if code := c.run(cfg, []string{"-no-such-flag"}); code != exitUsage {
+			t.Errorf("Expected %s with an unknown flag to exit with %d, got %d", c.name, exitUsage, code)
+		}
+	}
+}
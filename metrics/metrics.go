@@ -0,0 +1,131 @@
+package metrics
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mallox/qbittorrent-cleaner/cleaner"
+)
+
+// Run results reported by the runs counter
+const (
+	ResultSuccess = "success"
+	ResultAborted = "aborted"
+	ResultError   = "error"
+)
+
+// Metrics holds the cleaner's metrics
+type Metrics struct {
+	Registry *Registry
+
+	runs            *CounterVec
+	checked         *CounterVec
+	missing         *GaugeVec
+	removed         *CounterVec
+	failed          *CounterVec
+	reclaimed       *CounterVec
+	requestDuration *HistogramVec
+	requestErrors   *CounterVec
+	lastSuccess     *GaugeVec
+	passDuration    *GaugeVec
+}
+
+// New creates the cleaner's metrics in a fresh registry
+func New() *Metrics {
+	r := NewRegistry()
+	return &Metrics{
+		Registry: r,
+		runs: r.NewCounterVec("qbt_clean_runs_total",
+			"Cleaning passes by result.", "result"),
+		checked: r.NewCounterVec("qbt_clean_torrents_checked_total",
+			"Torrents whose files were checked."),
+		missing: r.NewGaugeVec("qbt_clean_torrents_missing_files",
+			"Torrents with missing files found by the last pass."),
+		removed: r.NewCounterVec("qbt_clean_torrents_removed_total",
+			"Torrents removed, by the rule that triggered the removal.", "reason"),
+		failed: r.NewCounterVec("qbt_clean_torrents_failed_total",
+			"Torrents that could not be checked or removed, by stage.", "stage"),
+		reclaimed: r.NewCounterVec("qbt_clean_reclaimed_bytes_total",
+			"Bytes of data deleted together with removed torrents."),
+		requestDuration: r.NewHistogramVec("qbt_clean_api_request_duration_seconds",
+			"Latency of qBittorrent WebUI API requests, by endpoint.", DefaultBuckets, "endpoint"),
+		requestErrors: r.NewCounterVec("qbt_clean_api_request_errors_total",
+			"Failed qBittorrent WebUI API requests, by endpoint.", "endpoint"),
+		lastSuccess: r.NewGaugeVec("qbt_clean_last_success_timestamp_seconds",
+			"Unix time at which the last pass completed without being aborted."),
+		passDuration: r.NewGaugeVec("qbt_clean_pass_duration_seconds",
+			"Duration of the last pass in seconds."),
+	}
+}
+
+// ObserveRun records the outcome of a completed pass
+func (m *Metrics) ObserveRun(s *cleaner.Summary) {
+	m.checked.Add(float64(s.Checked))
+	m.missing.Set(float64(s.Missing))
+	m.reclaimed.Add(float64(s.BytesReclaimed))
+	m.passDuration.Set(s.Duration().Seconds())
+
+	for _, r := range s.Removals {
+		m.removed.Inc(r.Rule)
+	}
+	for _, f := range s.Failures {
+		m.failed.Inc(f.Stage)
+	}
+
+	if s.Aborted {
+		m.runs.Inc(ResultAborted)
+		return
+	}
+	m.runs.Inc(ResultSuccess)
+	m.lastSuccess.Set(float64(s.Finished.Unix()))
+}
+
+// ObserveError records a pass that could not complete
+func (m *Metrics) ObserveError() {
+	m.runs.Inc(ResultError)
+}
+
+// ObserveRequest records the latency and outcome of a qBittorrent API request
+func (m *Metrics) ObserveRequest(endpoint string, duration time.Duration, err error) {
+	m.requestDuration.Observe(duration.Seconds(), endpoint)
+	if err != nil {
+		m.requestErrors.Inc(endpoint)
+	}
+}
+
+// WriteTextfile writes the metrics to path in the node_exporter textfile collector format.
+// If this process has not completed a successful pass, the last success timestamp is
+// carried over from the previous file so that a failed run does not erase it.
+func (m *Metrics) WriteTextfile(path string) error {
+	if _, ok := m.lastSuccess.Value(); !ok {
+		if previous, ok := readSample(path, "qbt_clean_last_success_timestamp_seconds"); ok {
+			m.lastSuccess.Set(previous)
+		}
+	}
+
+	return m.Registry.WriteFile(path)
+}
+
+// readSample returns the value of an unlabelled sample from a metrics file
+func readSample(path, name string) (float64, bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, false
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || fields[0] != name {
+			continue
+		}
+
+		value, err := strconv.ParseFloat(fields[1], 64)
+		return value, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,144 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mallox/qbittorrent-cleaner/cleaner"
+)
+
+// scrape fetches the metrics page from a local server the way Prometheus would
+func scrape(t *testing.T, m *Metrics) string {
+	server := httptest.NewServer(m.Registry)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to scrape metrics: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected content type '%s'", ct)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
+
+// TestObserveRun tests the metrics recorded for completed and aborted passes
+func TestObserveRun(t *testing.T) {
+	m := New()
+	finished := time.Unix(1700000000, 0)
+
+	m.ObserveRun(&cleaner.Summary{
+		Started:  finished.Add(-2 * time.Second),
+		Finished: finished,
+		Counts:   cleaner.Counts{Checked: 10, Missing: 3, Removed: 2, Failed: 1, BytesReclaimed: 4096},
+		Removals: []cleaner.Removal{{Rule: cleaner.RuleMissingFiles}, {Rule: cleaner.RuleMissingFiles}},
+		Failures: []cleaner.Failure{{Stage: cleaner.StageRemove}},
+	})
+	m.ObserveRun(&cleaner.Summary{Started: finished, Finished: finished.Add(time.Second), Aborted: true})
+	m.ObserveError()
+
+	out := scrape(t, m)
+	for _, want := range []string{
+		`qbt_clean_runs_total{result="success"} 1`,
+		`qbt_clean_runs_total{result="aborted"} 1`,
+		`qbt_clean_runs_total{result="error"} 1`,
+		`qbt_clean_torrents_checked_total 10`,
+		`qbt_clean_torrents_missing_files 0`,
+		`qbt_clean_torrents_removed_total{reason="missing-files"} 2`,
+		`qbt_clean_torrents_failed_total{stage="remove"} 1`,
+		`qbt_clean_reclaimed_bytes_total 4096`,
+		`qbt_clean_last_success_timestamp_seconds 1.7e+09`,
+		`qbt_clean_pass_duration_seconds 1`,
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("Expected scrape to contain '%s', got:\n%s", want, out)
+		}
+	}
+}
+
+// TestObserveRequest tests API latency and error metrics
+func TestObserveRequest(t *testing.T) {
+	m := New()
+	m.ObserveRequest("torrents/info", 20*time.Millisecond, nil)
+	m.ObserveRequest("torrents/delete", 2*time.Second, errors.New("unexpected status: 500"))
+
+	out := scrape(t, m)
+	for _, want := range []string{
+		`qbt_clean_api_request_duration_seconds_bucket{endpoint="torrents/info",le="0.025"} 1`,
+		`qbt_clean_api_request_duration_seconds_count{endpoint="torrents/delete"} 1`,
+		`qbt_clean_api_request_errors_total{endpoint="torrents/delete"} 1`,
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("Expected scrape to contain '%s', got:\n%s", want, out)
+		}
+	}
+
+	if strings.Contains(out, `qbt_clean_api_request_errors_total{endpoint="torrents/info"}`) {
+		t.Error("Expected no error series for successful requests")
+	}
+}
+
+// TestWriteTextfile tests the textfile output and that a failed run keeps the last success timestamp
+func TestWriteTextfile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "qbt_clean.prom")
+	finished := time.Unix(1700000000, 0)
+
+	m := New()
+	m.ObserveRun(&cleaner.Summary{
+		Started:  finished.Add(-3 * time.Second),
+		Finished: finished,
+		Counts:   cleaner.Counts{Checked: 5, Removed: 1},
+		Removals: []cleaner.Removal{{Rule: cleaner.RuleMissingFiles}},
+	})
+	if err := m.WriteTextfile(path); err != nil {
+		t.Fatalf("Failed to write textfile: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read textfile: %v", err)
+	}
+	for _, want := range []string{
+		"qbt_clean_torrents_checked_total 5\n",
+		`qbt_clean_torrents_removed_total{reason="missing-files"} 1` + "\n",
+		"qbt_clean_pass_duration_seconds 3\n",
+		"qbt_clean_last_success_timestamp_seconds 1.7e+09\n",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Expected textfile to contain '%s', got:\n%s", want, data)
+		}
+	}
+
+	// A later run that fails must not lose the previous success timestamp
+	failed := New()
+	failed.ObserveError()
+	if err := failed.WriteTextfile(path); err != nil {
+		t.Fatalf("Failed to write textfile: %v", err)
+	}
+
+	data, _ = os.ReadFile(path)
+	if !strings.Contains(string(data), "qbt_clean_last_success_timestamp_seconds 1.7e+09\n") {
+		t.Errorf("Expected last success timestamp to be carried over, got:\n%s", data)
+	}
+	if !strings.Contains(string(data), `qbt_clean_runs_total{result="error"} 1`) {
+		t.Errorf("Expected failed run to be recorded, got:\n%s", data)
+	}
+
+	// No temporary files may be left behind
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Expected only the textfile in %s, found %d entries", dir, len(entries))
+	}
+}
@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestWriteTo tests the text exposition format of each metric type
+func TestWriteTo(t *testing.T) {
+	r := NewRegistry()
+	counter := r.NewCounterVec("test_requests_total", "Requests handled.", "code")
+	gauge := r.NewGaugeVec("test_temperature", "Current temperature.")
+	histogram := r.NewHistogramVec("test_latency_seconds", "Request latency.", []float64{1, 0.1}, "path")
+
+	counter.Inc("200")
+	counter.Add(2, "200")
+	counter.Inc("500")
+	gauge.Set(21.5)
+	histogram.Observe(0.05, "/a")
+	histogram.Observe(0.5, "/a")
+	histogram.Observe(5, "/a")
+
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		t.Fatalf("Failed to write metrics: %v", err)
+	}
+
+	want := `# HELP test_requests_total Requests handled.
+# TYPE test_requests_total counter
+test_requests_total{code="200"} 3
+test_requests_total{code="500"} 1
+# HELP test_temperature Current temperature.
+# TYPE test_temperature gauge
+test_temperature 21.5
+# HELP test_latency_seconds Request latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{path="/a",le="0.1"} 1
+test_latency_seconds_bucket{path="/a",le="1"} 2
+test_latency_seconds_bucket{path="/a",le="+Inf"} 3
+test_latency_seconds_sum{path="/a"} 5.55
+test_latency_seconds_count{path="/a"} 3
+`
+	if buf.String() != want {
+		t.Errorf("Unexpected exposition output:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+// TestLabelEscaping tests that label values are escaped
+func TestLabelEscaping(t *testing.T) {
+	r := NewRegistry()
+	r.NewGaugeVec("test_info", "Info.", "name").Set(1, "a \"quoted\"\\path\nnext")
+
+	var buf bytes.Buffer
+	r.WriteTo(&buf)
+
+	if !strings.Contains(buf.String(), `test_info{name="a \"quoted\"\\path\nnext"} 1`) {
+		t.Errorf("Expected escaped label value, got:\n%s", buf.String())
+	}
+}
+
+// TestLabelCountMismatch tests that using the wrong number of label values panics
+func TestLabelCountMismatch(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a panic for a label count mismatch")
+		}
+	}()
+
+	NewRegistry().NewCounterVec("test_total", "Test.", "a", "b").Inc("only-one")
+}
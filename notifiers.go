@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"net/mail"
+
+	"github.com/mallox/qbittorrent-cleaner/notify"
+)
+
+// newNotifiers creates the notifiers enabled in the configuration
+func newNotifiers(cfg *config) ([]notify.Notifier, error) {
+	var notifiers []notify.Notifier
+
+	if len(cfg.WebhookURLs) > 0 {
+		w, err := notify.NewWebhook(cfg.WebhookURLs, cfg.WebhookTemplate)
+		if err != nil {
+			return nil, err
+		}
+
+		switch cfg.WebhookEvents {
+		case "", notify.EventRun:
+		case notify.EventRemoval:
+			w.PerRemoval = true
+		default:
+			return nil, fmt.Errorf("WEBHOOK_EVENTS must be %q or %q", notify.EventRun, notify.EventRemoval)
+		}
+
+		if cfg.WebhookContentType != "" {
+			w.ContentType = cfg.WebhookContentType
+		}
+		if cfg.WebhookRetries > 0 {
+			w.Retries = cfg.WebhookRetries
+		}
+		w.Secret = cfg.WebhookSecret
+		w.NotifyEmpty = cfg.WebhookNotifyEmpty
+		notifiers = append(notifiers, w)
+	}
+
+	if cfg.SMTPHost != "" {
+		if cfg.SMTPFrom == "" || len(cfg.SMTPTo) == 0 {
+			return nil, fmt.Errorf("SMTP_FROM and SMTP_TO are required when SMTP_HOST is set")
+		}
+		// An address that can't be parsed would fail every email, so reject it right away
+		if _, err := mail.ParseAddress(cfg.SMTPFrom); err != nil {
+			return nil, fmt.Errorf("SMTP_FROM is invalid: %w", err)
+		}
+		for _, to := range cfg.SMTPTo {
+			if _, err := mail.ParseAddress(to); err != nil {
+				return nil, fmt.Errorf("SMTP_TO address %q is invalid: %w", to, err)
+			}
+		}
+
+		port := cfg.SMTPPort
+		tlsMode := cfg.SMTPTLS
+		switch tlsMode {
+		case "", notify.SMTPStartTLS:
+			tlsMode = notify.SMTPStartTLS
+			if port == 0 {
+				port = 587
+			}
+		case notify.SMTPTLS:
+			if port == 0 {
+				port = 465
+			}
+		case notify.SMTPNone:
+			if port == 0 {
+				port = 25
+			}
+		default:
+			return nil, fmt.Errorf("SMTP_TLS must be %q, %q or %q", notify.SMTPStartTLS, notify.SMTPTLS, notify.SMTPNone)
+		}
+
+		e := notify.NewEmail(cfg.SMTPHost, port, cfg.SMTPFrom, cfg.SMTPTo)
+		e.TLS = tlsMode
+		e.Username = cfg.SMTPUser
+		e.Password = cfg.SMTPPass
+		e.Interval = cfg.SMTPDigestInterval
+		notifiers = append(notifiers, e)
+	}
+
+	if cfg.MQTTBroker != "" {
+		m := notify.NewMQTT(cfg.MQTTBroker)
+		m.Username = cfg.MQTTUser
+		m.Password = cfg.MQTTPass
+		m.DiscoveryPrefix = cfg.MQTTDiscoveryPrefix
+		if cfg.MQTTClientID != "" {
+			m.ClientID = cfg.MQTTClientID
+		}
+		if cfg.MQTTTopic != "" {
+			m.Topic = cfg.MQTTTopic
+		}
+		notifiers = append(notifiers, m)
+	}
+
+	return notifiers, nil
+}
@@ -0,0 +1,360 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/mallox/qbittorrent-cleaner/cleaner"
+)
+
+// TLS modes for connecting to the SMTP server
+const (
+	SMTPStartTLS = "starttls"
+	SMTPTLS      = "tls"
+	SMTPNone     = "none"
+)
+
+// MaxDigestEntries is how many removals, actions, failures and abort reasons a digest
+// keeps of each. While the digest can't be sent, the oldest beyond it are dropped.
+const MaxDigestEntries = 500
+
+// Digest collects the outcome of one or more passes for a single email
+type Digest struct {
+	Since          time.Time
+	Until          time.Time
+	Runs           int
+	Removals       []cleaner.Removal
+	Actions        []cleaner.Removal // Torrents tagged, paused or reported by rules
+	Failures       []cleaner.Failure
+	AbortReasons   []string
+	BytesReclaimed int64
+	Dropped        int // Entries dropped to stay within MaxDigestEntries
+}
+
+// add merges a pass into the digest
+func (d *Digest) add(s *cleaner.Summary) {
+	if d.Runs == 0 {
+		d.Since = s.Started
+	}
+	d.Until = s.Finished
+	d.Runs++
+	d.Removals = append(d.Removals, s.Removals...)
+	d.Actions = append(d.Actions, s.Actions...)
+	d.Failures = append(d.Failures, s.Failures...)
+	d.BytesReclaimed += s.BytesReclaimed
+	if s.Aborted {
+		d.AbortReasons = append(d.AbortReasons, s.AbortReason)
+	}
+
+	var dropped int
+	d.Removals, dropped = keepLast(d.Removals, MaxDigestEntries)
+	d.Dropped += dropped
+	d.Actions, dropped = keepLast(d.Actions, MaxDigestEntries)
+	d.Dropped += dropped
+	d.Failures, dropped = keepLast(d.Failures, MaxDigestEntries)
+	d.Dropped += dropped
+	d.AbortReasons, dropped = keepLast(d.AbortReasons, MaxDigestEntries)
+	d.Dropped += dropped
+}
+
+// keepLast returns the last limit items and how many were dropped before them
+func keepLast[T any](items []T, limit int) ([]T, int) {
+	if len(items) <= limit {
+		return items, 0
+	}
+	dropped := len(items) - limit
+	return slices.Clone(items[dropped:]), dropped
+}
+
+// empty reports whether the digest contains nothing worth sending
+func (d *Digest) empty() bool {
+	return len(d.Removals) == 0 && len(d.Actions) == 0 && len(d.Failures) == 0 && len(d.AbortReasons) == 0
+}
+
+// Email sends a digest of removals over SMTP
+type Email struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	To       []string
+	// TLS is one of SMTPStartTLS, SMTPTLS for implicit TLS, or SMTPNone
+	TLS       string
+	TLSConfig *tls.Config
+	// Interval collects passes into a single digest sent at most this often. Zero sends after every pass.
+	Interval time.Duration
+	Timeout  time.Duration
+
+	mu       sync.Mutex
+	digest   Digest
+	lastSent time.Time
+}
+
+// NewEmail creates an SMTP notifier using STARTTLS
+func NewEmail(host string, port int, from string, to []string) *Email {
+	return &Email{
+		Host:    host,
+		Port:    port,
+		From:    from,
+		To:      to,
+		TLS:     SMTPStartTLS,
+		Timeout: 30 * time.Second,
+	}
+}
+
+// Notify adds the pass to the digest and sends it once the digest interval has passed
+func (e *Email) Notify(ctx context.Context, s *cleaner.Summary) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.lastSent.IsZero() {
+		e.lastSent = s.Started
+	}
+	e.digest.add(s)
+
+	if e.Interval > 0 && s.Finished.Sub(e.lastSent) < e.Interval {
+		return nil
+	}
+	return e.flush(ctx, s.Finished)
+}
+
+// Flush sends any passes collected since the last digest
+func (e *Email) Flush(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.flush(ctx, time.Now())
+}
+
+// flush sends the pending digest, if it contains anything. If sending fails the digest is
+// kept, so the next pass or flush tries again with its passes added. The lock must be held.
+func (e *Email) flush(ctx context.Context, now time.Time) error {
+	if e.digest.empty() {
+		e.digest = Digest{}
+		e.lastSent = now
+		return nil
+	}
+
+	msg, err := e.message(&e.digest)
+	if err != nil {
+		return err
+	}
+	if err := e.send(ctx, msg); err != nil {
+		return err
+	}
+	e.digest = Digest{}
+	e.lastSent = now
+	return nil
+}
+
+// subject returns the subject line for a digest
+func (d *Digest) subject() string {
+	switch {
+	case len(d.AbortReasons) > 0 && len(d.Removals) == 0:
+		return "qbt-clean: run aborted by safety check"
+	case len(d.Failures) > 0:
+		return fmt.Sprintf("qbt-clean: %d torrents removed, %d failed", len(d.Removals), len(d.Failures))
+	default:
+		return fmt.Sprintf("qbt-clean: %d torrents removed", len(d.Removals))
+	}
+}
+
+var emailTextTemplate = template.Must(template.New("text").Funcs(templateFuncs).Parse(
+	`qbt-clean digest for {{.Runs}} run(s) between {{.Since.Format "2006-01-02 15:04"}} and {{.Until.Format "2006-01-02 15:04"}}
+{{range .AbortReasons}}
+Run aborted, nothing was removed: {{.}}
+{{end}}
+Removed {{len .Removals}} torrent(s), reclaiming {{bytes .BytesReclaimed}}.
+{{range .Removals}}
+* {{.Name}} ({{bytes .Size}}, rule {{.Rule}})
+  Hash: {{.Hash}}
+  Missing:{{range .MissingFiles}}
+    - {{.}}{{end}}
+{{end}}{{if .Actions}}
+Rules applied to {{len .Actions}} torrent(s):
+{{range .Actions}}
+* {{.Name}} ({{.Action}}, rule {{.Rule}})
+  Hash: {{.Hash}}{{end}}
+{{end}}{{if .Failures}}
+Failed {{len .Failures}} torrent(s):
+{{range .Failures}}
+* {{.Name}} ({{.Stage}}): {{.Error}}{{end}}
+{{end}}{{if .Dropped}}
+{{.Dropped}} older entries were dropped because earlier digests could not be sent.
+{{end}}`))
+
+var emailHTMLTemplate = htmltemplate.Must(htmltemplate.New("html").Funcs(htmltemplate.FuncMap(templateFuncs)).Parse(
+	`<!DOCTYPE html>
+<html><body style="font-family: sans-serif">
+<h2>qbt-clean digest</h2>
+<p>{{.Runs}} run(s) between {{.Since.Format "2006-01-02 15:04"}} and {{.Until.Format "2006-01-02 15:04"}}</p>
+{{range .AbortReasons}}<p style="color: #b00"><strong>Run aborted, nothing was removed:</strong> {{.}}</p>
+{{end}}<p>Removed <strong>{{len .Removals}}</strong> torrent(s), reclaiming <strong>{{bytes .BytesReclaimed}}</strong>.</p>
+{{if .Removals}}<table border="1" cellpadding="4" cellspacing="0" style="border-collapse: collapse">
+<tr><th>Torrent</th><th>Size</th><th>Rule</th><th>Missing files</th></tr>
+{{range .Removals}}<tr><td>{{.Name}}<br><small>{{.Hash}}</small></td><td>{{bytes .Size}}</td><td>{{.Rule}}</td><td>{{range .MissingFiles}}{{.}}<br>{{end}}</td></tr>
+{{end}}</table>
+{{end}}{{if .Actions}}<h3>Rules applied</h3>
+<ul>
+{{range .Actions}}<li>{{.Name}} <small>{{.Hash}}</small>: {{.Action}} (rule {{.Rule}})</li>
+{{end}}</ul>
+{{end}}{{if .Failures}}<h3>Failures</h3>
+<ul>
+{{range .Failures}}<li>{{.Name}} ({{.Stage}}): {{.Error}}</li>
+{{end}}</ul>
+{{end}}{{if .Dropped}}<p><em>{{.Dropped}} older entries were dropped because earlier digests could not be sent.</em></p>
+{{end}}</body></html>
+`))
+
+// message renders the digest as a MIME message with plain-text and HTML alternatives
+func (e *Email) message(d *Digest) ([]byte, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	id := make([]byte, 12)
+	rand.Read(id)
+	domain := "qbt-clean"
+	if at := strings.LastIndex(e.From, "@"); at >= 0 {
+		domain = strings.Trim(e.From[at+1:], "> ")
+	}
+
+	headers := []string{
+		"From: " + e.From,
+		"To: " + strings.Join(e.To, ", "),
+		"Subject: " + mime.QEncoding.Encode("utf-8", d.subject()),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"Message-ID: <" + hex.EncodeToString(id) + "@" + domain + ">",
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/alternative; boundary=" + mw.Boundary(),
+	}
+	buf.WriteString(strings.Join(headers, "\r\n") + "\r\n\r\n")
+
+	var text, html bytes.Buffer
+	if err := emailTextTemplate.Execute(&text, d); err != nil {
+		return nil, fmt.Errorf("rendering email text failed: %w", err)
+	}
+	if err := emailHTMLTemplate.Execute(&html, d); err != nil {
+		return nil, fmt.Errorf("rendering email HTML failed: %w", err)
+	}
+
+	for _, part := range []struct {
+		contentType string
+		body        []byte
+	}{
+		{"text/plain; charset=utf-8", text.Bytes()},
+		{"text/html; charset=utf-8", html.Bytes()},
+	} {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		qp := quotedprintable.NewWriter(pw)
+		qp.Write(part.body)
+		qp.Close()
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// send delivers a message to all recipients
+func (e *Email) send(ctx context.Context, msg []byte) error {
+	addr := net.JoinHostPort(e.Host, strconv.Itoa(e.Port))
+	tlsConfig := e.TLSConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{ServerName: e.Host}
+	}
+
+	dialer := &net.Dialer{Timeout: e.Timeout}
+	var conn net.Conn
+	var err error
+	if e.TLS == SMTPTLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("connecting to SMTP server failed: %w", err)
+	}
+	if e.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(e.Timeout))
+	}
+
+	c, err := smtp.NewClient(conn, e.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP handshake failed: %w", err)
+	}
+	defer c.Close()
+
+	if e.TLS == SMTPStartTLS || e.TLS == "" {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("SMTP server does not support STARTTLS")
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	}
+
+	if e.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", e.Username, e.Password, e.Host)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+
+	// Envelope addresses must be bare, while headers may carry display names
+	from, err := mail.ParseAddress(e.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender address: %w", err)
+	}
+	if err := c.Mail(from.Address); err != nil {
+		return fmt.Errorf("SMTP MAIL FROM failed: %w", err)
+	}
+	for _, to := range e.To {
+		rcpt, err := mail.ParseAddress(to)
+		if err != nil {
+			return fmt.Errorf("invalid recipient address: %w", err)
+		}
+		if err := c.Rcpt(rcpt.Address); err != nil {
+			return fmt.Errorf("SMTP RCPT TO %s failed: %w", to, err)
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA failed: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("writing email failed: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("sending email failed: %w", err)
+	}
+
+	return c.Quit()
+}
@@ -0,0 +1,372 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mallox/qbittorrent-cleaner/cleaner"
+)
+
+// fakeSMTP is a minimal SMTP server that records the messages it receives
+type fakeSMTP struct {
+	ln        net.Listener
+	tlsConfig *tls.Config
+	startTLS  bool
+
+	mu       sync.Mutex
+	auth     []string
+	from     string
+	rcpts    []string
+	messages []string
+}
+
+// newTestCertificate creates a self-signed certificate for 127.0.0.1
+func newTestCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+// newFakeSMTP starts a fake SMTP server using the given TLS mode
+func newFakeSMTP(t *testing.T, mode string) (*fakeSMTP, *x509.CertPool) {
+	cert, pool := newTestCertificate(t)
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	if mode == SMTPTLS {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+
+	s := &fakeSMTP{ln: ln, tlsConfig: tlsConfig, startTLS: mode == SMTPStartTLS}
+	go s.serve()
+	t.Cleanup(func() { ln.Close() })
+	return s, pool
+}
+
+// port returns the port the server listens on
+func (s *fakeSMTP) port() int {
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+// serve accepts connections until the listener is closed
+func (s *fakeSMTP) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+// handle speaks just enough SMTP for net/smtp to deliver a message
+func (s *fakeSMTP) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+	reply("220 localhost ESMTP fake")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+
+		switch verb {
+		case "EHLO", "HELO":
+			_, isTLS := conn.(*tls.Conn)
+			if s.startTLS && !isTLS {
+				reply("250-localhost")
+				reply("250 STARTTLS")
+			} else {
+				reply("250-localhost")
+				reply("250 AUTH PLAIN")
+			}
+		case "STARTTLS":
+			reply("220 ready to start TLS")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+			r = bufio.NewReader(conn)
+		case "AUTH":
+			s.mu.Lock()
+			s.auth = append(s.auth, line)
+			s.mu.Unlock()
+			reply("235 authenticated")
+		case "MAIL":
+			s.mu.Lock()
+			s.from = line
+			s.mu.Unlock()
+			reply("250 ok")
+		case "RCPT":
+			s.mu.Lock()
+			s.rcpts = append(s.rcpts, line)
+			s.mu.Unlock()
+			reply("250 ok")
+		case "DATA":
+			reply("354 send data")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, data.String())
+			s.mu.Unlock()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+// parseMessage returns the subject and the decoded parts of a received message by content type
+func parseMessage(t *testing.T, raw string) (string, map[string]string) {
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Failed to parse message: %v", err)
+	}
+
+	subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	mediaType, params, _ := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if mediaType != "multipart/alternative" {
+		t.Fatalf("Expected multipart/alternative, got %s", mediaType)
+	}
+
+	parts := map[string]string{}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err != nil {
+			break
+		}
+		body, _ := io.ReadAll(p)
+		contentType, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		parts[contentType] = string(body)
+	}
+	return subject, parts
+}
+
+// testEmail creates an email notifier for the fake server
+func testEmail(s *fakeSMTP, pool *x509.CertPool, mode string) *Email {
+	e := NewEmail("127.0.0.1", s.port(), "qbt-clean <cleaner@example.com>", []string{"alice@example.com", "Bob <bob@example.com>"})
+	e.TLS = mode
+	e.TLSConfig = &tls.Config{RootCAs: pool, ServerName: "127.0.0.1"}
+	e.Username = "cleaner"
+	e.Password = "secret"
+	return e
+}
+
+// TestEmailStartTLS tests delivering a digest over STARTTLS with authentication
+func TestEmailStartTLS(t *testing.T) {
+	s, pool := newFakeSMTP(t, SMTPStartTLS)
+	e := testEmail(s, pool, SMTPStartTLS)
+
+	summary := testSummary()
+	summary.Started = time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	summary.Finished = summary.Started.Add(time.Minute)
+	summary.Failures = []cleaner.Failure{{Name: "Stuck <torrent>", Stage: cleaner.StageRemove, Error: "status 500"}}
+
+	if err := e.Notify(context.Background(), summary); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.messages) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(s.messages))
+	}
+	if len(s.auth) != 1 || !strings.HasPrefix(s.auth[0], "AUTH PLAIN") {
+		t.Errorf("Expected PLAIN authentication, got %v", s.auth)
+	}
+	if s.from != "MAIL FROM:<cleaner@example.com>" {
+		t.Errorf("Unexpected envelope sender '%s'", s.from)
+	}
+	if len(s.rcpts) != 2 || s.rcpts[1] != "RCPT TO:<bob@example.com>" {
+		t.Errorf("Unexpected recipients %v", s.rcpts)
+	}
+
+	subject, parts := parseMessage(t, s.messages[0])
+	if subject != "qbt-clean: 2 torrents removed, 1 failed" {
+		t.Errorf("Unexpected subject '%s'", subject)
+	}
+
+	text := parts["text/plain"]
+	for _, want := range []string{"Removed 2 torrent(s), reclaiming 3.0 KiB", "First \"quoted\"", "- b.mkv", "Stuck <torrent> (remove): status 500"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected plain-text part to contain '%s', got:\n%s", want, text)
+		}
+	}
+
+	html := parts["text/html"]
+	for _, want := range []string{"<table", "First &#34;quoted&#34;", "Stuck &lt;torrent&gt;"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("Expected HTML part to contain '%s', got:\n%s", want, html)
+		}
+	}
+}
+
+// TestEmailImplicitTLS tests delivering over an implicit TLS connection
+func TestEmailImplicitTLS(t *testing.T) {
+	s, pool := newFakeSMTP(t, SMTPTLS)
+	e := testEmail(s, pool, SMTPTLS)
+
+	if err := e.Notify(context.Background(), testSummary()); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.messages) != 1 {
+		t.Errorf("Expected 1 message, got %d", len(s.messages))
+	}
+}
+
+// TestEmailRequiresStartTLS tests that credentials are never sent without STARTTLS support
+func TestEmailRequiresStartTLS(t *testing.T) {
+	s, pool := newFakeSMTP(t, SMTPNone)
+	e := testEmail(s, pool, SMTPStartTLS)
+
+	if err := e.Notify(context.Background(), testSummary()); err == nil {
+		t.Error("Expected an error when the server does not offer STARTTLS")
+	}
+}
+
+// TestEmailRetry tests that a digest that couldn't be sent is kept for the next attempt
+func TestEmailRetry(t *testing.T) {
+	s, pool := newFakeSMTP(t, SMTPNone)
+	e := testEmail(s, pool, SMTPStartTLS)
+
+	if err := e.Notify(context.Background(), testSummary()); err == nil {
+		t.Fatal("Expected an error when the server does not offer STARTTLS")
+	}
+
+	e.TLS = SMTPNone
+	if err := e.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if err := e.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.messages) != 1 {
+		t.Fatalf("Expected the kept digest to be sent once, got %d messages", len(s.messages))
+	}
+	if _, parts := parseMessage(t, s.messages[0]); !strings.Contains(parts["text/plain"], "1 run(s)") {
+		t.Errorf("Expected a digest of the failed run, got:\n%s", parts["text/plain"])
+	}
+}
+
+// TestEmailDigestInterval tests that passes are collected until the interval has passed
+func TestEmailDigestInterval(t *testing.T) {
+	s, pool := newFakeSMTP(t, SMTPStartTLS)
+	e := testEmail(s, pool, SMTPStartTLS)
+	e.Interval = 24 * time.Hour
+
+	start := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	for hour := 0; hour <= 24; hour += 6 {
+		summary := testSummary()
+		summary.Started = start.Add(time.Duration(hour) * time.Hour)
+		summary.Finished = summary.Started.Add(time.Minute)
+		if err := e.Notify(context.Background(), summary); err != nil {
+			t.Fatalf("Notify failed: %v", err)
+		}
+	}
+
+	// Runs without removals do not produce an email on flush
+	e.Notify(context.Background(), &cleaner.Summary{Started: start, Finished: start})
+	if err := e.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.messages) != 1 {
+		t.Fatalf("Expected a single digest, got %d messages", len(s.messages))
+	}
+
+	subject, parts := parseMessage(t, s.messages[0])
+	if subject != "qbt-clean: 10 torrents removed" {
+		t.Errorf("Unexpected subject '%s'", subject)
+	}
+	if !strings.Contains(parts["text/plain"], "5 run(s)") {
+		t.Errorf("Expected digest of 5 runs, got:\n%s", parts["text/plain"])
+	}
+}
+
+// TestDigestCap tests that a digest kept across failed sends drops its oldest entries
+func TestDigestCap(t *testing.T) {
+	var d Digest
+	for i := 0; i < MaxDigestEntries; i++ {
+		d.add(testSummary())
+	}
+	if len(d.Removals) != MaxDigestEntries || d.Dropped != MaxDigestEntries {
+		t.Fatalf("Expected %d removals and as many dropped, got %d, %d", MaxDigestEntries, len(d.Removals), d.Dropped)
+	}
+	if d.Removals[len(d.Removals)-1].Hash != "bbb" || d.Removals[0].Hash != "aaa" {
+		t.Errorf("Expected the newest removals to be kept, got %s first", d.Removals[0].Hash)
+	}
+
+	var text strings.Builder
+	if err := emailTextTemplate.Execute(&text, &d); err != nil {
+		t.Fatalf("Failed to render digest: %v", err)
+	}
+	if !strings.Contains(text.String(), "500 older entries were dropped") {
+		t.Errorf("Expected the digest to note the dropped entries, got:\n%s", text.String())
+	}
+}
@@ -0,0 +1,344 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mallox/qbittorrent-cleaner/cleaner"
+)
+
+// MQTT control packet types used by the publisher
+const (
+	mqttConnect    = 1
+	mqttConnack    = 2
+	mqttPublish    = 3
+	mqttDisconnect = 14
+)
+
+// MQTT publishes run statistics and removal events, with Home Assistant discovery
+type MQTT struct {
+	// Broker is the broker URL, e.g. tcp://localhost:1883 or ssl://broker:8883
+	Broker    string
+	ClientID  string
+	Username  string
+	Password  string
+	TLSConfig *tls.Config
+	// Topic is the prefix for state and event topics
+	Topic string
+	// DiscoveryPrefix enables Home Assistant MQTT discovery under this prefix. Empty disables discovery.
+	DiscoveryPrefix string
+	Timeout         time.Duration
+
+	mu         sync.Mutex
+	discovered bool
+}
+
+// NewMQTT creates an MQTT publisher for the given broker URL
+func NewMQTT(broker string) *MQTT {
+	return &MQTT{
+		Broker:   broker,
+		ClientID: "qbt-clean",
+		Topic:    "qbt-clean",
+		Timeout:  10 * time.Second,
+	}
+}
+
+// mqttMessage is a single message to publish
+type mqttMessage struct {
+	topic   string
+	payload []byte
+	retain  bool
+}
+
+// mqttState is the retained per-run state read by the Home Assistant sensors
+type mqttState struct {
+	LastRun        time.Time `json:"last_run"`
+	RunID          string    `json:"run_id"`
+	Aborted        bool      `json:"aborted"`
+	Checked        int       `json:"checked"`
+	Missing        int       `json:"missing"`
+	Removed        int       `json:"removed"`
+	Failed         int       `json:"failed"`
+	BytesReclaimed int64     `json:"bytes_reclaimed"`
+	Duration       float64   `json:"duration_seconds"`
+}
+
+// StateTopic returns the topic the retained run state is published to
+func (m *MQTT) StateTopic() string {
+	return m.Topic + "/state"
+}
+
+// RemovalTopic returns the topic removal events are published to
+func (m *MQTT) RemovalTopic() string {
+	return m.Topic + "/removal"
+}
+
+// Notify publishes the run state and one event per removed torrent
+func (m *MQTT) Notify(ctx context.Context, s *cleaner.Summary) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var messages []mqttMessage
+
+	// Discovery configs are retained by the broker, so publishing them once per process is enough
+	if m.DiscoveryPrefix != "" && !m.discovered {
+		messages = append(messages, m.discoveryMessages()...)
+	}
+
+	state, err := json.Marshal(mqttState{
+		LastRun:        s.Finished,
+		RunID:          s.RunID,
+		Aborted:        s.Aborted,
+		Checked:        s.Checked,
+		Missing:        s.Missing,
+		Removed:        s.Removed,
+		Failed:         s.Failed,
+		BytesReclaimed: s.BytesReclaimed,
+		Duration:       s.Duration().Seconds(),
+	})
+	if err != nil {
+		return err
+	}
+	messages = append(messages, mqttMessage{topic: m.StateTopic(), payload: state, retain: true})
+
+	for _, r := range s.Removals {
+		payload, err := json.Marshal(Event{Type: EventRemoval, Removal: &r})
+		if err != nil {
+			return err
+		}
+		messages = append(messages, mqttMessage{topic: m.RemovalTopic(), payload: payload})
+	}
+
+	if err := m.publish(ctx, messages); err != nil {
+		return err
+	}
+	m.discovered = true
+	return nil
+}
+
+// haSensor describes a Home Assistant sensor read from the state topic
+type haSensor struct {
+	id          string
+	name        string
+	template    string
+	deviceClass string
+	unit        string
+	stateClass  string
+}
+
+var haSensors = []haSensor{
+	{id: "last_run", name: "Last run", template: "{{ value_json.last_run }}", deviceClass: "timestamp"},
+	{id: "torrents_removed", name: "Torrents removed", template: "{{ value_json.removed }}", stateClass: "measurement"},
+	{id: "missing_torrents", name: "Missing torrents", template: "{{ value_json.missing }}", stateClass: "measurement"},
+	{id: "failed_torrents", name: "Failed torrents", template: "{{ value_json.failed }}", stateClass: "measurement"},
+	{id: "bytes_reclaimed", name: "Reclaimed", template: "{{ value_json.bytes_reclaimed }}", deviceClass: "data_size", unit: "B", stateClass: "measurement"},
+}
+
+// discoveryMessages returns the retained Home Assistant discovery configs for each sensor
+func (m *MQTT) discoveryMessages() []mqttMessage {
+	nodeID := strings.NewReplacer("/", "_", " ", "_", "-", "_").Replace(m.ClientID)
+	device := map[string]any{
+		"identifiers":  []string{nodeID},
+		"name":         "qbt-clean",
+		"manufacturer": "qbittorrent-cleaner",
+	}
+
+	var messages []mqttMessage
+	for _, sensor := range haSensors {
+		config := map[string]any{
+			"name":           sensor.name,
+			"unique_id":      nodeID + "_" + sensor.id,
+			"object_id":      nodeID + "_" + sensor.id,
+			"state_topic":    m.StateTopic(),
+			"value_template": sensor.template,
+			"device":         device,
+		}
+		if sensor.deviceClass != "" {
+			config["device_class"] = sensor.deviceClass
+		}
+		if sensor.unit != "" {
+			config["unit_of_measurement"] = sensor.unit
+		}
+		if sensor.stateClass != "" {
+			config["state_class"] = sensor.stateClass
+		}
+
+		payload, _ := json.Marshal(config)
+		messages = append(messages, mqttMessage{
+			topic:   fmt.Sprintf("%s/sensor/%s/%s/config", m.DiscoveryPrefix, nodeID, sensor.id),
+			payload: payload,
+			retain:  true,
+		})
+	}
+	return messages
+}
+
+// publish connects to the broker, publishes the messages at QoS 0 and disconnects
+func (m *MQTT) publish(ctx context.Context, messages []mqttMessage) error {
+	u, err := url.Parse(m.Broker)
+	if err != nil {
+		return fmt.Errorf("invalid MQTT broker URL: %w", err)
+	}
+
+	dialer := &net.Dialer{Timeout: m.Timeout}
+	var conn net.Conn
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		conn, err = dialer.DialContext(ctx, "tcp", hostWithPort(u, "1883"))
+	case "ssl", "tls", "mqtts":
+		tlsConfig := m.TLSConfig
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{ServerName: u.Hostname()}
+		}
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", hostWithPort(u, "8883"))
+	default:
+		return fmt.Errorf("unsupported MQTT broker scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return fmt.Errorf("connecting to MQTT broker failed: %w", err)
+	}
+	defer conn.Close()
+	if m.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(m.Timeout))
+	}
+
+	w := bufio.NewWriter(conn)
+	if err := writePacket(w, mqttConnect<<4, m.connectBody()); err != nil {
+		return fmt.Errorf("sending MQTT CONNECT failed: %w", err)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("sending MQTT CONNECT failed: %w", err)
+	}
+	if err := readConnack(bufio.NewReader(conn)); err != nil {
+		return err
+	}
+
+	for _, msg := range messages {
+		header := byte(mqttPublish << 4)
+		if msg.retain {
+			header |= 0x01
+		}
+
+		var body []byte
+		body = appendString(body, msg.topic)
+		body = append(body, msg.payload...)
+		if err := writePacket(w, header, body); err != nil {
+			return fmt.Errorf("sending MQTT PUBLISH failed: %w", err)
+		}
+	}
+
+	if err := writePacket(w, mqttDisconnect<<4, nil); err != nil {
+		return fmt.Errorf("sending MQTT DISCONNECT failed: %w", err)
+	}
+	return w.Flush()
+}
+
+// connectBody builds the variable header and payload of an MQTT 3.1.1 CONNECT packet
+func (m *MQTT) connectBody() []byte {
+	var flags byte = 0x02 // Clean session
+	if m.Username != "" {
+		flags |= 0x80
+		if m.Password != "" {
+			flags |= 0x40
+		}
+	}
+
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, flags)                  // Protocol level 4 is MQTT 3.1.1
+	body = binary.BigEndian.AppendUint16(body, 30) // Keep alive in seconds
+	body = appendString(body, m.ClientID)
+	if m.Username != "" {
+		body = appendString(body, m.Username)
+		if m.Password != "" {
+			body = appendString(body, m.Password)
+		}
+	}
+	return body
+}
+
+// readConnack reads the broker's CONNACK and reports a refused connection as an error
+func readConnack(r *bufio.Reader) error {
+	header, err := r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("reading MQTT CONNACK failed: %w", err)
+	}
+	if header>>4 != mqttConnack {
+		return fmt.Errorf("expected MQTT CONNACK, got packet type %d", header>>4)
+	}
+
+	length, err := readLength(r)
+	if err != nil || length != 2 {
+		return errors.New("malformed MQTT CONNACK")
+	}
+	body := make([]byte, 2)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return fmt.Errorf("reading MQTT CONNACK failed: %w", err)
+	}
+
+	if body[1] != 0 {
+		return fmt.Errorf("MQTT broker refused connection with return code %d", body[1])
+	}
+	return nil
+}
+
+// writePacket writes a fixed header with the remaining length followed by the body
+func writePacket(w io.Writer, header byte, body []byte) error {
+	packet := []byte{header}
+	length := len(body)
+	for {
+		b := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if length == 0 {
+			break
+		}
+	}
+
+	_, err := w.Write(append(packet, body...))
+	return err
+}
+
+// readLength decodes the variable-length remaining length of a packet
+func readLength(r io.ByteReader) (int, error) {
+	length, multiplier := 0, 1
+	for i := 0; i < 4; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		length += int(b&0x7f) * multiplier
+		if b&0x80 == 0 {
+			return length, nil
+		}
+		multiplier *= 128
+	}
+	return 0, errors.New("malformed remaining length")
+}
+
+// appendString appends a length-prefixed UTF-8 string
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// hostWithPort returns the URL's host, adding the default port if none is given
+func hostWithPort(u *url.URL, defaultPort string) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	return net.JoinHostPort(u.Hostname(), defaultPort)
+}
@@ -0,0 +1,221 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// publishedMessage is a PUBLISH packet captured by the fake broker
+type publishedMessage struct {
+	topic   string
+	payload string
+	retain  bool
+}
+
+// fakeBroker is a minimal MQTT broker that records connections and published messages
+type fakeBroker struct {
+	ln         net.Listener
+	returnCode byte
+
+	mu        sync.Mutex
+	clientIDs []string
+	usernames []string
+	messages  []publishedMessage
+	done      chan struct{}
+}
+
+// newFakeBroker starts a fake broker that answers CONNECT with the given return code
+func newFakeBroker(t *testing.T, returnCode byte) *fakeBroker {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	b := &fakeBroker{ln: ln, returnCode: returnCode, done: make(chan struct{}, 16)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go b.handle(conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return b
+}
+
+// url returns the broker URL
+func (b *fakeBroker) url() string {
+	return "tcp://" + b.ln.Addr().String()
+}
+
+// readString reads a length-prefixed string from a packet body
+func readString(body []byte) (string, []byte) {
+	n := binary.BigEndian.Uint16(body)
+	return string(body[2 : 2+n]), body[2+n:]
+}
+
+// handle reads packets from a client until it disconnects
+func (b *fakeBroker) handle(conn net.Conn) {
+	defer conn.Close()
+	defer func() { b.done <- struct{}{} }()
+	r := bufio.NewReader(conn)
+
+	for {
+		header, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+		length, err := readLength(r)
+		if err != nil {
+			return
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return
+		}
+
+		switch header >> 4 {
+		case mqttConnect:
+			_, rest := readString(body) // Protocol name
+			flags := rest[1]
+			clientID, rest := readString(rest[4:])
+
+			b.mu.Lock()
+			b.clientIDs = append(b.clientIDs, clientID)
+			if flags&0x80 != 0 {
+				username, _ := readString(rest)
+				b.usernames = append(b.usernames, username)
+			}
+			b.mu.Unlock()
+
+			conn.Write([]byte{mqttConnack << 4, 2, 0, b.returnCode})
+			if b.returnCode != 0 {
+				return
+			}
+		case mqttPublish:
+			topic, payload := readString(body)
+			b.mu.Lock()
+			b.messages = append(b.messages, publishedMessage{topic: topic, payload: string(payload), retain: header&0x01 != 0})
+			b.mu.Unlock()
+		case mqttDisconnect:
+			return
+		}
+	}
+}
+
+// wait blocks until a client connection has been handled
+func (b *fakeBroker) wait(t *testing.T) {
+	select {
+	case <-b.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the client to disconnect")
+	}
+}
+
+// TestMQTTNotify tests publishing discovery configs, the run state and removal events
+func TestMQTTNotify(t *testing.T) {
+	b := newFakeBroker(t, 0)
+
+	m := NewMQTT(b.url())
+	m.Username = "ha"
+	m.Password = "secret"
+	m.DiscoveryPrefix = "homeassistant"
+
+	summary := testSummary()
+	summary.Finished = time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := m.Notify(context.Background(), summary); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+	b.wait(t)
+
+	b.mu.Lock()
+	messages := b.messages
+	if len(b.usernames) != 1 || b.usernames[0] != "ha" || b.clientIDs[0] != "qbt-clean" {
+		t.Errorf("Unexpected connection credentials: %v %v", b.clientIDs, b.usernames)
+	}
+	b.mu.Unlock()
+
+	topics := map[string]publishedMessage{}
+	var removals []publishedMessage
+	for _, msg := range messages {
+		if msg.topic == "qbt-clean/removal" {
+			removals = append(removals, msg)
+			continue
+		}
+		topics[msg.topic] = msg
+	}
+
+	for _, id := range []string{"last_run", "torrents_removed", "missing_torrents"} {
+		msg, ok := topics["homeassistant/sensor/qbt_clean/"+id+"/config"]
+		if !ok {
+			t.Errorf("Expected discovery config for %s", id)
+			continue
+		}
+
+		var config map[string]any
+		json.Unmarshal([]byte(msg.payload), &config)
+		if !msg.retain || config["state_topic"] != "qbt-clean/state" || config["unique_id"] != "qbt_clean_"+id {
+			t.Errorf("Unexpected discovery config for %s: %+v", id, msg)
+		}
+	}
+
+	state, ok := topics["qbt-clean/state"]
+	if !ok || !state.retain {
+		t.Fatalf("Expected retained state message, got %+v", state)
+	}
+	var decoded mqttState
+	json.Unmarshal([]byte(state.payload), &decoded)
+	if decoded.Removed != 2 || decoded.RunID != "run-1" || !decoded.LastRun.Equal(summary.Finished) {
+		t.Errorf("Unexpected state: %+v", decoded)
+	}
+
+	if len(removals) != 2 || removals[0].retain || !strings.Contains(removals[1].payload, `"name":"Second"`) {
+		t.Errorf("Unexpected removal events: %+v", removals)
+	}
+
+	// Discovery is only published once per process
+	if err := m.Notify(context.Background(), summary); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+	b.wait(t)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if got := len(b.messages) - len(messages); got != 3 {
+		t.Errorf("Expected state and 2 removals on the second run, got %d messages", got)
+	}
+}
+
+// TestMQTTRefused tests that a refused connection is reported
+func TestMQTTRefused(t *testing.T) {
+	b := newFakeBroker(t, 5)
+
+	err := NewMQTT(b.url()).Notify(context.Background(), testSummary())
+	if err == nil || !strings.Contains(err.Error(), "return code 5") {
+		t.Errorf("Expected refused connection error, got %v", err)
+	}
+}
+
+// TestMQTTRemainingLength tests encoding and decoding of multi-byte remaining lengths
+func TestMQTTRemainingLength(t *testing.T) {
+	for _, n := range []int{0, 127, 128, 16383, 16384, 2097151} {
+		var buf strings.Builder
+		writePacket(&buf, mqttPublish<<4, make([]byte, n))
+
+		r := bufio.NewReader(strings.NewReader(buf.String()[1:]))
+		got, err := readLength(r)
+		if err != nil || got != n {
+			t.Errorf("Expected remaining length %d, got %d (%v)", n, got, err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Package notify delivers the results of cleaner passes to external services
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"text/template"
+
+	"github.com/mallox/qbittorrent-cleaner/cleaner"
+	"github.com/mallox/qbittorrent-cleaner/report"
+)
+
+// Event types delivered to notifiers
+const (
+	EventRun     = "run"
+	EventRemoval = "removal"
+	EventAction  = "action" // A rule tagged, paused or reported a torrent, sent along with removal events
+)
+
+// Notifier delivers the result of a pass
+type Notifier interface {
+	Notify(ctx context.Context, s *cleaner.Summary) error
+}
+
+// Flusher is implemented by notifiers that batch passes and can deliver them early, e.g. on shutdown
+type Flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// Event is the data passed to notification templates
+type Event struct {
+	Type    string           `json:"type"`
+	Summary *cleaner.Summary `json:"summary"`
+	Removal *cleaner.Removal `json:"removal,omitempty"` // The removal, or the action for action events
+}
+
+// Notable reports whether a pass did anything worth notifying about
+func Notable(s *cleaner.Summary) bool {
+	return s.Aborted || s.Removed > 0 || s.Failed > 0 || len(s.Staged) > 0 || len(s.Actions) > 0
+}
+
+// NotifyAll delivers the summary to every notifier and joins their errors
+func NotifyAll(ctx context.Context, notifiers []Notifier, s *cleaner.Summary) error {
+	var errs []error
+	for _, n := range notifiers {
+		if err := n.Notify(ctx, s); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// FlushAll flushes every notifier that batches passes and joins their errors
+func FlushAll(ctx context.Context, notifiers []Notifier) error {
+	var errs []error
+	for _, n := range notifiers {
+		if f, ok := n.(Flusher); ok {
+			if err := f.Flush(ctx); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// templateFuncs are the helper functions available in notification templates
+var templateFuncs = template.FuncMap{
+	// json renders a value as JSON, which also quotes and escapes strings for use inside JSON payloads
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"bytes": report.FormatBytes,
+	"join":  strings.Join,
+}
+
+// ParseTemplate parses a notification template with the helper functions available
+func ParseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(templateFuncs).Parse(text)
+}
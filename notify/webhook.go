@@ -0,0 +1,147 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"text/template"
+	"time"
+
+	"github.com/mallox/qbittorrent-cleaner/cleaner"
+)
+
+// DefaultWebhookTemplate sends the whole event as JSON
+const DefaultWebhookTemplate = `{{json .}}`
+
+// SignatureHeader carries the hex HMAC-SHA256 of the request body when a secret is configured
+const SignatureHeader = "X-Signature-256"
+
+// Webhook POSTs a templated payload to one or more URLs
+type Webhook struct {
+	URLs        []string
+	Template    *template.Template
+	ContentType string
+	// Secret signs each payload with HMAC-SHA256 in the SignatureHeader header
+	Secret string
+	// PerRemoval sends one request per removed torrent and per rule action instead of one per run
+	PerRemoval bool
+	// NotifyEmpty also sends run notifications for passes that removed nothing
+	NotifyEmpty bool
+	Retries     int
+	RetryDelay  time.Duration
+	Client      *http.Client
+}
+
+// NewWebhook creates a webhook notifier that renders payloads with the given template
+func NewWebhook(urls []string, tmpl string) (*Webhook, error) {
+	if tmpl == "" {
+		tmpl = DefaultWebhookTemplate
+	}
+
+	t, err := ParseTemplate("webhook", tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("parsing webhook template failed: %w", err)
+	}
+
+	return &Webhook{
+		URLs:        urls,
+		Template:    t,
+		ContentType: "application/json",
+		Retries:     3,
+		RetryDelay:  time.Second,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// Notify sends the summary, or each of its removals and actions, to every configured URL
+func (w *Webhook) Notify(ctx context.Context, s *cleaner.Summary) error {
+	var events []Event
+	if w.PerRemoval {
+		for i := range s.Removals {
+			events = append(events, Event{Type: EventRemoval, Summary: s, Removal: &s.Removals[i]})
+		}
+		for i := range s.Actions {
+			events = append(events, Event{Type: EventAction, Summary: s, Removal: &s.Actions[i]})
+		}
+	} else if w.NotifyEmpty || Notable(s) {
+		events = append(events, Event{Type: EventRun, Summary: s})
+	}
+
+	var errs []error
+	for _, event := range events {
+		var body bytes.Buffer
+		if err := w.Template.Execute(&body, event); err != nil {
+			return fmt.Errorf("rendering webhook template failed: %w", err)
+		}
+
+		for _, url := range w.URLs {
+			if err := w.post(ctx, url, event.Type, body.Bytes()); err != nil {
+				errs = append(errs, fmt.Errorf("webhook %s: %w", url, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// post delivers a payload, retrying with exponential backoff on network errors and server errors
+func (w *Webhook) post(ctx context.Context, url, eventType string, body []byte) error {
+	delay := w.RetryDelay
+	var err error
+	for attempt := 0; attempt <= w.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+
+		var retry bool
+		if retry, err = w.send(ctx, url, eventType, body); err == nil || !retry {
+			return err
+		}
+	}
+	return err
+}
+
+// send performs a single delivery attempt and reports whether a failure is worth retrying
+func (w *Webhook) send(ctx context.Context, url, eventType string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("creating request failed: %w", err)
+	}
+
+	req.Header.Set("Content-Type", w.ContentType)
+	req.Header.Set("User-Agent", "qbt-clean")
+	req.Header.Set("X-Qbt-Clean-Event", eventType)
+	if w.Secret != "" {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(w.Secret, body))
+	}
+
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return retry, fmt.Errorf("failed with status: %s, body: %s", resp.Status, string(msg))
+	}
+	return false, nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of body using secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,181 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mallox/qbittorrent-cleaner/cleaner"
+)
+
+// receivedRequest is a webhook request captured by the test receiver
+type receivedRequest struct {
+	header http.Header
+	body   string
+}
+
+// newReceiver starts a webhook receiver that fails the first failures requests with status
+func newReceiver(t *testing.T, failures, status int) (*httptest.Server, *[]receivedRequest) {
+	var mu sync.Mutex
+	var received []receivedRequest
+	attempts := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		attempts++
+		if attempts <= failures {
+			w.WriteHeader(status)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		received = append(received, receivedRequest{header: r.Header, body: string(body)})
+	}))
+	t.Cleanup(server.Close)
+	return server, &received
+}
+
+// testSummary returns a summary with two removals
+func testSummary() *cleaner.Summary {
+	return &cleaner.Summary{
+		RunID:  "run-1",
+		Counts: cleaner.Counts{Checked: 5, Removed: 2, BytesReclaimed: 3072},
+		Removals: []cleaner.Removal{
+			{Hash: "aaa", Name: "First \"quoted\"", Rule: cleaner.RuleMissingFiles, MissingFiles: []string{"a.mkv"}, Size: 1024},
+			{Hash: "bbb", Name: "Second", Rule: cleaner.RuleMissingFiles, MissingFiles: []string{"b.mkv", "c.mkv"}, Size: 2048},
+		},
+	}
+}
+
+// TestWebhookDefaultTemplate tests that the default payload is the event as JSON
+func TestWebhookDefaultTemplate(t *testing.T) {
+	server, received := newReceiver(t, 0, 0)
+
+	w, err := NewWebhook([]string{server.URL}, "")
+	if err != nil {
+		t.Fatalf("Failed to create webhook: %v", err)
+	}
+
+	if err := w.Notify(context.Background(), testSummary()); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+
+	if len(*received) != 1 {
+		t.Fatalf("Expected 1 request, got %d", len(*received))
+	}
+
+	var event Event
+	if err := json.Unmarshal([]byte((*received)[0].body), &event); err != nil {
+		t.Fatalf("Expected JSON payload, got '%s': %v", (*received)[0].body, err)
+	}
+	if event.Type != EventRun || event.Summary.Removed != 2 {
+		t.Errorf("Unexpected event: %+v", event)
+	}
+	if (*received)[0].header.Get("X-Qbt-Clean-Event") != EventRun {
+		t.Errorf("Expected event header, got %v", (*received)[0].header)
+	}
+}
+
+// TestWebhookCustomTemplate tests a chat-style template with a signature
+func TestWebhookCustomTemplate(t *testing.T) {
+	server, received := newReceiver(t, 0, 0)
+
+	tmpl := `{"content": {{printf "Removed %d torrents (%s)" .Summary.Removed (bytes .Summary.BytesReclaimed) | json}}}`
+	w, err := NewWebhook([]string{server.URL, server.URL}, tmpl)
+	if err != nil {
+		t.Fatalf("Failed to create webhook: %v", err)
+	}
+	w.Secret = "s3cret"
+
+	if err := w.Notify(context.Background(), testSummary()); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+
+	if len(*received) != 2 {
+		t.Fatalf("Expected one request per URL, got %d", len(*received))
+	}
+
+	req := (*received)[0]
+	if req.body != `{"content": "Removed 2 torrents (3.0 KiB)"}` {
+		t.Errorf("Unexpected body '%s'", req.body)
+	}
+	if got, want := req.header.Get(SignatureHeader), "sha256="+Sign("s3cret", []byte(req.body)); got != want {
+		t.Errorf("Expected signature '%s', got '%s'", want, got)
+	}
+}
+
+// TestWebhookPerRemoval tests that one request is sent per removed torrent
+func TestWebhookPerRemoval(t *testing.T) {
+	server, received := newReceiver(t, 0, 0)
+
+	w, _ := NewWebhook([]string{server.URL}, `{"name": {{json .Removal.Name}}, "missing": {{json (join .Removal.MissingFiles ", ")}}}`)
+	w.PerRemoval = true
+
+	if err := w.Notify(context.Background(), testSummary()); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+
+	if len(*received) != 2 {
+		t.Fatalf("Expected 2 requests, got %d", len(*received))
+	}
+	if (*received)[0].body != `{"name": "First \"quoted\"", "missing": "a.mkv"}` {
+		t.Errorf("Unexpected body '%s'", (*received)[0].body)
+	}
+	if (*received)[1].header.Get("X-Qbt-Clean-Event") != EventRemoval {
+		t.Errorf("Expected removal event header, got %v", (*received)[1].header)
+	}
+}
+
+// TestWebhookSkipsEmptyRuns tests that runs without removals are only sent when requested
+func TestWebhookSkipsEmptyRuns(t *testing.T) {
+	server, received := newReceiver(t, 0, 0)
+	w, _ := NewWebhook([]string{server.URL}, "")
+
+	w.Notify(context.Background(), &cleaner.Summary{Counts: cleaner.Counts{Checked: 3, Healthy: 3}})
+	if len(*received) != 0 {
+		t.Errorf("Expected no request for an empty run, got %d", len(*received))
+	}
+
+	w.NotifyEmpty = true
+	w.Notify(context.Background(), &cleaner.Summary{Counts: cleaner.Counts{Checked: 3, Healthy: 3}})
+	if len(*received) != 1 {
+		t.Errorf("Expected a request once NotifyEmpty is set, got %d", len(*received))
+	}
+}
+
+// TestWebhookRetries tests retrying on server errors but not on client errors
+func TestWebhookRetries(t *testing.T) {
+	server, received := newReceiver(t, 2, http.StatusServiceUnavailable)
+	w, _ := NewWebhook([]string{server.URL}, "")
+	w.RetryDelay = time.Millisecond
+
+	if err := w.Notify(context.Background(), testSummary()); err != nil {
+		t.Fatalf("Expected delivery after retries, got %v", err)
+	}
+	if len(*received) != 1 {
+		t.Errorf("Expected 1 delivered request, got %d", len(*received))
+	}
+
+	server, received = newReceiver(t, 1, http.StatusBadRequest)
+	w.URLs = []string{server.URL}
+	if err := w.Notify(context.Background(), testSummary()); err == nil {
+		t.Error("Expected an error for a rejected payload")
+	}
+	if len(*received) != 0 {
+		t.Errorf("Expected no retry after a client error, got %d deliveries", len(*received))
+	}
+}
+
+// TestParseTemplateError tests that invalid templates are rejected up front
+func TestParseTemplateError(t *testing.T) {
+	if _, err := NewWebhook([]string{"http://localhost"}, "{{.Summary"); err == nil {
+		t.Error("Expected an error for an invalid template")
+	}
+}
@@ -0,0 +1,213 @@
+// Package pending provides the queue of staged removals that wait for approval before they are executed
+package pending
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mallox/qbittorrent-cleaner/atomicfile"
+)
+
+// Statuses of a staged removal
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusRejected = "rejected"
+)
+
+// ErrNotFound is returned when a torrent is not in the queue
+var ErrNotFound = errors.New("torrent is not in the pending queue")
+
+// Item is a torrent staged for removal
+type Item struct {
+	Hash         string    `json:"hash"`
+	Name         string    `json:"name"`
+	Category     string    `json:"category"`
+	SavePath     string    `json:"save_path"`
+	Rule         string    `json:"rule"`
+	MissingFiles []string  `json:"missing_files"`
+	Size         int64     `json:"size"`
+	RunID        string    `json:"run_id"` // Run that last staged the torrent
+	Staged       time.Time `json:"staged"`
+	Status       string    `json:"status"`
+	Decided      time.Time `json:"decided,omitzero"`
+}
+
+// Queue is a pending queue stored in a JSON file. The file is read before and written after
+// every change, so approvals made by another process are picked up by the next pass.
+type Queue struct {
+	path string
+	mu   sync.Mutex
+	now  func() time.Time
+}
+
+// Open returns the queue stored at path. The file is created on the first change.
+func Open(path string) *Queue {
+	return &Queue{path: path, now: time.Now}
+}
+
+// List returns all items in the queue, sorted by when they were staged
+func (q *Queue) List() ([]Item, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	items, err := q.load()
+	if err != nil {
+		return nil, err
+	}
+	return sorted(items), nil
+}
+
+// Get returns the item for a torrent
+func (q *Queue) Get(hash string) (Item, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	items, err := q.load()
+	if err != nil {
+		return Item{}, err
+	}
+	item, ok := items[key(hash)]
+	if !ok {
+		return Item{}, ErrNotFound
+	}
+	return item, nil
+}
+
+// Stage adds items to the queue as pending. Torrents that are already queued keep their
+// status, but their details are updated. If prune is set, the queue is reduced to the
+// given items, dropping torrents that are no longer candidates for removal.
+func (q *Queue) Stage(staged []Item, prune bool) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	items, err := q.load()
+	if err != nil {
+		return err
+	}
+
+	next := items
+	if prune {
+		next = map[string]Item{}
+	}
+	for _, item := range staged {
+		item.Staged = q.now()
+		item.Status = StatusPending
+		if existing, ok := items[key(item.Hash)]; ok {
+			item.Staged = existing.Staged
+			item.Status = existing.Status
+			item.Decided = existing.Decided
+		}
+		next[key(item.Hash)] = item
+	}
+
+	return q.save(next)
+}
+
+// Approve marks torrents for removal by the next pass
+func (q *Queue) Approve(hashes ...string) error {
+	return q.decide(StatusApproved, hashes)
+}
+
+// Reject marks torrents to be kept. They stay in the queue so later passes don't stage them again.
+func (q *Queue) Reject(hashes ...string) error {
+	return q.decide(StatusRejected, hashes)
+}
+
+// Remove deletes torrents from the queue, ignoring those that aren't in it
+func (q *Queue) Remove(hashes ...string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	items, err := q.load()
+	if err != nil {
+		return err
+	}
+	for _, hash := range hashes {
+		delete(items, key(hash))
+	}
+	return q.save(items)
+}
+
+// decide sets the status of queued torrents. Nothing is changed if any of them is not queued.
+func (q *Queue) decide(status string, hashes []string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	items, err := q.load()
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range hashes {
+		item, ok := items[key(hash)]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrNotFound, hash)
+		}
+		item.Status = status
+		item.Decided = q.now()
+		items[key(hash)] = item
+	}
+	return q.save(items)
+}
+
+// load reads the queue file. A missing file is an empty queue.
+func (q *Queue) load() (map[string]Item, error) {
+	items := map[string]Item{}
+
+	data, err := os.ReadFile(q.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return items, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading pending queue failed: %w", err)
+	}
+
+	var list []Item
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("parsing pending queue failed: %w", err)
+	}
+	for _, item := range list {
+		items[key(item.Hash)] = item
+	}
+	return items, nil
+}
+
+// save replaces the queue file atomically
+func (q *Queue) save(items map[string]Item) error {
+	data, err := json.MarshalIndent(sorted(items), "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling pending queue failed: %w", err)
+	}
+
+	if err := atomicfile.WriteFile(q.path, data, 0o644); err != nil {
+		return fmt.Errorf("writing pending queue failed: %w", err)
+	}
+	return nil
+}
+
+// sorted returns the items ordered by when they were staged, then by hash
+func sorted(items map[string]Item) []Item {
+	list := make([]Item, 0, len(items))
+	for _, item := range items {
+		list = append(list, item)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].Staged.Equal(list[j].Staged) {
+			return list[i].Staged.Before(list[j].Staged)
+		}
+		return list[i].Hash < list[j].Hash
+	})
+	return list
+}
+
+// key normalizes a hash for lookups
+func key(hash string) string {
+	return strings.ToLower(hash)
+}
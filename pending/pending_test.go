@@ -0,0 +1,59 @@
+package pending
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// TestQueue tests staging, deciding and pruning queued torrents
+func TestQueue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pending.json")
+	q := Open(path)
+
+	if items, err := q.List(); err != nil || len(items) != 0 {
+		t.Fatalf("Expected empty queue, got %v %v", items, err)
+	}
+
+	err := q.Stage([]Item{{Hash: "AAA", Name: "One"}, {Hash: "bbb", Name: "Two"}}, false)
+	if err != nil {
+		t.Fatalf("Stage failed: %v", err)
+	}
+	if err := q.Approve("aaa"); err != nil {
+		t.Fatalf("Approve failed: %v", err)
+	}
+	if err := q.Reject("bbb"); err != nil {
+		t.Fatalf("Reject failed: %v", err)
+	}
+	if err := q.Approve("ccc"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for an unknown torrent, got %v", err)
+	}
+
+	// Staging again keeps the decisions but updates the details, as seen by another process
+	if err := Open(path).Stage([]Item{{Hash: "aaa", Name: "Renamed"}}, false); err != nil {
+		t.Fatalf("Stage failed: %v", err)
+	}
+	item, err := q.Get("aaa")
+	if err != nil || item.Status != StatusApproved || item.Name != "Renamed" || item.Decided.IsZero() {
+		t.Errorf("Expected approved item with updated name, got %+v %v", item, err)
+	}
+	if item, _ := q.Get("bbb"); item.Status != StatusRejected {
+		t.Errorf("Expected bbb to stay rejected, got %+v", item)
+	}
+
+	// Pruning drops everything that wasn't staged again
+	if err := q.Stage([]Item{{Hash: "ccc"}}, true); err != nil {
+		t.Fatalf("Stage failed: %v", err)
+	}
+	items, _ := q.List()
+	if len(items) != 1 || items[0].Hash != "ccc" || items[0].Status != StatusPending {
+		t.Errorf("Expected only ccc to be pending, got %+v", items)
+	}
+
+	if err := q.Remove("ccc", "unknown"); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if _, err := q.Get("ccc"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ccc to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mallox/qbittorrent-cleaner/pending"
+)
+
+// runPending implements the "pending" subcommand, which lists, approves and rejects staged removals
+func runPending(cfg *config, args []string) int {
+	fs := flag.NewFlagSet("pending", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: qbt-clean pending [flags] [list | approve <hash>... | reject <hash>...]")
+		fs.PrintDefaults()
+	}
+	path := fs.String("file", cfg.PendingPath, "path to the pending queue (default $PENDING_PATH)")
+	all := fs.Bool("all", false, "approve or reject every pending torrent")
+	asJSON := fs.Bool("json", false, "list the queue as JSON")
+	if err := fs.Parse(args); err != nil {
+		return parseExit(err)
+	}
+
+	if *path == "" {
+		fmt.Fprintln(os.Stderr, "No pending queue configured, set PENDING_PATH or pass -file")
+		return exitUsage
+	}
+	queue := pending.Open(*path)
+
+	action, hashes := "list", fs.Args()
+	if len(hashes) > 0 {
+		action, hashes = hashes[0], hashes[1:]
+	}
+
+	switch action {
+	case "list":
+		return listPending(queue, *asJSON)
+	case "approve", "reject":
+	default:
+		fs.Usage()
+		return exitUsage
+	}
+
+	if *all {
+		items, err := queue.List()
+		if err != nil {
+			fmt.Printf("Failed to read pending queue: %v\n", err)
+			return exitError
+		}
+		for _, item := range items {
+			if item.Status == pending.StatusPending {
+				hashes = append(hashes, item.Hash)
+			}
+		}
+	}
+	if len(hashes) == 0 {
+		fmt.Printf("Nothing to %s, pass torrent hashes or -all\n", action)
+		return exitUsage
+	}
+
+	decide := queue.Approve
+	if action == "reject" {
+		decide = queue.Reject
+	}
+	if err := decide(hashes...); err != nil {
+		fmt.Printf("Failed to %s: %v\n", action, err)
+		return exitError
+	}
+
+	if action == "approve" {
+		fmt.Printf("Approved %d torrents, they are removed by the next pass if their files are still missing\n", len(hashes))
+	} else {
+		fmt.Printf("Rejected %d torrents, they are kept\n", len(hashes))
+	}
+	return 0
+}
+
+// listPending prints the pending queue
+func listPending(queue *pending.Queue, asJSON bool) int {
+	items, err := queue.List()
+	if err != nil {
+		fmt.Printf("Failed to read pending queue: %v\n", err)
+		return exitError
+	}
+
+	for _, item := range items {
+		if asJSON {
+			line, _ := json.Marshal(item)
+			fmt.Println(string(line))
+			continue
+		}
+
+		fmt.Printf("%s  %s  %-8s  %s  %s\n",
+			item.Staged.Local().Format(time.DateTime), item.Hash, item.Status, item.Rule, item.Name)
+		fmt.Printf("    missing: %s\n", strings.Join(item.MissingFiles, ", "))
+	}
+	return 0
+}
@@ -2,10 +2,14 @@
 package qbittorrent
 
 import (
+	"bytes"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"mime/multipart"
 	"net/http"
 	"net/url"
 	"strings"
@@ -19,20 +23,100 @@ type Client struct {
 	Password string
 	Client   *http.Client
 	Cookies  []*http.Cookie
+	Logger   *slog.Logger
+	Observer RequestObserver
+}
+
+// RequestObserver is notified about every API request the client makes. The endpoint
+// is the API method path without the /api/v2/ prefix, such as "torrents/info".
+type RequestObserver interface {
+	ObserveRequest(endpoint string, duration time.Duration, err error)
 }
 
 // Torrent represents a torrent in qBittorrent
 type Torrent struct {
-	Hash       string `json:"hash"`
-	Name       string `json:"name"`
-	AmountLeft int64  `json:"amount_left"`
-	State      string `json:"state"`
+	Hash        string       `json:"hash"`
+	Name        string       `json:"name"`
+	Category    string       `json:"category"`
+	Tags        string       `json:"tags"`    // Comma-separated list of tags
+	Tracker     string       `json:"tracker"` // URL of the current working tracker, empty if none works
+	SavePath    string       `json:"save_path"`
+	Size        int64        `json:"size"`
+	AmountLeft  int64        `json:"amount_left"`
+	State       TorrentState `json:"state"`
+	Ratio       float64      `json:"ratio"`
+	SeedingTime int64        `json:"seeding_time"` // Seconds spent seeding
+	AddedOn     int64        `json:"added_on"`     // Unix time the torrent was added
+	// Progress is the share of the wanted data downloaded, from 0 to 1
+	Progress float64 `json:"progress"`
+	// Availability is the number of complete copies seen among peers, -1 if unknown
+	Availability float64 `json:"availability"`
+	// LastActivity is the unix time data was last downloaded or uploaded, zero if never
+	LastActivity int64 `json:"last_activity"`
+}
+
+// Inactive returns how long ago data was last downloaded or uploaded. A torrent that was
+// never active counts as inactive since it was added.
+func (t Torrent) Inactive(now time.Time) time.Duration {
+	last := t.LastActivity
+	if last <= 0 {
+		last = t.AddedOn
+	}
+	return now.Sub(time.Unix(last, 0)).Truncate(time.Second)
+}
+
+// TagList returns the tags of the torrent
+func (t Torrent) TagList() []string {
+	var tags []string
+	for _, tag := range strings.Split(t.Tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// TrackerHost returns the host name of the current tracker, or an empty string if there is none
+func (t Torrent) TrackerHost() string {
+	u, err := url.Parse(t.Tracker)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
 }
 
 // TorrentFile represents a file in a torrent
 type TorrentFile struct {
-	Name     string `json:"name"`
-	Priority int    `json:"priority"`
+	Name     string  `json:"name"`
+	Size     int64   `json:"size"`
+	Priority int     `json:"priority"`
+	Progress float64 `json:"progress"` // Share of the file's pieces verified, from 0 to 1
+}
+
+// Tracker represents a tracker of a torrent. Besides real trackers, qBittorrent lists
+// DHT, PeX and LSD as pseudo trackers with URLs such as "** [DHT] **".
+type Tracker struct {
+	URL    string `json:"url"`
+	Status int    `json:"status"`
+	Msg    string `json:"msg"` // Message the tracker answered with, e.g. "Unregistered torrent"
+}
+
+// Tracker statuses
+const (
+	TrackerDisabled     = 0 // Disabled, used for the DHT, PeX and LSD pseudo trackers
+	TrackerNotContacted = 1
+	TrackerWorking      = 2
+	TrackerUpdating     = 3
+	TrackerNotWorking   = 4
+)
+
+// Host returns the host name of the tracker, or an empty string for pseudo trackers
+func (t Tracker) Host() string {
+	u, err := url.Parse(t.URL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
 }
 
 // NewClient creates a new qBittorrent client
@@ -51,6 +135,7 @@ func NewClient(baseURL, username, password string) *Client {
 		Username: username,
 		Password: password,
 		Client:   client,
+		Logger:   slog.Default(),
 	}
 }
 
@@ -60,7 +145,13 @@ func (c *Client) Login() error {
 	data.Set("username", c.Username)
 	data.Set("password", c.Password)
 
-	resp, err := c.Client.PostForm(c.BaseURL+"/api/v2/auth/login", data)
+	req, err := http.NewRequest("POST", c.BaseURL+"/api/v2/auth/login", strings.NewReader(data.Encode()))
+	if err != nil {
+		return fmt.Errorf("creating request failed: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.send(req)
 	if err != nil {
 		return fmt.Errorf("login request failed: %w", err)
 	}
@@ -74,19 +165,22 @@ func (c *Client) Login() error {
 
 	// If no cookies were returned, we'll use HTTP Basic Authentication as a fallback
 	if len(c.Cookies) == 0 {
-		fmt.Println("No cookies returned during login, using HTTP Basic Authentication as fallback")
+		c.logger().Warn("No cookies returned during login, using HTTP Basic Authentication as fallback")
 	}
 
 	return nil
 }
 
-// ListTorrents returns a list of torrents
-func (c *Client) ListTorrents() ([]Torrent, error) {
-	req, err := http.NewRequest("GET", c.BaseURL+"/api/v2/torrents/info", nil)
-	if err != nil {
-		return nil, fmt.Errorf("creating request failed: %w", err)
+// logger returns the client's logger, falling back to the default logger
+func (c *Client) logger() *slog.Logger {
+	if c.Logger == nil {
+		return slog.Default()
 	}
+	return c.Logger
+}
 
+// do authenticates and sends a request to the WebUI
+func (c *Client) do(req *http.Request) (*http.Response, error) {
 	// Add cookies if available
 	for _, cookie := range c.Cookies {
 		req.AddCookie(cookie)
@@ -97,7 +191,47 @@ func (c *Client) ListTorrents() ([]Torrent, error) {
 		req.SetBasicAuth(c.Username, c.Password)
 	}
 
+	return c.send(req)
+}
+
+// send performs a request and reports its latency and outcome to the observer
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	start := time.Now()
 	resp, err := c.Client.Do(req)
+
+	if c.Observer != nil {
+		observed := err
+		if err == nil && resp.StatusCode != http.StatusOK {
+			observed = fmt.Errorf("unexpected status: %s", resp.Status)
+		}
+		endpoint := req.URL.Path
+		if i := strings.Index(endpoint, "/api/v2/"); i >= 0 {
+			endpoint = endpoint[i+len("/api/v2/"):]
+		}
+		c.Observer.ObserveRequest(endpoint, time.Since(start), observed)
+	}
+
+	return resp, err
+}
+
+// ListTorrents returns a list of torrents
+func (c *Client) ListTorrents() ([]Torrent, error) {
+	return c.listTorrents("")
+}
+
+// ListTorrentsByHash returns the torrents with the given hashes
+func (c *Client) ListTorrentsByHash(hashes ...string) ([]Torrent, error) {
+	return c.listTorrents("?hashes=" + url.QueryEscape(strings.Join(hashes, "|")))
+}
+
+// listTorrents returns the torrents selected by a query string
+func (c *Client) listTorrents(query string) ([]Torrent, error) {
+	req, err := http.NewRequest("GET", c.BaseURL+"/api/v2/torrents/info"+query, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request failed: %w", err)
+	}
+
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, fmt.Errorf("list torrents request failed: %w", err)
 	}
@@ -128,17 +262,7 @@ func (c *Client) TorrentFiles(hash string) ([]TorrentFile, error) {
 		return nil, fmt.Errorf("creating request failed: %w", err)
 	}
 
-	// Add cookies if available
-	for _, cookie := range c.Cookies {
-		req.AddCookie(cookie)
-	}
-
-	// If no cookies are available, use HTTP Basic Authentication
-	if len(c.Cookies) == 0 {
-		req.SetBasicAuth(c.Username, c.Password)
-	}
-
-	resp, err := c.Client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, fmt.Errorf("torrent files request failed: %w", err)
 	}
@@ -162,6 +286,37 @@ func (c *Client) TorrentFiles(hash string) ([]TorrentFile, error) {
 	return files, nil
 }
 
+// Trackers returns the trackers of a torrent
+func (c *Client) Trackers(hash string) ([]Tracker, error) {
+	req, err := http.NewRequest("GET", c.BaseURL+"/api/v2/torrents/trackers?hash="+url.QueryEscape(hash), nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request failed: %w", err)
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("torrent trackers request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("torrent trackers failed with status: %s, body: %s", resp.Status, string(body))
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading response body failed: %w", err)
+	}
+
+	var trackers []Tracker
+	if err := json.Unmarshal(body, &trackers); err != nil {
+		return nil, fmt.Errorf("unmarshaling trackers failed: %w", err)
+	}
+
+	return trackers, nil
+}
+
 // RemoveTorrent removes a torrent
 func (c *Client) RemoveTorrent(hash string, deleteFiles bool) error {
 	data := url.Values{}
@@ -177,25 +332,156 @@ func (c *Client) RemoveTorrent(hash string, deleteFiles bool) error {
 
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 
-	// Add cookies if available
-	for _, cookie := range c.Cookies {
-		req.AddCookie(cookie)
+	resp, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("remove torrent request failed: %w", err)
 	}
+	defer resp.Body.Close()
 
-	// If no cookies are available, use HTTP Basic Authentication
-	if len(c.Cookies) == 0 {
-		req.SetBasicAuth(c.Username, c.Password)
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("remove torrent failed with status: %s, body: %s", resp.Status, string(body))
 	}
 
-	resp, err := c.Client.Do(req)
+	return nil
+}
+
+// ExportTorrent returns the .torrent file of a torrent. It requires qBittorrent 4.5 or later.
+func (c *Client) ExportTorrent(hash string) ([]byte, error) {
+	req, err := http.NewRequest("GET", c.BaseURL+"/api/v2/torrents/export?hash="+url.QueryEscape(hash), nil)
 	if err != nil {
-		return fmt.Errorf("remove torrent request failed: %w", err)
+		return nil, fmt.Errorf("creating request failed: %w", err)
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("export torrent request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("remove torrent failed with status: %s, body: %s", resp.Status, string(body))
+		return nil, fmt.Errorf("export torrent failed with status: %s, body: %s", resp.Status, string(body))
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading response body failed: %w", err)
+	}
+
+	return data, nil
+}
+
+// AddOptions control how a torrent is added
+type AddOptions struct {
+	SavePath string
+	Category string
+	// Paused adds the torrent without starting it
+	Paused bool
+}
+
+// AddTorrent adds a torrent from the contents of its .torrent file
+func (c *Client) AddTorrent(torrent []byte, opts AddOptions) error {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+
+	part, err := w.CreateFormFile("torrents", "upload.torrent")
+	if err != nil {
+		return fmt.Errorf("creating request failed: %w", err)
+	}
+	part.Write(torrent)
+
+	if opts.SavePath != "" {
+		w.WriteField("savepath", opts.SavePath)
+	}
+	if opts.Category != "" {
+		w.WriteField("category", opts.Category)
+	}
+	if opts.Paused {
+		// qBittorrent 5 renamed "paused" to "stopped", so send both
+		w.WriteField("paused", "true")
+		w.WriteField("stopped", "true")
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("creating request failed: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", c.BaseURL+"/api/v2/torrents/add", &body)
+	if err != nil {
+		return fmt.Errorf("creating request failed: %w", err)
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+
+	resp, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("add torrent request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("add torrent failed with status: %s, body: %s", resp.Status, string(respBody))
+	}
+
+	// Older versions answer 200 with "Fails." when the torrent is invalid or already added
+	if strings.TrimSpace(string(respBody)) == "Fails." {
+		return fmt.Errorf("add torrent failed: torrent is invalid or already added")
+	}
+
+	return nil
+}
+
+// AddTags adds tags to a torrent, creating any tags that don't exist yet
+func (c *Client) AddTags(hash string, tags []string) error {
+	data := url.Values{}
+	data.Set("hashes", hash)
+	data.Set("tags", strings.Join(tags, ","))
+	return c.post("torrents/addTags", data, "add tags")
+}
+
+// Recheck makes qBittorrent verify the data of torrents against their piece hashes
+func (c *Client) Recheck(hashes ...string) error {
+	data := url.Values{}
+	data.Set("hashes", strings.Join(hashes, "|"))
+	return c.post("torrents/recheck", data, "recheck torrents")
+}
+
+// PauseTorrent pauses a torrent. qBittorrent 5 calls this stopping, so the older
+// endpoint is only used if the newer one doesn't exist.
+func (c *Client) PauseTorrent(hash string) error {
+	data := url.Values{}
+	data.Set("hashes", hash)
+	err := c.post("torrents/stop", data, "stop torrent")
+	if errors.Is(err, errNotFound) {
+		return c.post("torrents/pause", data, "pause torrent")
+	}
+	return err
+}
+
+// errNotFound is returned by post when the API method doesn't exist
+var errNotFound = errors.New("not found")
+
+// post sends a form to an API method that answers with an empty body. The action
+// describes the request in errors.
+func (c *Client) post(method string, data url.Values, action string) error {
+	req, err := http.NewRequest("POST", c.BaseURL+"/api/v2/"+method, strings.NewReader(data.Encode()))
+	if err != nil {
+		return fmt.Errorf("creating request failed: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", action, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%s failed: %w", action, errNotFound)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s failed with status: %s, body: %s", action, resp.Status, string(body))
 	}
 
 	return nil
@@ -1,10 +1,16 @@
 package qbittorrent
 
 import (
+	"bytes"
 	"encoding/json"
+	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 )
 
 // TestNewClient tests the creation of a new Client
@@ -80,6 +86,27 @@ func TestLogin(t *testing.T) {
 	}
 }
 
+// TestLoginLogger tests that the Basic Auth fallback is reported through the injected logger
+func TestLoginLogger(t *testing.T) {
+	// Create a test server that accepts the login but sets no cookie
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	client := NewClient(server.URL, "admin", "adminadmin")
+	client.Logger = slog.New(slog.NewTextHandler(&buf, nil))
+
+	if err := client.Login(); err != nil {
+		t.Fatalf("Expected successful login, got error: %v", err)
+	}
+
+	if !strings.Contains(buf.String(), "HTTP Basic Authentication") {
+		t.Errorf("Expected fallback warning in injected logger, got '%s'", buf.String())
+	}
+}
+
 // TestListTorrents tests the ListTorrents method
 func TestListTorrents(t *testing.T) {
 	// Create a test server
@@ -281,3 +308,230 @@ func TestRemoveTorrent(t *testing.T) {
 		t.Errorf("Failed to remove torrent: %v", err)
 	}
 }
+
+// recordingObserver records the endpoints and errors reported by the client
+type recordingObserver struct {
+	endpoints []string
+	errors    []error
+}
+
+func (o *recordingObserver) ObserveRequest(endpoint string, duration time.Duration, err error) {
+	o.endpoints = append(o.endpoints, endpoint)
+	o.errors = append(o.errors, err)
+}
+
+// TestObserver tests that every request is reported to the observer
+func TestObserver(t *testing.T) {
+	// Create a test server behind a reverse proxy style path prefix
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/qbt/api/v2/torrents/delete" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+
+	observer := &recordingObserver{}
+	client := NewClient(server.URL+"/qbt", "admin", "adminadmin")
+	client.Logger = slog.New(slog.DiscardHandler)
+	client.Observer = observer
+
+	client.Login()
+	client.ListTorrents()
+	client.RemoveTorrent("abcdef123456", false)
+
+	want := []string{"auth/login", "torrents/info", "torrents/delete"}
+	if strings.Join(observer.endpoints, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected endpoints %v, got %v", want, observer.endpoints)
+	}
+
+	if observer.errors[1] != nil || observer.errors[2] == nil {
+		t.Errorf("Expected only the failed removal to be reported as an error, got %v", observer.errors)
+	}
+}
+
+// TestExportAndAddTorrent tests exporting a .torrent file and adding it back
+func TestExportAndAddTorrent(t *testing.T) {
+	torrentData := []byte("d4:infod4:name4:testee")
+	added := false
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v2/auth/login":
+			http.SetCookie(w, &http.Cookie{Name: "SID", Value: "test-session-id"})
+		case "/api/v2/torrents/export":
+			if r.URL.Query().Get("hash") != "abcdef123456" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(torrentData)
+		case "/api/v2/torrents/add":
+			if err := r.ParseMultipartForm(1 << 20); err != nil {
+				t.Fatalf("Failed to parse form: %v", err)
+			}
+			file, _, err := r.FormFile("torrents")
+			if err != nil {
+				t.Fatalf("Expected torrent file in form: %v", err)
+			}
+			data, _ := io.ReadAll(file)
+			if string(data) != string(torrentData) {
+				t.Errorf("Expected uploaded torrent to match export, got '%s'", string(data))
+			}
+			if r.FormValue("savepath") != "/downloads/tv" || r.FormValue("category") != "tv" || r.FormValue("paused") != "true" || r.FormValue("stopped") != "true" {
+				t.Errorf("Unexpected add options %v", r.MultipartForm.Value)
+			}
+			if added {
+				w.Write([]byte("Fails."))
+				return
+			}
+			added = true
+			w.Write([]byte("Ok."))
+		default:
+			t.Errorf("Unexpected request to %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "admin", "adminadmin")
+	if err := client.Login(); err != nil {
+		t.Fatalf("Failed to login: %v", err)
+	}
+
+	data, err := client.ExportTorrent("abcdef123456")
+	if err != nil {
+		t.Fatalf("Failed to export torrent: %v", err)
+	}
+	if _, err := client.ExportTorrent("unknown"); err == nil {
+		t.Errorf("Expected export of an unknown torrent to fail")
+	}
+
+	opts := AddOptions{SavePath: "/downloads/tv", Category: "tv", Paused: true}
+	if err := client.AddTorrent(data, opts); err != nil {
+		t.Errorf("Failed to add torrent: %v", err)
+	}
+	if err := client.AddTorrent(data, opts); err == nil {
+		t.Errorf("Expected adding a duplicate torrent to fail")
+	}
+}
+
+// TestTorrentHelpers tests parsing the tags and tracker of a torrent
+func TestTorrentHelpers(t *testing.T) {
+	torrent := Torrent{Tags: "keep, private ,", Tracker: "https://Tracker.Example.org:443/announce?passkey=secret"}
+
+	if tags := torrent.TagList(); len(tags) != 2 || tags[0] != "keep" || tags[1] != "private" {
+		t.Errorf("Expected tags keep and private, got %v", tags)
+	}
+	if host := torrent.TrackerHost(); host != "tracker.example.org" {
+		t.Errorf("Expected tracker host tracker.example.org, got %q", host)
+	}
+	if host := (Torrent{}).TrackerHost(); host != "" {
+		t.Errorf("Expected no tracker host, got %q", host)
+	}
+
+	now := time.Unix(1_000_000, 0)
+	if inactive := (Torrent{LastActivity: now.Unix() - 90, AddedOn: now.Unix() - 3600}).Inactive(now); inactive != 90*time.Second {
+		t.Errorf("Expected 90s of inactivity, got %s", inactive)
+	}
+	if inactive := (Torrent{AddedOn: now.Unix() - 3600}).Inactive(now); inactive != time.Hour {
+		t.Errorf("Expected a torrent that was never active to be inactive since it was added, got %s", inactive)
+	}
+}
+
+// TestAddTagsAndPause tests tagging and pausing torrents on old and new qBittorrent versions
+func TestAddTagsAndPause(t *testing.T) {
+	var requests []string
+	legacy := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		requests = append(requests, r.URL.Path+" "+r.Form.Encode())
+		if legacy && r.URL.Path == "/api/v2/torrents/stop" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "admin", "adminadmin")
+	if err := client.AddTags("abc", []string{"unwanted", "cleanup"}); err != nil {
+		t.Fatalf("Failed to add tags: %v", err)
+	}
+	if err := client.PauseTorrent("abc"); err != nil {
+		t.Fatalf("Failed to pause torrent: %v", err)
+	}
+	legacy = true
+	if err := client.PauseTorrent("abc"); err != nil {
+		t.Fatalf("Failed to pause torrent on qBittorrent 4: %v", err)
+	}
+
+	want := []string{
+		"/api/v2/torrents/addTags hashes=abc&tags=unwanted%2Ccleanup",
+		"/api/v2/torrents/stop hashes=abc",
+		"/api/v2/torrents/stop hashes=abc",
+		"/api/v2/torrents/pause hashes=abc",
+	}
+	if !slices.Equal(requests, want) {
+		t.Errorf("Expected requests %v, got %v", want, requests)
+	}
+}
+
+// TestTrackers tests listing the trackers of a torrent
+func TestTrackers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/torrents/trackers" || r.URL.Query().Get("hash") != "abc" {
+			t.Errorf("Unexpected request to %s", r.URL)
+		}
+		w.Write([]byte(`[
+			{"url": "** [DHT] **", "status": 0, "msg": ""},
+			{"url": "https://Tracker.Example.org/announce?passkey=secret", "status": 4, "msg": "Unregistered torrent"}
+		]`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "admin", "adminadmin")
+	trackers, err := client.Trackers("abc")
+	if err != nil {
+		t.Fatalf("Failed to get trackers: %v", err)
+	}
+	if len(trackers) != 2 {
+		t.Fatalf("Expected 2 trackers, got %d", len(trackers))
+	}
+	if host := trackers[0].Host(); host != "" {
+		t.Errorf("Expected no host for the DHT pseudo tracker, got %q", host)
+	}
+	if trackers[1].Host() != "tracker.example.org" || trackers[1].Status != TrackerNotWorking || trackers[1].Msg != "Unregistered torrent" {
+		t.Errorf("Unexpected tracker: %+v", trackers[1])
+	}
+}
+
+// TestRecheck tests rechecking torrents and listing them by hash
+func TestRecheck(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		requests = append(requests, r.URL.Path+" "+r.Form.Encode())
+		if r.URL.Path == "/api/v2/torrents/info" {
+			w.Write([]byte(`[{"hash": "abc", "state": "checkingUP"}]`))
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "admin", "adminadmin")
+	if err := client.Recheck("abc", "def"); err != nil {
+		t.Fatalf("Failed to recheck torrents: %v", err)
+	}
+	torrents, err := client.ListTorrentsByHash("abc", "def")
+	if err != nil {
+		t.Fatalf("Failed to list torrents: %v", err)
+	}
+	if len(torrents) != 1 || torrents[0].State != "checkingUP" {
+		t.Errorf("Expected the checking torrent, got %+v", torrents)
+	}
+
+	want := []string{
+		"/api/v2/torrents/recheck hashes=abc%7Cdef",
+		"/api/v2/torrents/info hashes=abc%7Cdef",
+	}
+	if !slices.Equal(requests, want) {
+		t.Errorf("Expected requests %v, got %v", want, requests)
+	}
+}
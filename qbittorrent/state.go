@@ -0,0 +1,89 @@
+package qbittorrent
+
+import "encoding/json"
+
+// TorrentState is the state qBittorrent reports for a torrent. qBittorrent 5 renamed the
+// paused states to stopped, and states are normalized to the new names when decoded, so
+// both API generations look the same.
+type TorrentState string
+
+// Torrent states of qBittorrent 4 and 5
+const (
+	StateError              TorrentState = "error"        // Some error occurred, e.g. a full disk
+	StateMissingFiles       TorrentState = "missingFiles" // The data of the torrent is gone
+	StateUploading          TorrentState = "uploading"
+	StateStoppedUP          TorrentState = "stoppedUP" // Complete and stopped, pausedUP before qBittorrent 5
+	StateQueuedUP           TorrentState = "queuedUP"
+	StateStalledUP          TorrentState = "stalledUP" // Seeding without peers to upload to
+	StateCheckingUP         TorrentState = "checkingUP"
+	StateForcedUP           TorrentState = "forcedUP"
+	StateAllocating         TorrentState = "allocating"
+	StateDownloading        TorrentState = "downloading"
+	StateMetaDL             TorrentState = "metaDL" // Fetching the metadata of a magnet link
+	StateForcedMetaDL       TorrentState = "forcedMetaDL"
+	StateStoppedDL          TorrentState = "stoppedDL" // Incomplete and stopped, pausedDL before qBittorrent 5
+	StateQueuedDL           TorrentState = "queuedDL"
+	StateStalledDL          TorrentState = "stalledDL" // Downloading without peers to download from
+	StateCheckingDL         TorrentState = "checkingDL"
+	StateForcedDL           TorrentState = "forcedDL"
+	StateCheckingResumeData TorrentState = "checkingResumeData" // Checking the data when qBittorrent starts
+	StateMoving             TorrentState = "moving"
+	StateUnknown            TorrentState = "unknown"
+
+	// States of qBittorrent 4 that are decoded as their stopped equivalents
+	StatePausedUP TorrentState = "pausedUP"
+	StatePausedDL TorrentState = "pausedDL"
+)
+
+// Normalize returns the state as qBittorrent 5 names it
+func (s TorrentState) Normalize() TorrentState {
+	switch s {
+	case StatePausedUP:
+		return StateStoppedUP
+	case StatePausedDL:
+		return StateStoppedDL
+	}
+	return s
+}
+
+// IsComplete reports whether the state is one of a torrent that has all its wanted data
+func (s TorrentState) IsComplete() bool {
+	switch s.Normalize() {
+	case StateUploading, StateStoppedUP, StateQueuedUP, StateStalledUP, StateCheckingUP, StateForcedUP:
+		return true
+	}
+	return false
+}
+
+// IsChecking reports whether qBittorrent is verifying the data of the torrent
+func (s TorrentState) IsChecking() bool {
+	switch s {
+	case StateCheckingUP, StateCheckingDL, StateCheckingResumeData:
+		return true
+	}
+	return false
+}
+
+// IsErrored reports whether qBittorrent can't use the data of the torrent
+func (s TorrentState) IsErrored() bool {
+	return s == StateError || s == StateMissingFiles
+}
+
+// IsPaused reports whether the torrent is stopped, or paused before qBittorrent 5
+func (s TorrentState) IsPaused() bool {
+	switch s.Normalize() {
+	case StateStoppedUP, StateStoppedDL:
+		return true
+	}
+	return false
+}
+
+// UnmarshalJSON decodes a state, normalizing it to the qBittorrent 5 names
+func (s *TorrentState) UnmarshalJSON(data []byte) error {
+	var state string
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	*s = TorrentState(state).Normalize()
+	return nil
+}
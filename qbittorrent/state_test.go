@@ -0,0 +1,44 @@
+package qbittorrent
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestTorrentState tests decoding states of both API generations and the state predicates
+func TestTorrentState(t *testing.T) {
+	var torrents []Torrent
+	data := `[{"state": "pausedUP"}, {"state": "stoppedUP"}, {"state": "pausedDL"}, {"state": "stalledDL"}, {"state": "somethingNew"}]`
+	if err := json.Unmarshal([]byte(data), &torrents); err != nil {
+		t.Fatalf("Failed to decode torrents: %v", err)
+	}
+	want := []TorrentState{StateStoppedUP, StateStoppedUP, StateStoppedDL, StateStalledDL, "somethingNew"}
+	for i, torrent := range torrents {
+		if torrent.State != want[i] {
+			t.Errorf("Expected state %s, got %s", want[i], torrent.State)
+		}
+	}
+
+	tests := []struct {
+		state                               TorrentState
+		complete, checking, errored, paused bool
+	}{
+		{StateUploading, true, false, false, false},
+		{StateStoppedUP, true, false, false, true},
+		{StatePausedUP, true, false, false, true},
+		{StateCheckingUP, true, true, false, false},
+		{StateCheckingResumeData, false, true, false, false},
+		{StatePausedDL, false, false, false, true},
+		{StateStalledDL, false, false, false, false},
+		{StateMissingFiles, false, false, true, false},
+		{StateError, false, false, true, false},
+		{StateMoving, false, false, false, false},
+	}
+	for _, tt := range tests {
+		s := tt.state
+		if s.IsComplete() != tt.complete || s.IsChecking() != tt.checking || s.IsErrored() != tt.errored || s.IsPaused() != tt.paused {
+			t.Errorf("Unexpected predicates for %s: complete %v, checking %v, errored %v, paused %v",
+				s, s.IsComplete(), s.IsChecking(), s.IsErrored(), s.IsPaused())
+		}
+	}
+}
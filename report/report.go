@@ -0,0 +1,169 @@
+// Package report renders cleaner run summaries as a table, JSON or CSV
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mallox/qbittorrent-cleaner/cleaner"
+)
+
+// Supported report formats
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+	FormatCSV   = "csv"
+)
+
+// Write renders the summary to w in the given format
+func Write(w io.Writer, format string, s *cleaner.Summary) error {
+	switch strings.ToLower(format) {
+	case "", FormatTable:
+		return WriteTable(w, s)
+	case FormatJSON:
+		return WriteJSON(w, s)
+	case FormatCSV:
+		return WriteCSV(w, s)
+	default:
+		return fmt.Errorf("unknown report format %q", format)
+	}
+}
+
+// WriteTable renders the summary as a human-readable table
+func WriteTable(w io.Writer, s *cleaner.Summary) error {
+	fmt.Fprintf(w, "Run %s finished in %s\n\n", s.RunID, s.Duration().Round(time.Millisecond))
+	if s.Aborted {
+		fmt.Fprintf(w, "ABORTED, nothing was removed: %s\n\n", s.AbortReason)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "CATEGORY\tTOTAL\tCHECKED\tSKIPPED\tHEALTHY\tREMOVED\tFAILED\tRECLAIMED\t")
+	for _, name := range categoryNames(s) {
+		writeTableRow(tw, name, s.Categories[name])
+	}
+	writeTableRow(tw, "total", &s.Counts)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(s.Removals) > 0 {
+		fmt.Fprintln(w, "\nRemoved:")
+		for _, r := range s.Removals {
+			if r.KeepData {
+				fmt.Fprintf(w, "  %s (%s, %d missing, %s kept on disk)\n", r.Name, r.Rule, len(r.MissingFiles), FormatBytes(r.Size))
+				continue
+			}
+			fmt.Fprintf(w, "  %s (%s, %d missing, %s reclaimed)\n", r.Name, r.Rule, len(r.MissingFiles), FormatBytes(r.Size))
+		}
+	}
+
+	if s.DryRun && len(s.Candidates) > 0 {
+		fmt.Fprintln(w, "\nWould remove:")
+		for _, r := range s.Candidates {
+			fmt.Fprintf(w, "  %s %s (%s, %d missing)\n", r.Hash, r.Name, r.Rule, len(r.MissingFiles))
+			for _, name := range r.MissingFiles {
+				fmt.Fprintf(w, "    %s\n", name)
+			}
+		}
+	}
+
+	if len(s.Staged) > 0 {
+		fmt.Fprintln(w, "\nStaged for approval:")
+		for _, r := range s.Staged {
+			fmt.Fprintf(w, "  %s %s (%s, %d missing)\n", r.Hash, r.Name, r.Rule, len(r.MissingFiles))
+		}
+	}
+
+	if len(s.Actions) > 0 {
+		if s.DryRun {
+			fmt.Fprintln(w, "\nWould apply:")
+		} else {
+			fmt.Fprintln(w, "\nApplied:")
+		}
+		for _, r := range s.Actions {
+			fmt.Fprintf(w, "  %s %s (%s, %s)\n", r.Hash, r.Name, r.Rule, r.Action)
+		}
+	}
+
+	if len(s.Failures) > 0 {
+		fmt.Fprintln(w, "\nFailed:")
+		for _, f := range s.Failures {
+			fmt.Fprintf(w, "  %s (%s): %s\n", f.Name, f.Stage, f.Error)
+		}
+	}
+
+	return nil
+}
+
+// writeTableRow writes a single row of counts to the table
+func writeTableRow(w io.Writer, name string, c *cleaner.Counts) {
+	fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%s\t\n",
+		name, c.Total, c.Checked, c.Skipped, c.Healthy, c.Removed, c.Failed, FormatBytes(c.BytesReclaimed))
+}
+
+// WriteJSON renders the summary as indented JSON
+func WriteJSON(w io.Writer, s *cleaner.Summary) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+// WriteCSV renders the per-category breakdown as CSV, followed by a total row
+func WriteCSV(w io.Writer, s *cleaner.Summary) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"run_id", "aborted", "category", "total", "checked", "skipped", "healthy", "removed", "failed", "bytes_reclaimed"})
+
+	row := func(name string, c *cleaner.Counts) {
+		cw.Write([]string{
+			s.RunID,
+			strconv.FormatBool(s.Aborted),
+			name,
+			strconv.Itoa(c.Total),
+			strconv.Itoa(c.Checked),
+			strconv.Itoa(c.Skipped),
+			strconv.Itoa(c.Healthy),
+			strconv.Itoa(c.Removed),
+			strconv.Itoa(c.Failed),
+			strconv.FormatInt(c.BytesReclaimed, 10),
+		})
+	}
+	for _, name := range categoryNames(s) {
+		row(name, s.Categories[name])
+	}
+	row("total", &s.Counts)
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// categoryNames returns the summary's categories in alphabetical order
+func categoryNames(s *cleaner.Summary) []string {
+	names := make([]string, 0, len(s.Categories))
+	for name := range s.Categories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FormatBytes formats a byte count using binary units
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
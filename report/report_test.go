@@ -0,0 +1,141 @@
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mallox/qbittorrent-cleaner/cleaner"
+)
+
+// testSummary returns a summary with two categories and one removal
+func testSummary() *cleaner.Summary {
+	started := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	return &cleaner.Summary{
+		RunID:    "run-1",
+		Started:  started,
+		Finished: started.Add(1500 * time.Millisecond),
+		Counts:   cleaner.Counts{Total: 3, Checked: 2, Skipped: 1, Healthy: 1, Removed: 1, BytesReclaimed: 2048},
+		Categories: map[string]*cleaner.Counts{
+			"tv":     {Total: 2, Checked: 1, Skipped: 1, Healthy: 1},
+			"movies": {Total: 1, Checked: 1, Removed: 1, BytesReclaimed: 2048},
+		},
+		Removals: []cleaner.Removal{
+			{Hash: "abc", Name: "Some Movie", Rule: cleaner.RuleMissingFiles, MissingFiles: []string{"movie.mkv"}, Size: 2048},
+		},
+	}
+}
+
+// TestWriteTable tests the human-readable table
+func TestWriteTable(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, "", testSummary()); err != nil {
+		t.Fatalf("Failed to write table: %v", err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{"run-1", "1.5s", "CATEGORY", "movies", "total", "2.0 KiB", "Some Movie"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected table to contain '%s', got:\n%s", want, out)
+		}
+	}
+
+	// Categories are listed alphabetically before the total
+	if strings.Index(out, "movies") > strings.Index(out, "tv") {
+		t.Errorf("Expected categories in alphabetical order, got:\n%s", out)
+	}
+}
+
+// TestWriteTableAborted tests that an aborted pass is called out in the table
+func TestWriteTableAborted(t *testing.T) {
+	s := testSummary()
+	s.Aborted = true
+	s.AbortReason = "download directory /downloads is not accessible"
+
+	var buf bytes.Buffer
+	WriteTable(&buf, s)
+	if !strings.Contains(buf.String(), "ABORTED") || !strings.Contains(buf.String(), s.AbortReason) {
+		t.Errorf("Expected abort reason in table, got:\n%s", buf.String())
+	}
+}
+
+// TestWriteTableDryRun tests that a dry run lists the torrents it would remove
+func TestWriteTableDryRun(t *testing.T) {
+	s := testSummary()
+	s.DryRun = true
+	s.Removals = nil
+	s.Candidates = []cleaner.Removal{{Hash: "def", Name: "Broken Show", Rule: cleaner.RuleMissingFiles, MissingFiles: []string{"ep1.mkv"}}}
+
+	var buf bytes.Buffer
+	WriteTable(&buf, s)
+	for _, want := range []string{"Would remove", "Broken Show", "ep1.mkv"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Expected table to contain '%s', got:\n%s", want, buf.String())
+		}
+	}
+}
+
+// TestWriteJSON tests that the JSON report round-trips
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatJSON, testSummary()); err != nil {
+		t.Fatalf("Failed to write JSON: %v", err)
+	}
+
+	var got cleaner.Summary
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("Failed to parse JSON report: %v", err)
+	}
+
+	if got.Removed != 1 || got.BytesReclaimed != 2048 || got.Categories["tv"].Skipped != 1 {
+		t.Errorf("Unexpected decoded summary: %+v", got)
+	}
+}
+
+// TestWriteCSV tests the CSV breakdown
+func TestWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatCSV, testSummary()); err != nil {
+		t.Fatalf("Failed to write CSV: %v", err)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse CSV report: %v", err)
+	}
+
+	if len(rows) != 4 {
+		t.Fatalf("Expected header, two categories and a total, got %d rows", len(rows))
+	}
+
+	if rows[3][2] != "total" || rows[3][9] != "2048" {
+		t.Errorf("Unexpected total row: %v", rows[3])
+	}
+}
+
+// TestWriteUnknownFormat tests that unknown formats are rejected
+func TestWriteUnknownFormat(t *testing.T) {
+	if err := Write(&bytes.Buffer{}, "xml", testSummary()); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+// TestFormatBytes tests byte formatting
+func TestFormatBytes(t *testing.T) {
+	tests := map[int64]string{
+		0:           "0 B",
+		1023:        "1023 B",
+		1024:        "1.0 KiB",
+		1536:        "1.5 KiB",
+		5 * 1 << 30: "5.0 GiB",
+	}
+
+	for n, want := range tests {
+		if got := FormatBytes(n); got != want {
+			t.Errorf("FormatBytes(%d): expected '%s', got '%s'", n, want, got)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Duration is a time.Duration written as a string such as "36h" or "14d" in JSON
+type Duration time.Duration
+
+// String formats the duration like time.Duration does
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// MarshalJSON encodes the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON decodes a duration from a string
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"36h\" or \"14d\"")
+	}
+	parsed, err := ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// dayUnits matches the day and week units that time.ParseDuration lacks
+var dayUnits = regexp.MustCompile(`(\d+(?:\.\d+)?)([dw])`)
+
+// ParseDuration parses a duration like time.ParseDuration, also accepting days ("d") and
+// weeks ("w") such as "14d" or "1w12h"
+func ParseDuration(s string) (time.Duration, error) {
+	var extra time.Duration
+	rest := dayUnits.ReplaceAllStringFunc(s, func(match string) string {
+		parts := dayUnits.FindStringSubmatch(match)
+		n, _ := strconv.ParseFloat(parts[1], 64)
+		unit := 24 * time.Hour
+		if parts[2] == "w" {
+			unit *= 7
+		}
+		extra += time.Duration(n * float64(unit))
+		return ""
+	})
+	if rest == "" {
+		if s == "" {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return extra, nil
+	}
+
+	d, err := time.ParseDuration(rest)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return d + extra, nil
+}
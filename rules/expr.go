@@ -0,0 +1,499 @@
+package rules
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/mallox/qbittorrent-cleaner/qbittorrent"
+)
+
+// Expr is a compiled boolean expression over the fields of a torrent, such as
+// `ratio > 2 && seeding_time > 14d && category == "tv"`
+type Expr struct {
+	src  string
+	eval evalFunc
+}
+
+// env is what an expression is evaluated against
+type env struct {
+	torrent *qbittorrent.Torrent
+	now     time.Time
+}
+
+// evalFunc computes the value of a node. The value's Go type follows the node's kind:
+// bool, float64, string, time.Duration, int64 for sizes or []string.
+type evalFunc func(e *env) any
+
+// kind is the type of a value in an expression
+type kind int
+
+const (
+	kindBool kind = iota
+	kindNumber
+	kindString
+	kindDuration
+	kindSize
+	kindList
+)
+
+// String names the kind in error messages
+func (k kind) String() string {
+	return [...]string{"bool", "number", "string", "duration", "size", "list"}[k]
+}
+
+// ordered reports whether values of the kind can be compared with < and >
+func (k kind) ordered() bool {
+	return k == kindNumber || k == kindDuration || k == kindSize
+}
+
+// field is a torrent field available in expressions
+type field struct {
+	kind kind
+	get  evalFunc
+}
+
+// fields lists the torrent fields available in expressions
+var fields = map[string]field{
+	"hash":         {kindString, func(e *env) any { return e.torrent.Hash }},
+	"name":         {kindString, func(e *env) any { return e.torrent.Name }},
+	"category":     {kindString, func(e *env) any { return e.torrent.Category }},
+	"tags":         {kindList, func(e *env) any { return e.torrent.TagList() }},
+	"tracker":      {kindString, func(e *env) any { return e.torrent.TrackerHost() }},
+	"state":        {kindString, func(e *env) any { return string(e.torrent.State.Normalize()) }},
+	"save_path":    {kindString, func(e *env) any { return e.torrent.SavePath }},
+	"complete":     {kindBool, func(e *env) any { return complete(*e.torrent) }},
+	"ratio":        {kindNumber, func(e *env) any { return e.torrent.Ratio }},
+	"seeding_time": {kindDuration, func(e *env) any { return time.Duration(e.torrent.SeedingTime) * time.Second }},
+	"age":          {kindDuration, func(e *env) any { return e.now.Sub(time.Unix(e.torrent.AddedOn, 0)) }},
+	"size":         {kindSize, func(e *env) any { return e.torrent.Size }},
+	"amount_left":  {kindSize, func(e *env) any { return e.torrent.AmountLeft }},
+	"progress":     {kindNumber, func(e *env) any { return e.torrent.Progress }},
+	"availability": {kindNumber, func(e *env) any { return e.torrent.Availability }},
+	"inactive":     {kindDuration, func(e *env) any { return e.torrent.Inactive(e.now) }},
+}
+
+// sizeUnits maps the units of size literals to bytes
+var sizeUnits = map[string]int64{
+	"B":   1,
+	"KB":  1000,
+	"MB":  1000 * 1000,
+	"GB":  1000 * 1000 * 1000,
+	"TB":  1000 * 1000 * 1000 * 1000,
+	"KiB": 1 << 10,
+	"MiB": 1 << 20,
+	"GiB": 1 << 30,
+	"TiB": 1 << 40,
+}
+
+// Compile parses an expression and checks its types. The expression must be a boolean.
+func Compile(src string) (*Expr, error) {
+	p := &parser{src: src}
+	if err := p.lex(); err != nil {
+		return nil, err
+	}
+
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.errorf(tok, "unexpected %q", tok.text)
+	}
+	if n.kind != kindBool {
+		return nil, fmt.Errorf("expression must be a condition, not a %s", n.kind)
+	}
+	return &Expr{src: src, eval: n.eval}, nil
+}
+
+// Eval reports whether the expression holds for a torrent at the given time
+func (x *Expr) Eval(t qbittorrent.Torrent, now time.Time) bool {
+	return x.eval(&env{torrent: &t, now: now}).(bool)
+}
+
+// String returns the source of the expression
+func (x *Expr) String() string {
+	return x.src
+}
+
+// Token kinds
+const (
+	tokEOF = iota
+	tokIdent
+	tokNumber // A number, possibly followed by a duration or size unit
+	tokString
+	tokOp
+)
+
+// token is a lexical token with its byte offset in the source
+type token struct {
+	kind int
+	text string
+	pos  int
+}
+
+// operators lists the operators, longest first so that "<=" is found before "<"
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~", "<", ">", "!", "(", ")", "[", "]", ","}
+
+// parser turns an expression into a tree of typed nodes
+type parser struct {
+	src    string
+	tokens []token
+	next   int
+}
+
+// node is a typed expression
+type node struct {
+	kind kind
+	eval evalFunc
+	// constant holds the value of literals, which regular expressions must be
+	constant any
+	// field names the torrent field the node reads, if it is one
+	field string
+}
+
+// lex splits the source into tokens
+func (p *parser) lex() error {
+	src := p.src
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsDigit(c) || (c == '.' && i+1 < len(src) && unicode.IsDigit(rune(src[i+1]))):
+			// Numbers run together with their units, as in 1.5GiB or 1w2d
+			start := i
+			for i < len(src) && (isIdentChar(rune(src[i])) || src[i] == '.') {
+				i++
+			}
+			p.tokens = append(p.tokens, token{tokNumber, src[start:i], start})
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(src) && isIdentChar(rune(src[i])) {
+				i++
+			}
+			p.tokens = append(p.tokens, token{tokIdent, src[start:i], start})
+		case c == '"' || c == '\'':
+			start := i
+			var b strings.Builder
+			for i++; i < len(src) && rune(src[i]) != c; i++ {
+				if src[i] == '\\' && i+1 < len(src) {
+					i++
+				}
+				b.WriteByte(src[i])
+			}
+			if i >= len(src) {
+				return fmt.Errorf("at position %d: unterminated string", start+1)
+			}
+			i++
+			p.tokens = append(p.tokens, token{tokString, b.String(), start})
+		default:
+			op := ""
+			for _, candidate := range operators {
+				if strings.HasPrefix(src[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return fmt.Errorf("at position %d: unexpected %q", i+1, c)
+			}
+			p.tokens = append(p.tokens, token{tokOp, op, i})
+			i += len(op)
+		}
+	}
+	p.tokens = append(p.tokens, token{tokEOF, "end of expression", len(src)})
+	return nil
+}
+
+// isIdentChar reports whether c can be part of an identifier
+func isIdentChar(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_'
+}
+
+// peek returns the next token without consuming it
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+// take consumes the next token
+func (p *parser) take() token {
+	tok := p.tokens[p.next]
+	if tok.kind != tokEOF {
+		p.next++
+	}
+	return tok
+}
+
+// accept consumes the next token if it is the given operator or keyword
+func (p *parser) accept(text string) bool {
+	if tok := p.peek(); (tok.kind == tokOp || tok.kind == tokIdent) && tok.text == text {
+		p.next++
+		return true
+	}
+	return false
+}
+
+// errorf returns an error pointing at a token
+func (p *parser) errorf(tok token, format string, args ...any) error {
+	return fmt.Errorf("at position %d: %s", tok.pos+1, fmt.Sprintf(format, args...))
+}
+
+// parseOr parses a || b || ...
+func (p *parser) parseOr() (*node, error) {
+	return p.parseLogical("||", p.parseAnd, func(a, b evalFunc) evalFunc {
+		return func(e *env) any { return a(e).(bool) || b(e).(bool) }
+	})
+}
+
+// parseAnd parses a && b && ...
+func (p *parser) parseAnd() (*node, error) {
+	return p.parseLogical("&&", p.parseNot, func(a, b evalFunc) evalFunc {
+		return func(e *env) any { return a(e).(bool) && b(e).(bool) }
+	})
+}
+
+// parseLogical parses a chain of boolean operands joined by op
+func (p *parser) parseLogical(op string, operand func() (*node, error), join func(a, b evalFunc) evalFunc) (*node, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		if !p.accept(op) {
+			return left, nil
+		}
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		if left.kind != kindBool || right.kind != kindBool {
+			return nil, p.errorf(tok, "%s needs conditions on both sides, got %s and %s", op, left.kind, right.kind)
+		}
+		left = &node{kind: kindBool, eval: join(left.eval, right.eval)}
+	}
+}
+
+// parseNot parses !a
+func (p *parser) parseNot() (*node, error) {
+	tok := p.peek()
+	if !p.accept("!") {
+		return p.parseComparison()
+	}
+	operand, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	if operand.kind != kindBool {
+		return nil, p.errorf(tok, "! needs a condition, got %s", operand.kind)
+	}
+	return &node{kind: kindBool, eval: func(e *env) any { return !operand.eval(e).(bool) }}, nil
+}
+
+// parseComparison parses a single comparison, or a plain operand
+func (p *parser) parseComparison() (*node, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	tok := p.peek()
+	isComparison := (tok.kind == tokOp && slices.Contains([]string{"==", "!=", "<", "<=", ">", ">=", "=~", "!~"}, tok.text)) ||
+		(tok.kind == tokIdent && tok.text == "in")
+	if !isComparison {
+		return left, nil
+	}
+	p.take()
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	// States compared against are written with the qBittorrent 5 names, like the field.
+	// Regular expressions are left alone.
+	if left.field == "state" && tok.text != "=~" && tok.text != "!~" {
+		right = normalizeStates(right)
+	}
+
+	switch tok.text {
+	case "=~", "!~":
+		return p.match(tok, left, right)
+	case "in":
+		return p.contains(tok, left, right)
+	default:
+		return p.compare(tok, left, right)
+	}
+}
+
+// compare builds an equality or ordering comparison
+func (p *parser) compare(tok token, left, right *node) (*node, error) {
+	if left.kind != right.kind {
+		hint := ""
+		if (left.kind == kindNumber) != (right.kind == kindNumber) && (left.kind.ordered() && right.kind.ordered()) {
+			hint = ", write durations like 14d and sizes like 10GiB"
+		}
+		return nil, p.errorf(tok, "cannot compare %s with %s%s", left.kind, right.kind, hint)
+	}
+	if left.kind == kindList {
+		return nil, p.errorf(tok, "cannot compare lists, use in")
+	}
+	op := tok.text
+	if !left.kind.ordered() && op != "==" && op != "!=" {
+		return nil, p.errorf(tok, "%s cannot be used with %s values", op, left.kind)
+	}
+
+	a, b := left.eval, right.eval
+	if op == "==" || op == "!=" {
+		want := op == "=="
+		return &node{kind: kindBool, eval: func(e *env) any { return (a(e) == b(e)) == want }}, nil
+	}
+
+	var holds func(x, y float64) bool
+	switch op {
+	case "<":
+		holds = func(x, y float64) bool { return x < y }
+	case "<=":
+		holds = func(x, y float64) bool { return x <= y }
+	case ">":
+		holds = func(x, y float64) bool { return x > y }
+	case ">=":
+		holds = func(x, y float64) bool { return x >= y }
+	}
+	return &node{kind: kindBool, eval: func(e *env) any { return holds(number(a(e)), number(b(e))) }}, nil
+}
+
+// number converts an ordered value to a float64 for comparison
+func number(v any) float64 {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case time.Duration:
+		return float64(v)
+	case int64:
+		return float64(v)
+	}
+	panic(fmt.Sprintf("not a number: %v", v))
+}
+
+// match builds a regular expression match, compiling the pattern once
+func (p *parser) match(tok token, left, right *node) (*node, error) {
+	if left.kind != kindString {
+		return nil, p.errorf(tok, "%s needs a string on the left, got %s", tok.text, left.kind)
+	}
+	pattern, ok := right.constant.(string)
+	if !ok {
+		return nil, p.errorf(tok, "%s needs a quoted regular expression on the right", tok.text)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, p.errorf(tok, "invalid regular expression: %v", err)
+	}
+
+	want := tok.text == "=~"
+	subject := left.eval
+	return &node{kind: kindBool, eval: func(e *env) any { return re.MatchString(subject(e).(string)) == want }}, nil
+}
+
+// contains builds a list membership test
+func (p *parser) contains(tok token, left, right *node) (*node, error) {
+	if left.kind != kindString || right.kind != kindList {
+		return nil, p.errorf(tok, "in needs a string on the left and a list on the right, got %s and %s", left.kind, right.kind)
+	}
+	item, list := left.eval, right.eval
+	return &node{kind: kindBool, eval: func(e *env) any { return slices.Contains(list(e).([]string), item(e).(string)) }}, nil
+}
+
+// parseOperand parses a literal, a field, a list or a parenthesized expression
+func (p *parser) parseOperand() (*node, error) {
+	tok := p.take()
+	switch {
+	case tok.kind == tokOp && tok.text == "(":
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, p.errorf(p.peek(), "expected ) but found %q", p.peek().text)
+		}
+		return n, nil
+
+	case tok.kind == tokOp && tok.text == "[":
+		var items []string
+		for !p.accept("]") {
+			if len(items) > 0 && !p.accept(",") {
+				return nil, p.errorf(p.peek(), "expected , or ] but found %q", p.peek().text)
+			}
+			item := p.take()
+			if item.kind != tokString {
+				return nil, p.errorf(item, "lists can only hold quoted strings")
+			}
+			items = append(items, item.text)
+		}
+		return literal(kindList, items), nil
+
+	case tok.kind == tokString:
+		return literal(kindString, tok.text), nil
+
+	case tok.kind == tokNumber:
+		return p.number(tok)
+
+	case tok.kind == tokIdent && (tok.text == "true" || tok.text == "false"):
+		return literal(kindBool, tok.text == "true"), nil
+
+	case tok.kind == tokIdent:
+		f, ok := fields[tok.text]
+		if !ok {
+			return nil, p.errorf(tok, "unknown field %q", tok.text)
+		}
+		return &node{kind: f.kind, eval: f.get, field: tok.text}, nil
+	}
+	return nil, p.errorf(tok, "unexpected %q", tok.text)
+}
+
+// number parses a number, duration or size literal
+func (p *parser) number(tok token) (*node, error) {
+	if n, err := strconv.ParseFloat(tok.text, 64); err == nil {
+		return literal(kindNumber, n), nil
+	}
+
+	// Sizes end in one of the size units, everything else must be a duration
+	digits := strings.TrimRightFunc(tok.text, unicode.IsLetter)
+	if unit, ok := sizeUnits[tok.text[len(digits):]]; ok {
+		n, err := strconv.ParseFloat(digits, 64)
+		if err != nil {
+			return nil, p.errorf(tok, "invalid size %q", tok.text)
+		}
+		return literal(kindSize, int64(n*float64(unit))), nil
+	}
+
+	d, err := ParseDuration(tok.text)
+	if err != nil {
+		return nil, p.errorf(tok, "invalid number, duration or size %q", tok.text)
+	}
+	return literal(kindDuration, d), nil
+}
+
+// normalizeStates renames the qBittorrent 4 states in a string or list literal
+func normalizeStates(n *node) *node {
+	switch v := n.constant.(type) {
+	case string:
+		return literal(n.kind, string(qbittorrent.TorrentState(v).Normalize()))
+	case []string:
+		states := make([]string, len(v))
+		for i, state := range v {
+			states[i] = string(qbittorrent.TorrentState(state).Normalize())
+		}
+		return literal(n.kind, states)
+	}
+	return n
+}
+
+// literal creates a node with a constant value
+func literal(k kind, value any) *node {
+	return &node{kind: k, eval: func(*env) any { return value }, constant: value}
+}
@@ -0,0 +1,206 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mallox/qbittorrent-cleaner/qbittorrent"
+)
+
+// exprTorrent is the torrent expressions are evaluated against in tests
+var exprTorrent = qbittorrent.Torrent{
+	Hash:         "abc",
+	Name:         "Some.Show.S01E01.720p",
+	Category:     "tv",
+	Tags:         "private, keep",
+	Tracker:      "https://tracker.example.org/announce",
+	State:        "stalledUP",
+	Ratio:        2.5,
+	SeedingTime:  int64((15 * 24 * time.Hour).Seconds()),
+	AddedOn:      exprNow.Add(-30 * 24 * time.Hour).Unix(),
+	Size:         2 << 30,
+	Progress:     1,
+	Availability: 3.5,
+	LastActivity: exprNow.Add(-2 * time.Hour).Unix(),
+}
+
+// exprNow is the time expressions are evaluated at in tests
+var exprNow = time.Unix(1_700_000_000, 0)
+
+// testExprs compiles and evaluates each expression and compares the result
+func testExprs(t *testing.T, tests map[string]bool) {
+	t.Helper()
+	for src, want := range tests {
+		expr, err := Compile(src)
+		if err != nil {
+			t.Errorf("Failed to compile %s: %v", src, err)
+			continue
+		}
+		if got := expr.Eval(exprTorrent, exprNow); got != want {
+			t.Errorf("Expected %s to be %v, got %v", src, want, got)
+		}
+	}
+}
+
+// TestExprEquality tests == and !=
+func TestExprEquality(t *testing.T) {
+	testExprs(t, map[string]bool{
+		`category == "tv"`:                 true,
+		`category == 'movies'`:             false,
+		`category != "movies"`:             true,
+		`tracker == "tracker.example.org"`: true,
+		`complete == true`:                 true,
+		`complete != true`:                 false,
+		`ratio == 2.5`:                     true,
+		`seeding_time != 15d`:              false,
+		`size == 2GiB`:                     true,
+	})
+}
+
+// TestExprOrdering tests <, <=, > and >= on numbers, durations and sizes
+func TestExprOrdering(t *testing.T) {
+	testExprs(t, map[string]bool{
+		`ratio > 2`:            true,
+		`ratio > 2.5`:          false,
+		`ratio >= 2.5`:         true,
+		`ratio < 3`:            true,
+		`ratio <= 2.4`:         false,
+		`seeding_time > 14d`:   true,
+		`seeding_time >= 2w1d`: true,
+		`seeding_time < 360h`:  false,
+		`age <= 30d`:           true,
+		`age < 4w`:             false,
+		`size > 1GiB`:          true,
+		`size >= 2.5GB`:        false,
+		`size < 3000MB`:        true,
+		`amount_left <= 0B`:    true,
+		`progress >= 1`:        true,
+		`availability < 1`:     false,
+		`inactive > 1h`:        true,
+		`inactive > 1d`:        false,
+	})
+}
+
+// TestExprMatch tests =~ and !~
+func TestExprMatch(t *testing.T) {
+	testExprs(t, map[string]bool{
+		`name =~ "(?i)s01e\\d+"`: true,
+		`name =~ "1080p"`:        false,
+		`name !~ "1080p"`:        true,
+		`state !~ "^stalled"`:    false,
+	})
+}
+
+// TestExprIn tests membership in lists and in the tags
+func TestExprIn(t *testing.T) {
+	testExprs(t, map[string]bool{
+		`"keep" in tags`:               true,
+		`"public" in tags`:             false,
+		`category in ["tv", "movies"]`: true,
+		`category in ["movies"]`:       false,
+		`state in []`:                  false,
+	})
+}
+
+// TestExprStates tests that states of qBittorrent 4 compare equal to their qBittorrent 5 names
+func TestExprStates(t *testing.T) {
+	stopped := exprTorrent
+	stopped.State = qbittorrent.StateStoppedUP
+	for src, want := range map[string]bool{
+		`state == "pausedUP"`:               true,
+		`state == "stoppedUP"`:              true,
+		`state != "pausedUP"`:               false,
+		`state in ["pausedDL", "pausedUP"]`: true,
+		`state =~ "^paused"`:                false,
+	} {
+		expr, err := Compile(src)
+		if err != nil {
+			t.Fatalf("Failed to compile %s: %v", src, err)
+		}
+		if got := expr.Eval(stopped, exprNow); got != want {
+			t.Errorf("Expected %s to be %v, got %v", src, want, got)
+		}
+	}
+}
+
+// TestExprLogic tests !, && and || with their precedence and parentheses
+func TestExprLogic(t *testing.T) {
+	testExprs(t, map[string]bool{
+		`complete`:                                            true,
+		`!complete`:                                           false,
+		`!!complete`:                                          true,
+		`ratio > 2 && category == "tv"`:                       true,
+		`ratio > 2 && category == "movies"`:                   false,
+		`ratio > 3 || category == "tv"`:                       true,
+		`ratio > 3 || category == "movies"`:                   false,
+		`ratio > 3 && false || true`:                          true,
+		`ratio > 3 && (false || true)`:                        false,
+		`!(ratio > 3) && seeding_time > 14d`:                  true,
+		`ratio > 2 && seeding_time > 14d && category == "tv"`: true,
+	})
+}
+
+// TestExprErrors tests that invalid expressions are rejected when compiled
+func TestExprErrors(t *testing.T) {
+	tests := map[string]string{
+		``:                            "unexpected",
+		`ratio`:                       "must be a condition",
+		`ratoi > 2`:                   `unknown field "ratoi"`,
+		`ratio > "2"`:                 "cannot compare number with string",
+		`seeding_time > 14`:           "write durations like 14d",
+		`size > 10`:                   "write durations like 14d and sizes like 10GiB",
+		`size > 14d`:                  "cannot compare size with duration",
+		`category > "tv"`:             "> cannot be used with string",
+		`tags == ["a"]`:               "cannot compare lists",
+		`name =~ category`:            "quoted regular expression",
+		`name =~ "("`:                 "invalid regular expression",
+		`ratio =~ "1"`:                "needs a string on the left",
+		`"a" in category`:             "in needs a string on the left and a list",
+		`ratio && complete`:           "&& needs conditions on both sides",
+		`!ratio`:                      "! needs a condition",
+		`(complete`:                   "expected )",
+		`complete)`:                   `unexpected ")"`,
+		`category == "tv`:             "unterminated string",
+		`category in ["tv" "movies"]`: "expected , or ]",
+		`category in [tv]`:            "quoted strings",
+		`size > 10XB`:                 "invalid number, duration or size",
+		`ratio # 2`:                   `unexpected '#'`,
+	}
+
+	for src, want := range tests {
+		_, err := Compile(src)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected compiling %q to fail with %q, got %v", src, want, err)
+		}
+	}
+}
+
+// TestExprPosition tests that errors point at the offending token
+func TestExprPosition(t *testing.T) {
+	_, err := Compile(`complete && ratoi > 2`)
+	if err == nil || !strings.HasPrefix(err.Error(), "at position 13:") {
+		t.Errorf("Expected an error at position 13, got %v", err)
+	}
+}
+
+// TestRuleExpr tests expressions as a rule condition
+func TestRuleExpr(t *testing.T) {
+	rules, err := Parse([]byte(`[{"name": "r", "match": {"category": ["tv"], "expr": "ratio > 2 && seeding_time > 14d"}, "action": "delete"}]`))
+	if err != nil {
+		t.Fatalf("Failed to parse rules: %v", err)
+	}
+	if ok, reason := rules[0].Check(exprTorrent, exprNow); !ok {
+		t.Errorf("Expected the rule to match, got %s", reason)
+	}
+
+	low := exprTorrent
+	low.Ratio = 1
+	if ok, reason := rules[0].Check(low, exprNow); ok || !strings.Contains(reason, "expression") {
+		t.Errorf("Expected the expression not to match, got %v, %s", ok, reason)
+	}
+
+	if _, err := Parse([]byte(`[{"name": "r", "match": {"expr": "ratio >"}, "action": "delete"}]`)); err == nil || !strings.Contains(err.Error(), "invalid expression") {
+		t.Errorf("Expected an invalid expression to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mallox/qbittorrent-cleaner/qbittorrent"
+)
+
+// Protection keeps torrents of private trackers from being removed before they met the
+// tracker's seeding requirements, which would count as a hit and run. Like most trackers
+// require, meeting either the seeding time or the ratio is enough.
+type Protection struct {
+	Trackers       []string `json:"tracker"` // Tracker host names, also matching their subdomains
+	MinSeedingTime Duration `json:"min_seeding_time,omitempty"`
+	MinRatio       float64  `json:"min_ratio,omitempty"`
+}
+
+// ParseProtections reads a JSON list of protections and validates them
+func ParseProtections(data []byte) ([]Protection, error) {
+	var protections []Protection
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&protections); err != nil {
+		return nil, fmt.Errorf("parsing protections failed: %w", err)
+	}
+
+	for i, p := range protections {
+		if len(p.Trackers) == 0 {
+			return nil, fmt.Errorf("protection %d: tracker is required", i+1)
+		}
+		if p.MinSeedingTime < 0 || p.MinRatio < 0 || (p.MinSeedingTime == 0 && p.MinRatio == 0) {
+			return nil, fmt.Errorf("protection %d: a positive min_seeding_time, min_ratio or both are required", i+1)
+		}
+	}
+	return protections, nil
+}
+
+// LoadProtections reads the protections from a JSON file
+func LoadProtections(path string) ([]Protection, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading protections failed: %w", err)
+	}
+	return ParseProtections(data)
+}
+
+// Covers reports whether the protection applies to a tracker host
+func (p *Protection) Covers(host string) bool {
+	return host != "" && slices.ContainsFunc(p.Trackers, func(pattern string) bool { return matchHost(host, pattern) })
+}
+
+// Satisfied reports whether a torrent met the seeding requirements
+func (p *Protection) Satisfied(t qbittorrent.Torrent) bool {
+	seeding := time.Duration(t.SeedingTime) * time.Second
+	return (p.MinRatio > 0 && t.Ratio >= p.MinRatio) || (p.MinSeedingTime > 0 && seeding >= time.Duration(p.MinSeedingTime))
+}
+
+// Requirements describes how far a torrent is from meeting the seeding requirements
+func (p *Protection) Requirements(t qbittorrent.Torrent) string {
+	var parts []string
+	if p.MinSeedingTime > 0 {
+		parts = append(parts, fmt.Sprintf("seeding time %s of %s", time.Duration(t.SeedingTime)*time.Second, p.MinSeedingTime))
+	}
+	if p.MinRatio > 0 {
+		parts = append(parts, fmt.Sprintf("ratio %.2f of %.2f", t.Ratio, p.MinRatio))
+	}
+	return strings.Join(parts, " or ")
+}
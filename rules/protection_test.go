@@ -0,0 +1,71 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mallox/qbittorrent-cleaner/qbittorrent"
+)
+
+// TestParseProtections tests that invalid protections are rejected when they are loaded
+func TestParseProtections(t *testing.T) {
+	tests := []struct {
+		name        string
+		protections string
+		err         string
+	}{
+		{"valid", `[{"tracker": ["tracker.example.org"], "min_seeding_time": "3d", "min_ratio": 1}]`, ""},
+		{"empty", `[]`, ""},
+		{"unknown field", `[{"tracker": ["a.org"], "ratio": 1}]`, "unknown field"},
+		{"missing tracker", `[{"min_ratio": 1}]`, "tracker is required"},
+		{"no requirement", `[{"tracker": ["a.org"]}]`, "are required"},
+		{"negative", `[{"tracker": ["a.org"], "min_ratio": -1}]`, "are required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseProtections([]byte(tt.protections))
+			if tt.err == "" && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("Expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+// TestProtection tests which trackers a protection covers and when its requirements are met
+func TestProtection(t *testing.T) {
+	protections, err := ParseProtections([]byte(`[{"tracker": ["example.org"], "min_seeding_time": "3d", "min_ratio": 1}]`))
+	if err != nil {
+		t.Fatalf("Failed to parse protections: %v", err)
+	}
+	p := protections[0]
+
+	for host, want := range map[string]bool{"example.org": true, "tracker.example.org": true, "example.com": false, "": false} {
+		if got := p.Covers(host); got != want {
+			t.Errorf("Expected %q to be covered %v, got %v", host, want, got)
+		}
+	}
+
+	day := int64((24 * time.Hour).Seconds())
+	tests := []struct {
+		torrent qbittorrent.Torrent
+		want    bool
+	}{
+		{qbittorrent.Torrent{SeedingTime: day, Ratio: 0.5}, false},
+		{qbittorrent.Torrent{SeedingTime: 3 * day, Ratio: 0.5}, true},
+		{qbittorrent.Torrent{SeedingTime: day, Ratio: 1}, true},
+	}
+	for _, tt := range tests {
+		if got := p.Satisfied(tt.torrent); got != tt.want {
+			t.Errorf("Expected %s to satisfy the protection %v, got %v", p.Requirements(tt.torrent), tt.want, got)
+		}
+	}
+
+	if got := p.Requirements(tests[0].torrent); got != "seeding time 24h0m0s of 72h0m0s or ratio 0.50 of 1.00" {
+		t.Errorf("Unexpected requirements: %s", got)
+	}
+}
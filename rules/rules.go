@@ -0,0 +1,332 @@
+// Package rules decides what happens to torrents using an ordered list of rules, of
+// which the first one that matches a torrent applies
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mallox/qbittorrent-cleaner/qbittorrent"
+)
+
+// Actions a rule can take on the torrents it matches
+const (
+	ActionDelete         = "delete"           // Remove the torrent and its files
+	ActionDeleteKeepData = "delete-keep-data" // Remove the torrent but keep its files
+	ActionTag            = "tag"              // Add tags to the torrent
+	ActionPause          = "pause"            // Pause the torrent
+	ActionNotify         = "notify"           // Only report the torrent to the notifiers
+)
+
+// actions lists the valid actions
+var actions = []string{ActionDelete, ActionDeleteKeepData, ActionTag, ActionPause, ActionNotify}
+
+// MissingFiles is the name of the default rule
+const MissingFiles = "missing-files"
+
+// Rule applies an action to the torrents matching all of its conditions
+type Rule struct {
+	Name   string     `json:"name"`
+	Match  Conditions `json:"match"`
+	Action string     `json:"action"`
+	Tags   []string   `json:"tags,omitempty"` // Tags added by the tag action
+	// Grace delays the action until the rule has matched the torrent on every pass for this long
+	Grace Duration `json:"grace,omitempty"`
+}
+
+// Conditions a torrent must all meet for a rule to match. Unset conditions match every
+// torrent, and conditions with a list match if any item does.
+type Conditions struct {
+	Categories     []string                   `json:"category,omitempty"`
+	Tags           []string                   `json:"tags,omitempty"`
+	Trackers       []string                   `json:"tracker,omitempty"` // Tracker host names, also matching their subdomains
+	States         []qbittorrent.TorrentState `json:"state,omitempty"`   // Decoded with the qBittorrent 5 names
+	MinRatio       float64                    `json:"min_ratio,omitempty"`
+	MaxRatio       float64                    `json:"max_ratio,omitempty"`
+	MinSeedingTime Duration                   `json:"min_seeding_time,omitempty"`
+	MaxSeedingTime Duration                   `json:"max_seeding_time,omitempty"`
+	MinAge         Duration                   `json:"min_age,omitempty"` // Time since the torrent was added
+	MaxAge         Duration                   `json:"max_age,omitempty"`
+	MinSize        int64                      `json:"min_size,omitempty"` // Bytes
+	MaxSize        int64                      `json:"max_size,omitempty"`
+	Name           string                     `json:"name,omitempty"`         // Regular expression matched against the torrent name
+	MinInactive    Duration                   `json:"min_inactive,omitempty"` // Time since data was last downloaded or uploaded
+	// MaxProgress matches torrents downloaded at most this far, from 0 to 1
+	MaxProgress *float64 `json:"max_progress,omitempty"`
+	// MaxAvailability matches torrents with at most this many complete copies among peers.
+	// Torrents whose availability qBittorrent doesn't know, such as paused ones, never match.
+	MaxAvailability *float64 `json:"max_availability,omitempty"`
+	// Complete matches torrents with nothing left to download. Torrents being moved, in error
+	// state or missing their files count as complete, since qBittorrent can't tell what they
+	// have left.
+	Complete *bool `json:"complete,omitempty"`
+	// Goal matches torrents that have met a seeding goal
+	Goal *Goal `json:"goal,omitempty"`
+	// Expr is a boolean expression over the torrent's fields, such as
+	// `ratio > 2 && seeding_time > 14d && category == "tv"`
+	Expr string `json:"expr,omitempty"`
+	// MissingFiles matches torrents with wanted files missing from the download directories.
+	// It is evaluated last, and only if every other condition matches.
+	MissingFiles *bool `json:"missing_files,omitempty"`
+	// InLibrary matches torrents whose payload was imported into the media library.
+	// It is evaluated after MissingFiles.
+	InLibrary *bool `json:"in_library,omitempty"`
+	// Unregistered matches torrents whose trackers all report that they don't know the
+	// torrent. It is evaluated after InLibrary.
+	Unregistered *bool `json:"unregistered,omitempty"`
+
+	name *regexp.Regexp
+	expr *Expr
+}
+
+// Goal is a seeding goal, which is met once either target is reached
+type Goal struct {
+	Ratio       float64  `json:"ratio,omitempty"`
+	SeedingTime Duration `json:"seeding_time,omitempty"`
+}
+
+// Met reports whether a torrent has reached either target of the goal
+func (g *Goal) Met(t qbittorrent.Torrent) bool {
+	seeding := time.Duration(t.SeedingTime) * time.Second
+	return (g.Ratio > 0 && t.Ratio >= g.Ratio) || (g.SeedingTime > 0 && seeding >= time.Duration(g.SeedingTime))
+}
+
+// progress describes how far a torrent is from the goal
+func (g *Goal) progress(t qbittorrent.Torrent) string {
+	var parts []string
+	if g.Ratio > 0 {
+		parts = append(parts, fmt.Sprintf("ratio %.2f of %.2f", t.Ratio, g.Ratio))
+	}
+	if g.SeedingTime > 0 {
+		parts = append(parts, fmt.Sprintf("seeding time %s of %s", time.Duration(t.SeedingTime)*time.Second, g.SeedingTime))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Default returns the rules used when none are configured: remove complete torrents
+// whose files are missing
+func Default() []Rule {
+	yes := true
+	return []Rule{{
+		Name:   MissingFiles,
+		Match:  Conditions{Complete: &yes, MissingFiles: &yes},
+		Action: ActionDelete,
+	}}
+}
+
+// Parse reads a JSON list of rules and validates them
+func Parse(data []byte) ([]Rule, error) {
+	var rules []Rule
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&rules); err != nil {
+		return nil, fmt.Errorf("parsing rules failed: %w", err)
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("no rules are defined")
+	}
+
+	names := map[string]bool{}
+	for i := range rules {
+		if err := rules[i].compile(); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		if names[rules[i].Name] {
+			return nil, fmt.Errorf("rule %d: name %q is used twice", i+1, rules[i].Name)
+		}
+		names[rules[i].Name] = true
+	}
+	return rules, nil
+}
+
+// Load reads the rules from a JSON file
+func Load(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading rules failed: %w", err)
+	}
+	return Parse(data)
+}
+
+// compile validates the rule and prepares its conditions for matching
+func (r *Rule) compile() error {
+	if r.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if !slices.Contains(actions, r.Action) {
+		return fmt.Errorf("%s: action must be one of %s, got %q", r.Name, strings.Join(actions, ", "), r.Action)
+	}
+	if (r.Action == ActionTag) != (len(r.Tags) > 0) {
+		return fmt.Errorf("%s: tags must be set for the tag action, and only for it", r.Name)
+	}
+
+	if r.Grace < 0 {
+		return fmt.Errorf("%s: grace must not be negative", r.Name)
+	}
+
+	m := &r.Match
+	if m.MinRatio < 0 || m.MaxRatio < 0 || m.MinSeedingTime < 0 || m.MaxSeedingTime < 0 ||
+		m.MinAge < 0 || m.MaxAge < 0 || m.MinSize < 0 || m.MaxSize < 0 || m.MinInactive < 0 ||
+		(m.MaxAvailability != nil && *m.MaxAvailability < 0) {
+		return fmt.Errorf("%s: limits must not be negative", r.Name)
+	}
+	if (m.MaxRatio > 0 && m.MinRatio > m.MaxRatio) || (m.MaxSeedingTime > 0 && m.MinSeedingTime > m.MaxSeedingTime) ||
+		(m.MaxAge > 0 && m.MinAge > m.MaxAge) || (m.MaxSize > 0 && m.MinSize > m.MaxSize) {
+		return fmt.Errorf("%s: a minimum is larger than its maximum", r.Name)
+	}
+
+	if m.MaxProgress != nil && (*m.MaxProgress < 0 || *m.MaxProgress > 1) {
+		return fmt.Errorf("%s: max_progress must be between 0 and 1", r.Name)
+	}
+	if m.Goal != nil && ((m.Goal.Ratio <= 0 && m.Goal.SeedingTime <= 0) || m.Goal.Ratio < 0 || m.Goal.SeedingTime < 0) {
+		return fmt.Errorf("%s: a goal needs a positive ratio, seeding time or both", r.Name)
+	}
+
+	if m.Name != "" {
+		re, err := regexp.Compile(m.Name)
+		if err != nil {
+			return fmt.Errorf("%s: invalid name pattern: %w", r.Name, err)
+		}
+		m.name = re
+	}
+
+	if m.Expr != "" {
+		expr, err := Compile(m.Expr)
+		if err != nil {
+			return fmt.Errorf("%s: invalid expression: %w", r.Name, err)
+		}
+		m.expr = expr
+	}
+	return nil
+}
+
+// Deletes reports whether the rule removes the torrents it matches
+func (r *Rule) Deletes() bool {
+	return r.Action == ActionDelete || r.Action == ActionDeleteKeepData
+}
+
+// ChecksFiles reports whether the rule needs to look for the files of a torrent
+func (r *Rule) ChecksFiles() bool {
+	return r.Match.MissingFiles != nil
+}
+
+// ChecksLibrary reports whether the rule needs to look for the payload of a torrent in the media library
+func (r *Rule) ChecksLibrary() bool {
+	return r.Match.InLibrary != nil
+}
+
+// ChecksTrackers reports whether the rule needs the trackers of a torrent
+func (r *Rule) ChecksTrackers() bool {
+	return r.Match.Unregistered != nil
+}
+
+// Check reports whether a torrent meets every condition of the rule except MissingFiles,
+// InLibrary and Unregistered, which the caller evaluates. If it doesn't, the reason names the first condition that failed.
+func (r *Rule) Check(t qbittorrent.Torrent, now time.Time) (bool, string) {
+	m := &r.Match
+
+	if len(m.Categories) > 0 && !slices.Contains(m.Categories, t.Category) {
+		return false, fmt.Sprintf("category %q is not one of %s", t.Category, strings.Join(m.Categories, ", "))
+	}
+	if len(m.Tags) > 0 && !slices.ContainsFunc(t.TagList(), func(tag string) bool { return slices.Contains(m.Tags, tag) }) {
+		return false, fmt.Sprintf("tags %q include none of %s", t.Tags, strings.Join(m.Tags, ", "))
+	}
+	if len(m.Trackers) > 0 && !slices.ContainsFunc(m.Trackers, func(host string) bool { return matchHost(t.TrackerHost(), host) }) {
+		return false, fmt.Sprintf("tracker %q is not one of %s", t.TrackerHost(), strings.Join(m.Trackers, ", "))
+	}
+	if len(m.States) > 0 && !slices.Contains(m.States, t.State.Normalize()) {
+		return false, fmt.Sprintf("state %s is not one of %s", t.State, joinStates(m.States))
+	}
+	if m.Complete != nil && complete(t) != *m.Complete {
+		if *m.Complete {
+			return false, fmt.Sprintf("not complete (%d bytes left, state %s)", t.AmountLeft, t.State)
+		}
+		return false, "complete"
+	}
+
+	if m.MinRatio > 0 && t.Ratio < m.MinRatio {
+		return false, fmt.Sprintf("ratio %.2f is below %.2f", t.Ratio, m.MinRatio)
+	}
+	if m.MaxRatio > 0 && t.Ratio > m.MaxRatio {
+		return false, fmt.Sprintf("ratio %.2f is above %.2f", t.Ratio, m.MaxRatio)
+	}
+
+	seeding := time.Duration(t.SeedingTime) * time.Second
+	if m.MinSeedingTime > 0 && seeding < time.Duration(m.MinSeedingTime) {
+		return false, fmt.Sprintf("seeding time %s is below %s", seeding, m.MinSeedingTime)
+	}
+	if m.MaxSeedingTime > 0 && seeding > time.Duration(m.MaxSeedingTime) {
+		return false, fmt.Sprintf("seeding time %s is above %s", seeding, m.MaxSeedingTime)
+	}
+
+	age := now.Sub(time.Unix(t.AddedOn, 0)).Truncate(time.Second)
+	if m.MinAge > 0 && age < time.Duration(m.MinAge) {
+		return false, fmt.Sprintf("age %s is below %s", age, m.MinAge)
+	}
+	if m.MaxAge > 0 && age > time.Duration(m.MaxAge) {
+		return false, fmt.Sprintf("age %s is above %s", age, m.MaxAge)
+	}
+
+	if m.MinSize > 0 && t.Size < m.MinSize {
+		return false, fmt.Sprintf("size %d is below %d bytes", t.Size, m.MinSize)
+	}
+	if m.MaxSize > 0 && t.Size > m.MaxSize {
+		return false, fmt.Sprintf("size %d is above %d bytes", t.Size, m.MaxSize)
+	}
+
+	if m.MinInactive > 0 {
+		if inactive := t.Inactive(now); inactive < time.Duration(m.MinInactive) {
+			return false, fmt.Sprintf("inactive for %s, below %s", inactive, m.MinInactive)
+		}
+	}
+	if m.MaxProgress != nil && t.Progress > *m.MaxProgress {
+		return false, fmt.Sprintf("progress %.1f%% is above %.1f%%", t.Progress*100, *m.MaxProgress*100)
+	}
+	if m.MaxAvailability != nil {
+		if t.Availability < 0 {
+			return false, "availability is unknown"
+		}
+		if t.Availability > *m.MaxAvailability {
+			return false, fmt.Sprintf("availability %.2f is above %.2f", t.Availability, *m.MaxAvailability)
+		}
+	}
+
+	if m.Goal != nil && !m.Goal.Met(t) {
+		return false, "seeding goal not met: " + m.Goal.progress(t)
+	}
+
+	if m.name != nil && !m.name.MatchString(t.Name) {
+		return false, fmt.Sprintf("name doesn't match %s", m.Name)
+	}
+
+	if m.expr != nil && !m.expr.Eval(t, now) {
+		return false, fmt.Sprintf("expression %s is false", m.Expr)
+	}
+
+	return true, ""
+}
+
+// complete reports whether a torrent counts as complete
+func complete(t qbittorrent.Torrent) bool {
+	return t.AmountLeft == 0 || t.State == qbittorrent.StateMoving || t.State.IsErrored()
+}
+
+// joinStates lists states separated by commas
+func joinStates(states []qbittorrent.TorrentState) string {
+	names := make([]string, len(states))
+	for i, state := range states {
+		names[i] = string(state)
+	}
+	return strings.Join(names, ", ")
+}
+
+// matchHost reports whether host is pattern or one of its subdomains
+func matchHost(host, pattern string) bool {
+	pattern = strings.ToLower(pattern)
+	return host == pattern || strings.HasSuffix(host, "."+pattern)
+}
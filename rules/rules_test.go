@@ -0,0 +1,188 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mallox/qbittorrent-cleaner/qbittorrent"
+)
+
+// TestParse tests that invalid rules are rejected when they are loaded
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+		err   string
+	}{
+		{"valid", `[{"name": "a", "match": {"min_seeding_time": "14d", "name": "^x"}, "action": "delete"}]`, ""},
+		{"empty", `[]`, "no rules"},
+		{"unknown field", `[{"name": "a", "match": {"ratio": 1}, "action": "delete"}]`, "unknown field"},
+		{"missing name", `[{"action": "delete"}]`, "name is required"},
+		{"duplicate name", `[{"name": "a", "action": "delete"}, {"name": "a", "action": "notify"}]`, "used twice"},
+		{"unknown action", `[{"name": "a", "action": "archive"}]`, "action must be one of"},
+		{"tag without tags", `[{"name": "a", "action": "tag"}]`, "tags must be set"},
+		{"tags without tag", `[{"name": "a", "action": "pause", "tags": ["x"]}]`, "tags must be set"},
+		{"bad duration", `[{"name": "a", "match": {"min_age": "soon"}, "action": "delete"}]`, "invalid duration"},
+		{"negative", `[{"name": "a", "match": {"min_size": -1}, "action": "delete"}]`, "negative"},
+		{"min above max", `[{"name": "a", "match": {"min_ratio": 2, "max_ratio": 1}, "action": "delete"}]`, "larger than its maximum"},
+		{"progress above 1", `[{"name": "a", "match": {"max_progress": 1.5}, "action": "delete"}]`, "between 0 and 1"},
+		{"negative availability", `[{"name": "a", "match": {"max_availability": -1}, "action": "delete"}]`, "negative"},
+		{"empty goal", `[{"name": "a", "match": {"goal": {}}, "action": "delete"}]`, "goal needs"},
+		{"negative goal", `[{"name": "a", "match": {"goal": {"ratio": -1, "seeding_time": "1d"}}, "action": "delete"}]`, "goal needs"},
+		{"negative grace", `[{"name": "a", "match": {"unregistered": true}, "grace": "-1h", "action": "delete"}]`, "grace must not be negative"},
+		{"bad pattern", `[{"name": "a", "match": {"name": "("}, "action": "delete"}]`, "invalid name pattern"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.rules))
+			if tt.err == "" && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("Expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+// TestCheck tests each match condition
+func TestCheck(t *testing.T) {
+	now := time.Unix(1_000_000, 0)
+	torrent := qbittorrent.Torrent{
+		Name:         "Some.Show.S01E01.720p",
+		Category:     "tv",
+		Tags:         "private, keep",
+		Tracker:      "https://announce.tracker.example.org/announce",
+		State:        "stalledUP",
+		Ratio:        1.5,
+		SeedingTime:  int64((48 * time.Hour).Seconds()),
+		AddedOn:      now.Add(-72 * time.Hour).Unix(),
+		Size:         1000,
+		Progress:     0.25,
+		Availability: 0.5,
+		LastActivity: now.Add(-36 * time.Hour).Unix(),
+	}
+
+	tests := []struct {
+		match string
+		want  bool
+	}{
+		{`{}`, true},
+		{`{"category": ["movies", "tv"]}`, true},
+		{`{"category": ["movies"]}`, false},
+		{`{"tags": ["keep"]}`, true},
+		{`{"tags": ["public"]}`, false},
+		{`{"tracker": ["tracker.example.org"]}`, true},
+		{`{"tracker": ["example.org"]}`, true},
+		{`{"tracker": ["other.org"]}`, false},
+		{`{"state": ["stalledUP", "uploading"]}`, true},
+		{`{"state": ["pausedUP"]}`, false},
+		{`{"complete": true}`, true},
+		{`{"complete": false}`, false},
+		{`{"min_ratio": 1.5}`, true},
+		{`{"min_ratio": 2}`, false},
+		{`{"max_ratio": 1}`, false},
+		{`{"min_seeding_time": "2d"}`, true},
+		{`{"min_seeding_time": "49h"}`, false},
+		{`{"max_seeding_time": "1d"}`, false},
+		{`{"min_age": "3d"}`, true},
+		{`{"min_age": "1w"}`, false},
+		{`{"max_age": "1d"}`, false},
+		{`{"min_size": 1000}`, true},
+		{`{"min_size": 1001}`, false},
+		{`{"max_size": 999}`, false},
+		{`{"min_inactive": "1d"}`, true},
+		{`{"min_inactive": "2d"}`, false},
+		{`{"max_progress": 0.25}`, true},
+		{`{"max_progress": 0}`, false},
+		{`{"max_availability": 0.5}`, true},
+		{`{"max_availability": 0}`, false},
+		{`{"goal": {"ratio": 1.5}}`, true},
+		{`{"goal": {"ratio": 2}}`, false},
+		{`{"goal": {"seeding_time": "2d"}}`, true},
+		{`{"goal": {"ratio": 2, "seeding_time": "2d"}}`, true},
+		{`{"goal": {"ratio": 1, "seeding_time": "1w"}}`, true},
+		{`{"goal": {"ratio": 2, "seeding_time": "1w"}}`, false},
+		{`{"name": "(?i)s01e\\d+"}`, true},
+		{`{"name": "1080p"}`, false},
+		{`{"category": ["tv"], "min_ratio": 1, "name": "720p"}`, true},
+		{`{"category": ["tv"], "min_ratio": 3}`, false},
+	}
+
+	for _, tt := range tests {
+		rules, err := Parse([]byte(`[{"name": "r", "match": ` + tt.match + `, "action": "notify"}]`))
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", tt.match, err)
+		}
+		ok, reason := rules[0].Check(torrent, now)
+		if ok != tt.want {
+			t.Errorf("Expected %s to match %v, got %v (%s)", tt.match, tt.want, ok, reason)
+		}
+		if !ok && reason == "" {
+			t.Errorf("Expected a reason why %s doesn't match", tt.match)
+		}
+	}
+
+	// Paused torrents have an unknown availability, which must not look like a dead torrent
+	rules, _ := Parse([]byte(`[{"name": "r", "match": {"max_availability": 0}, "action": "delete"}]`))
+	paused := torrent
+	paused.Availability = -1
+	if ok, reason := rules[0].Check(paused, now); ok || reason != "availability is unknown" {
+		t.Errorf("Expected an unknown availability not to match, got %v (%s)", ok, reason)
+	}
+}
+
+// TestCheckStates tests that rules written with qBittorrent 4 states match torrents of either version
+func TestCheckStates(t *testing.T) {
+	rules, err := Parse([]byte(`[{"name": "paused", "match": {"state": ["pausedUP"]}, "action": "notify"}]`))
+	if err != nil {
+		t.Fatalf("Failed to parse rules: %v", err)
+	}
+	for _, state := range []qbittorrent.TorrentState{qbittorrent.StatePausedUP, qbittorrent.StateStoppedUP} {
+		if ok, reason := rules[0].Check(qbittorrent.Torrent{State: state}, time.Now()); !ok {
+			t.Errorf("Expected a torrent in state %s to match, got %s", state, reason)
+		}
+	}
+}
+
+// TestDefault tests that the default rule removes complete torrents with missing files
+func TestDefault(t *testing.T) {
+	rule := Default()[0]
+	if rule.Name != MissingFiles || !rule.Deletes() || !rule.ChecksFiles() {
+		t.Errorf("Unexpected default rule: %+v", rule)
+	}
+
+	for state, want := range map[qbittorrent.TorrentState]bool{"downloading": false, "moving": true, "error": true, "missingFiles": true} {
+		if ok, _ := rule.Check(qbittorrent.Torrent{AmountLeft: 1, State: state}, time.Now()); ok != want {
+			t.Errorf("Expected incomplete torrent in state %s to match %v, got %v", state, want, ok)
+		}
+	}
+}
+
+// TestParseDuration tests durations with day and week units
+func TestParseDuration(t *testing.T) {
+	tests := map[string]time.Duration{
+		"90m":    90 * time.Minute,
+		"14d":    14 * 24 * time.Hour,
+		"1w12h":  7*24*time.Hour + 12*time.Hour,
+		"1.5d":   36 * time.Hour,
+		"2d30m":  48*time.Hour + 30*time.Minute,
+		"0":      0,
+		"1w":     7 * 24 * time.Hour,
+		"3h2d1m": 51*time.Hour + time.Minute,
+	}
+	for s, want := range tests {
+		got, err := ParseDuration(s)
+		if err != nil || got != want {
+			t.Errorf("Expected %s to be %s, got %s, %v", s, want, got, err)
+		}
+	}
+
+	for _, s := range []string{"", "d", "soon", "5x"} {
+		if _, err := ParseDuration(s); err == nil {
+			t.Errorf("Expected %q to be invalid", s)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mallox/qbittorrent-cleaner/cleaner"
+	"github.com/mallox/qbittorrent-cleaner/journal"
+	"github.com/mallox/qbittorrent-cleaner/pending"
+)
+
+// maxRequestBody limits the size of API request bodies
+const maxRequestBody = 1 << 20
+
+// apiError is the body returned for failed API requests
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// runRequest is the body accepted by POST /runs
+type runRequest struct {
+	DryRun bool     `json:"dry_run"`
+	Hashes []string `json:"hashes"`
+}
+
+// exclusionRequest is the body accepted by POST /exclusions
+type exclusionRequest struct {
+	Hash    string `json:"hash"`
+	Name    string `json:"name"`
+	Comment string `json:"comment"`
+	// Skip excludes the torrent only until the next scheduled pass has run
+	Skip bool `json:"skip"`
+}
+
+// defaultJournalLimit is the number of journal entries returned unless a limit is given
+const defaultJournalLimit = 100
+
+// missingResponse is the body returned by GET /torrents/missing
+type missingResponse struct {
+	RunID    string            `json:"run_id"`
+	Aborted  bool              `json:"aborted"`
+	Reason   string            `json:"abort_reason,omitempty"`
+	Torrents []cleaner.Removal `json:"torrents"`
+}
+
+// authorize wraps a handler so it requires the API token as a bearer token
+func (s *Server) authorize(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="qbittorrent-cleaner"`)
+			writeJSON(w, http.StatusUnauthorized, apiError{"missing or invalid API token"})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// decodeBody decodes a JSON request body, rejecting unknown fields
+func decodeBody(w http.ResponseWriter, r *http.Request, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// serveStartRun queues a pass and returns its ID
+func (s *Server) serveStartRun(w http.ResponseWriter, r *http.Request) {
+	var req runRequest
+	if r.ContentLength != 0 {
+		if err := decodeBody(w, r, &req); err != nil {
+			writeJSON(w, http.StatusBadRequest, apiError{"invalid request body: " + err.Error()})
+			return
+		}
+	}
+
+	run := s.Runs.Start(TriggerAPI, cleaner.Options{DryRun: req.DryRun, Hashes: req.Hashes})
+	w.Header().Set("Location", "/runs/"+run.ID)
+	writeJSON(w, http.StatusAccepted, run)
+}
+
+// serveListRuns returns the recent runs, newest first
+func (s *Server) serveListRuns(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.Runs.List())
+}
+
+// serveGetRun returns a single run and its summary once finished
+func (s *Server) serveGetRun(w http.ResponseWriter, r *http.Request) {
+	run, ok := s.Runs.Get(r.PathValue("id"))
+	if !ok {
+		writeJSON(w, http.StatusNotFound, apiError{"run not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, run)
+}
+
+// serveMissing performs a dry run and returns the torrents that are currently missing files.
+// Candidates of rules that don't look at the files are left out.
+func (s *Server) serveMissing(w http.ResponseWriter, r *http.Request) {
+	run := s.Runs.Execute(r.Context(), TriggerAPI, cleaner.Options{DryRun: true})
+	if run.Status == StatusFailed {
+		writeJSON(w, http.StatusBadGateway, apiError{run.Error})
+		return
+	}
+
+	torrents := []cleaner.Removal{}
+	for _, cand := range run.Summary.Candidates {
+		if cand.Missing {
+			torrents = append(torrents, cand)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, missingResponse{
+		RunID:    run.ID,
+		Aborted:  run.Summary.Aborted,
+		Reason:   run.Summary.AbortReason,
+		Torrents: torrents,
+	})
+}
+
+// serveConfig returns the effective configuration
+func (s *Server) serveConfig(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.Config)
+}
+
+// serveJournal returns the latest journal entries, newest first
+func (s *Server) serveJournal(w http.ResponseWriter, r *http.Request) {
+	limit := defaultJournalLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			writeJSON(w, http.StatusBadRequest, apiError{"limit must be a positive integer"})
+			return
+		}
+		limit = n
+	}
+
+	entries, err := journal.Read(s.JournalPath, journal.Filter{Hash: r.URL.Query().Get("hash")})
+	if errors.Is(err, os.ErrNotExist) {
+		entries, err = []journal.Entry{}, nil
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, apiError{err.Error()})
+		return
+	}
+
+	if len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	slices.Reverse(entries)
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// serveOrphans returns the files in the download directories that no torrent references
+func (s *Server) serveOrphans(w http.ResponseWriter, r *http.Request) {
+	orphans, err := s.Orphans(r.Context())
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, apiError{err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, orphans)
+}
+
+// serveListExclusions returns the torrents that are currently excluded
+func (s *Server) serveListExclusions(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.Exclusions.List())
+}
+
+// serveAddExclusion excludes a torrent permanently, or until the next pass when skipped
+func (s *Server) serveAddExclusion(w http.ResponseWriter, r *http.Request) {
+	var req exclusionRequest
+	if err := decodeBody(w, r, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{"invalid request body: " + err.Error()})
+		return
+	}
+	if req.Hash == "" {
+		writeJSON(w, http.StatusBadRequest, apiError{"hash is required"})
+		return
+	}
+
+	ex := cleaner.Exclusion{Hash: req.Hash, Name: req.Name, Comment: req.Comment}
+	if req.Skip {
+		ex.Until = time.Now().Add(s.SkipFor)
+	}
+	if err := s.Exclusions.Add(ex); err != nil {
+		writeJSON(w, http.StatusInternalServerError, apiError{err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusCreated, ex)
+}
+
+// serveRemoveExclusion makes an excluded torrent eligible for removal again
+func (s *Server) serveRemoveExclusion(w http.ResponseWriter, r *http.Request) {
+	removed, err := s.Exclusions.Remove(r.PathValue("hash"))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, apiError{err.Error()})
+		return
+	}
+	if !removed {
+		writeJSON(w, http.StatusNotFound, apiError{"exclusion not found"})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serveListPending returns the staged removals
+func (s *Server) serveListPending(w http.ResponseWriter, r *http.Request) {
+	items, err := s.Pending.List()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, apiError{err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// serveDecidePending approves or rejects a staged removal and returns the updated item
+func (s *Server) serveDecidePending(decide func(hashes ...string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hash := r.PathValue("hash")
+		err := decide(hash)
+		if errors.Is(err, pending.ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, apiError{err.Error()})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, apiError{err.Error()})
+			return
+		}
+
+		item, err := s.Pending.Get(hash)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, apiError{err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, item)
+	}
+}
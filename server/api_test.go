@@ -0,0 +1,252 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mallox/qbittorrent-cleaner/cleaner"
+	"github.com/mallox/qbittorrent-cleaner/journal"
+	"github.com/mallox/qbittorrent-cleaner/pending"
+)
+
+// request sends an API request with the given token and returns the recorded response
+func request(handler http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// TestAPIAuth tests that the API requires a token and is disabled without one
+func TestAPIAuth(t *testing.T) {
+	runs := NewRuns(context.Background(), nil, 10)
+
+	handler := (&Server{Runs: runs}).Handler()
+	if rec := request(handler, "GET", "/config", "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected API to be disabled without a token, got %d", rec.Code)
+	}
+
+	handler = (&Server{Runs: runs, Token: "secret", Config: map[string]string{"A": "b"}}).Handler()
+	if rec := request(handler, "GET", "/config", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a token, got %d", rec.Code)
+	}
+	if rec := request(handler, "GET", "/config", "wrong", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 with a wrong token, got %d", rec.Code)
+	}
+	rec := request(handler, "GET", "/config", "secret", "")
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != `{"A":"b"}` {
+		t.Errorf("Expected config with a valid token, got %d '%s'", rec.Code, rec.Body.String())
+	}
+}
+
+// TestAPIRuns tests triggering a run and fetching its result
+func TestAPIRuns(t *testing.T) {
+	got := make(chan cleaner.Options, 1)
+	runs := NewRuns(context.Background(), func(ctx context.Context, opts cleaner.Options) (*cleaner.Summary, error) {
+		got <- opts
+		return &cleaner.Summary{RunID: opts.RunID, DryRun: opts.DryRun}, nil
+	}, 10)
+	handler := (&Server{Runs: runs, Token: "secret"}).Handler()
+
+	rec := request(handler, "POST", "/runs", "secret", `{"dry_run": true, "hashes": ["abc"]}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d '%s'", rec.Code, rec.Body.String())
+	}
+	var run Run
+	if err := json.Unmarshal(rec.Body.Bytes(), &run); err != nil {
+		t.Fatalf("Failed to decode run: %v", err)
+	}
+	if rec.Header().Get("Location") != "/runs/"+run.ID {
+		t.Errorf("Expected Location header for run %s, got %s", run.ID, rec.Header().Get("Location"))
+	}
+
+	opts := <-got
+	if !opts.DryRun || len(opts.Hashes) != 1 || opts.Hashes[0] != "abc" || opts.RunID != run.ID {
+		t.Errorf("Expected dry run scoped to abc, got %+v", opts)
+	}
+
+	if rec := request(handler, "GET", "/runs/"+run.ID, "secret", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected run to be found, got %d", rec.Code)
+	}
+	if rec := request(handler, "GET", "/runs/unknown", "secret", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown run, got %d", rec.Code)
+	}
+	if rec := request(handler, "POST", "/runs", "secret", `{"dry_run": "yes"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid body, got %d", rec.Code)
+	}
+}
+
+// TestAPIMissing tests listing the torrents that are currently missing files
+func TestAPIMissing(t *testing.T) {
+	var err error
+	runs := NewRuns(context.Background(), func(ctx context.Context, opts cleaner.Options) (*cleaner.Summary, error) {
+		if !opts.DryRun {
+			t.Errorf("Expected missing torrents to be found with a dry run")
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &cleaner.Summary{
+			RunID: opts.RunID,
+			Candidates: []cleaner.Removal{
+				{Hash: "abc", Name: "Broken", MissingFiles: []string{"a.bin"}, Missing: true},
+				{Hash: "def", Name: "Seeded", MissingFiles: []string{}, Rule: "seeded"},
+			},
+		}, nil
+	}, 10)
+	handler := (&Server{Runs: runs, Token: "secret"}).Handler()
+
+	rec := request(handler, "GET", "/torrents/missing", "secret", "")
+	var body missingResponse
+	if e := json.Unmarshal(rec.Body.Bytes(), &body); e != nil {
+		t.Fatalf("Failed to decode response '%s': %v", rec.Body.String(), e)
+	}
+	if rec.Code != http.StatusOK || len(body.Torrents) != 1 || body.Torrents[0].Hash != "abc" {
+		t.Errorf("Expected torrent abc to be missing, got %d %+v", rec.Code, body)
+	}
+
+	err = errors.New("listing torrents failed")
+	if rec := request(handler, "GET", "/torrents/missing", "secret", ""); rec.Code != http.StatusBadGateway {
+		t.Errorf("Expected 502 when the pass fails, got %d", rec.Code)
+	}
+}
+
+// TestAPIJournal tests that the latest journal entries are returned newest first
+func TestAPIJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	handler := (&Server{Runs: NewRuns(context.Background(), nil, 10), Token: "secret", JournalPath: path}).Handler()
+
+	// A journal that hasn't been written yet is empty
+	if rec := request(handler, "GET", "/journal", "secret", ""); rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != "[]" {
+		t.Errorf("Expected empty journal, got %d '%s'", rec.Code, rec.Body.String())
+	}
+
+	j, err := journal.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open journal: %v", err)
+	}
+	for _, hash := range []string{"aaa", "bbb", "ccc"} {
+		j.Append(journal.Entry{Hash: hash})
+	}
+	j.Close()
+
+	rec := request(handler, "GET", "/journal?limit=2", "secret", "")
+	var entries []journal.Entry
+	json.Unmarshal(rec.Body.Bytes(), &entries)
+	if len(entries) != 2 || entries[0].Hash != "ccc" || entries[1].Hash != "bbb" {
+		t.Errorf("Expected the 2 latest entries, newest first, got %+v", entries)
+	}
+	if rec := request(handler, "GET", "/journal?limit=x", "secret", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid limit, got %d", rec.Code)
+	}
+}
+
+// TestAPIOrphans tests listing orphaned files
+func TestAPIOrphans(t *testing.T) {
+	var err error
+	s := &Server{Runs: NewRuns(context.Background(), nil, 10), Token: "secret"}
+	s.Orphans = func(ctx context.Context) ([]cleaner.Orphan, error) {
+		return []cleaner.Orphan{{Path: "/downloads/leftover.iso", Size: 7}}, err
+	}
+	handler := s.Handler()
+
+	rec := request(handler, "GET", "/orphans", "secret", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "leftover.iso") {
+		t.Errorf("Expected orphan to be listed, got %d '%s'", rec.Code, rec.Body.String())
+	}
+
+	err = errors.New("listing torrents failed")
+	if rec := request(handler, "GET", "/orphans", "secret", ""); rec.Code != http.StatusBadGateway {
+		t.Errorf("Expected 502 when orphans can't be listed, got %d", rec.Code)
+	}
+}
+
+// TestAPIExclusions tests skipping, excluding and restoring torrents
+func TestAPIExclusions(t *testing.T) {
+	exclusions, _ := cleaner.LoadExclusions("")
+	handler := (&Server{Runs: NewRuns(context.Background(), nil, 10), Token: "secret", Exclusions: exclusions, SkipFor: time.Hour}).Handler()
+
+	if rec := request(handler, "POST", "/exclusions", "secret", `{"hash": "aaa", "name": "Keep"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d '%s'", rec.Code, rec.Body.String())
+	}
+	rec := request(handler, "POST", "/exclusions", "secret", `{"hash": "bbb", "skip": true}`)
+	var skipped cleaner.Exclusion
+	json.Unmarshal(rec.Body.Bytes(), &skipped)
+	if rec.Code != http.StatusCreated || skipped.Until.IsZero() {
+		t.Errorf("Expected skip to expire, got %d %+v", rec.Code, skipped)
+	}
+	if rec := request(handler, "POST", "/exclusions", "secret", `{}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without a hash, got %d", rec.Code)
+	}
+
+	if !exclusions.Excluded("aaa") || !exclusions.Excluded("bbb") {
+		t.Errorf("Expected aaa and bbb to be excluded")
+	}
+
+	if rec := request(handler, "DELETE", "/exclusions/aaa", "secret", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", rec.Code)
+	}
+	if rec := request(handler, "DELETE", "/exclusions/aaa", "secret", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a removed exclusion, got %d", rec.Code)
+	}
+
+	rec = request(handler, "GET", "/exclusions", "secret", "")
+	var list []cleaner.Exclusion
+	json.Unmarshal(rec.Body.Bytes(), &list)
+	if len(list) != 1 || list[0].Hash != "bbb" {
+		t.Errorf("Expected only bbb to remain excluded, got %+v", list)
+	}
+}
+
+// TestDashboard tests that the dashboard is served without assets from elsewhere
+func TestDashboard(t *testing.T) {
+	handler := (&Server{Runs: NewRuns(context.Background(), nil, 10), Token: "secret"}).Handler()
+
+	rec := request(handler, "GET", "/", "", "")
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("Expected dashboard page, got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if strings.Contains(rec.Body.String(), "http://") || strings.Contains(rec.Body.String(), "https://") {
+		t.Errorf("Expected dashboard not to load external assets")
+	}
+	if rec := request(handler, "GET", "/unknown", "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown paths, got %d", rec.Code)
+	}
+}
+
+// TestAPIPending tests listing, approving and rejecting staged removals
+func TestAPIPending(t *testing.T) {
+	queue := pending.Open(filepath.Join(t.TempDir(), "pending.json"))
+	queue.Stage([]pending.Item{{Hash: "aaa"}, {Hash: "bbb"}}, false)
+	handler := (&Server{Runs: NewRuns(context.Background(), nil, 10), Token: "secret", Pending: queue}).Handler()
+
+	rec := request(handler, "POST", "/pending/aaa/approve", "secret", "")
+	var item pending.Item
+	json.Unmarshal(rec.Body.Bytes(), &item)
+	if rec.Code != http.StatusOK || item.Status != pending.StatusApproved {
+		t.Errorf("Expected aaa to be approved, got %d %+v", rec.Code, item)
+	}
+	if rec := request(handler, "POST", "/pending/bbb/reject", "secret", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected bbb to be rejected, got %d", rec.Code)
+	}
+	if rec := request(handler, "POST", "/pending/ccc/approve", "secret", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a torrent that isn't staged, got %d", rec.Code)
+	}
+
+	rec = request(handler, "GET", "/pending", "secret", "")
+	var items []pending.Item
+	json.Unmarshal(rec.Body.Bytes(), &items)
+	if len(items) != 2 || items[0].Status != pending.StatusApproved || items[1].Status != pending.StatusRejected {
+		t.Errorf("Expected approved and rejected items, got %+v", items)
+	}
+}
@@ -0,0 +1,21 @@
+package server
+
+import (
+	"embed"
+	"net/http"
+)
+
+// dashboardFiles holds the web UI, which has no external assets
+//
+//go:embed dashboard/index.html
+var dashboardFiles embed.FS
+
+// dashboard serves the web UI. The page itself holds no data and asks for the API token,
+// which it sends with every API request.
+var dashboard = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	page, _ := dashboardFiles.ReadFile("dashboard/index.html")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Write(page)
+})
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Health tracks the daemon state used by the liveness and readiness probes
+type Health struct {
+	// Interval is the time between passes
+	Interval time.Duration
+	// MaxIntervals is how many intervals may pass without a completed pass before the daemon is not ready
+	MaxIntervals int
+	// CheckDirs verifies that the download directories are reachable
+	CheckDirs func() error
+
+	mu       sync.Mutex
+	started  time.Time
+	loginErr error
+	loggedIn bool
+	lastPass time.Time
+	now      func() time.Time
+}
+
+// NewHealth creates the health state for a daemon that runs a pass every interval
+func NewHealth(interval time.Duration, maxIntervals int, checkDirs func() error) *Health {
+	return &Health{
+		Interval:     interval,
+		MaxIntervals: maxIntervals,
+		CheckDirs:    checkDirs,
+		started:      time.Now(),
+		now:          time.Now,
+	}
+}
+
+// RecordLogin records the outcome of the latest login attempt. A nil Health ignores it.
+func (h *Health) RecordLogin(err error) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.loginErr = err
+	h.loggedIn = err == nil
+}
+
+// RecordPass records the completion time of a pass. A nil Health ignores it.
+func (h *Health) RecordPass(finished time.Time) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastPass = finished
+}
+
+// check is the result of a single readiness check
+type check struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// checks runs every readiness check
+func (h *Health) checks() map[string]check {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	result := map[string]check{}
+
+	switch {
+	case h.loggedIn:
+		result["login"] = check{OK: true}
+	case h.loginErr != nil:
+		result["login"] = check{Error: h.loginErr.Error()}
+	default:
+		result["login"] = check{Error: "no login attempted yet"}
+	}
+
+	if h.CheckDirs != nil {
+		if err := h.CheckDirs(); err != nil {
+			result["download_dirs"] = check{Error: err.Error()}
+		} else {
+			result["download_dirs"] = check{OK: true}
+		}
+	}
+
+	// Measure from startup until the first pass completes, so a slow first pass is tolerated
+	last := h.lastPass
+	if last.IsZero() {
+		last = h.started
+	}
+	maxAge := h.Interval * time.Duration(max(h.MaxIntervals, 1))
+	if age := h.now().Sub(last); h.Interval > 0 && age > maxAge {
+		result["last_pass"] = check{Error: fmt.Sprintf("last pass completed %s ago, more than %s", age.Round(time.Second), maxAge)}
+	} else {
+		result["last_pass"] = check{OK: true}
+	}
+
+	return result
+}
+
+// Ready reports whether every readiness check passes
+func (h *Health) Ready() bool {
+	for _, c := range h.checks() {
+		if !c.OK {
+			return false
+		}
+	}
+	return true
+}
+
+// ServeLive answers the liveness probe, which only requires the process to respond
+func (h *Health) ServeLive(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// ServeReady answers the readiness probe with the result of each check
+func (h *Health) ServeReady(w http.ResponseWriter, _ *http.Request) {
+	checks := h.checks()
+
+	status, code := "ok", http.StatusOK
+	for _, c := range checks {
+		if !c.OK {
+			status, code = "unavailable", http.StatusServiceUnavailable
+		}
+	}
+
+	writeJSON(w, code, map[string]any{"status": status, "checks": checks})
+}
+
+// writeJSON writes v as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// probe requests a health endpoint and decodes its JSON response
+func probe(t *testing.T, handler http.Handler, path string) (int, map[string]any) {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode %s response '%s': %v", path, rec.Body.String(), err)
+	}
+	return rec.Code, body
+}
+
+// TestHealthz tests that the liveness probe always succeeds
+func TestHealthz(t *testing.T) {
+	s := &Server{Health: NewHealth(time.Hour, 3, nil)}
+
+	code, body := probe(t, s.Handler(), "/healthz")
+	if code != http.StatusOK || body["status"] != "ok" {
+		t.Errorf("Expected healthy response, got %d %v", code, body)
+	}
+}
+
+// TestReadyz tests each readiness check
+func TestReadyz(t *testing.T) {
+	var dirErr error
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	h := NewHealth(time.Hour, 3, func() error { return dirErr })
+	h.started = now
+	h.now = func() time.Time { return now }
+	handler := (&Server{Health: h}).Handler()
+
+	// Not ready before the first login
+	code, body := probe(t, handler, "/readyz")
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("Expected not ready before login, got %d %v", code, body)
+	}
+
+	h.RecordLogin(nil)
+	if code, body = probe(t, handler, "/readyz"); code != http.StatusOK {
+		t.Errorf("Expected ready after login, got %d %v", code, body)
+	}
+
+	// A failed login makes the daemon unready again
+	h.RecordLogin(errors.New("login failed with status: 403 Forbidden"))
+	code, body = probe(t, handler, "/readyz")
+	login := body["checks"].(map[string]any)["login"].(map[string]any)
+	if code != http.StatusServiceUnavailable || login["error"] != "login failed with status: 403 Forbidden" {
+		t.Errorf("Expected login failure, got %d %v", code, body)
+	}
+	h.RecordLogin(nil)
+
+	dirErr = errors.New("download directory /downloads is not accessible")
+	if code, _ = probe(t, handler, "/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected not ready with unreachable download dirs, got %d", code)
+	}
+	dirErr = nil
+
+	// The first pass may take up to MaxIntervals from startup
+	now = now.Add(3 * time.Hour)
+	if !h.Ready() {
+		t.Error("Expected ready within 3 intervals of startup")
+	}
+	now = now.Add(time.Minute)
+	if h.Ready() {
+		t.Error("Expected not ready once 3 intervals passed without a pass")
+	}
+
+	h.RecordPass(now)
+	if !h.Ready() {
+		t.Error("Expected ready right after a pass")
+	}
+}
+
+// TestNilHealth tests that recording on a nil Health is a no-op
+func TestNilHealth(t *testing.T) {
+	var h *Health
+	h.RecordLogin(nil)
+	h.RecordPass(time.Now())
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/mallox/qbittorrent-cleaner/cleaner"
+	"github.com/mallox/qbittorrent-cleaner/journal"
+)
+
+// Run states
+const (
+	StatusQueued   = "queued"
+	StatusRunning  = "running"
+	StatusFinished = "finished"
+	StatusFailed   = "failed"
+)
+
+// Triggers that start a run
+const (
+	TriggerSchedule = "schedule"
+	TriggerAPI      = "api"
+)
+
+// RunFunc performs a single pass
+type RunFunc func(ctx context.Context, opts cleaner.Options) (*cleaner.Summary, error)
+
+// Run is a pass started by the scheduler or through the API
+type Run struct {
+	ID       string           `json:"id"`
+	Trigger  string           `json:"trigger"`
+	Options  cleaner.Options  `json:"options"`
+	Status   string           `json:"status"`
+	Queued   time.Time        `json:"queued"`
+	Started  time.Time        `json:"started,omitzero"`
+	Finished time.Time        `json:"finished,omitzero"`
+	Error    string           `json:"error,omitempty"`
+	Summary  *cleaner.Summary `json:"summary,omitempty"`
+}
+
+// Runs executes passes one at a time and keeps a bounded history of their results
+type Runs struct {
+	ctx  context.Context
+	fn   RunFunc
+	keep int
+
+	exec    sync.Mutex // Serializes passes
+	mu      sync.Mutex // Guards history
+	history []*Run
+}
+
+// NewRuns creates a run history keeping the latest keep runs. Runs started
+// asynchronously use ctx, so they are cancelled when it is done.
+func NewRuns(ctx context.Context, fn RunFunc, keep int) *Runs {
+	return &Runs{ctx: ctx, fn: fn, keep: keep}
+}
+
+// Execute performs a pass and waits for it to finish
+func (r *Runs) Execute(ctx context.Context, trigger string, opts cleaner.Options) Run {
+	run := r.queue(trigger, opts)
+	r.execute(ctx, run)
+	return r.snapshot(run)
+}
+
+// Start queues a pass in the background and returns immediately
+func (r *Runs) Start(trigger string, opts cleaner.Options) Run {
+	run := r.queue(trigger, opts)
+	go r.execute(r.ctx, run)
+	return r.snapshot(run)
+}
+
+// Exclusive calls fn while no pass is in progress, for work that shares the pass's client
+func (r *Runs) Exclusive(fn func() error) error {
+	r.exec.Lock()
+	defer r.exec.Unlock()
+	return fn()
+}
+
+// Get returns the run with the given ID
+func (r *Runs) Get(id string) (Run, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, run := range r.history {
+		if run.ID == id {
+			return *run, true
+		}
+	}
+	return Run{}, false
+}
+
+// List returns the runs in the history, newest first
+func (r *Runs) List() []Run {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	runs := make([]Run, 0, len(r.history))
+	for i := len(r.history) - 1; i >= 0; i-- {
+		runs = append(runs, *r.history[i])
+	}
+	return runs
+}
+
+// queue adds a new run to the history, dropping the oldest finished runs beyond the limit.
+// Runs that are queued or running are kept even beyond it, so their status can be polled.
+func (r *Runs) queue(trigger string, opts cleaner.Options) *Run {
+	if opts.RunID == "" {
+		opts.RunID = journal.NewRunID()
+	}
+
+	run := &Run{
+		ID:      opts.RunID,
+		Trigger: trigger,
+		Options: opts,
+		Status:  StatusQueued,
+		Queued:  time.Now(),
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.history = append(r.history, run)
+	if r.keep > 0 {
+		drop := len(r.history) - r.keep
+		r.history = slices.DeleteFunc(r.history, func(run *Run) bool {
+			if drop > 0 && (run.Status == StatusFinished || run.Status == StatusFailed) {
+				drop--
+				return true
+			}
+			return false
+		})
+	}
+	return run
+}
+
+// execute performs a queued run once no other pass is in progress
+func (r *Runs) execute(ctx context.Context, run *Run) {
+	r.exec.Lock()
+	defer r.exec.Unlock()
+
+	r.update(func() {
+		run.Status = StatusRunning
+		run.Started = time.Now()
+	})
+
+	summary, err := r.fn(ctx, run.Options)
+
+	r.update(func() {
+		run.Finished = time.Now()
+		run.Summary = summary
+		if err != nil {
+			run.Status = StatusFailed
+			run.Error = err.Error()
+		} else {
+			run.Status = StatusFinished
+		}
+	})
+}
+
+// update modifies a run while holding the history lock
+func (r *Runs) update(fn func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fn()
+}
+
+// snapshot returns a copy of a run that is safe to read without the lock
+func (r *Runs) snapshot(run *Run) Run {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return *run
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mallox/qbittorrent-cleaner/cleaner"
+)
+
+// TestRunsExecute tests synchronous runs and their history
+func TestRunsExecute(t *testing.T) {
+	fail := false
+	runs := NewRuns(context.Background(), func(ctx context.Context, opts cleaner.Options) (*cleaner.Summary, error) {
+		if fail {
+			return nil, errors.New("login failed")
+		}
+		return &cleaner.Summary{RunID: opts.RunID, DryRun: opts.DryRun}, nil
+	}, 2)
+
+	run := runs.Execute(context.Background(), TriggerSchedule, cleaner.Options{DryRun: true})
+	if run.Status != StatusFinished || run.ID == "" || run.Summary == nil || run.Summary.RunID != run.ID {
+		t.Errorf("Expected finished run with a summary for its ID, got %+v", run)
+	}
+	if run.Started.IsZero() || run.Finished.IsZero() {
+		t.Errorf("Expected start and finish times, got %+v", run)
+	}
+
+	fail = true
+	failed := runs.Execute(context.Background(), TriggerAPI, cleaner.Options{RunID: "second"})
+	if failed.Status != StatusFailed || failed.Error != "login failed" {
+		t.Errorf("Expected failed run, got %+v", failed)
+	}
+
+	runs.Execute(context.Background(), TriggerAPI, cleaner.Options{RunID: "third"})
+	list := runs.List()
+	if len(list) != 2 || list[0].ID != "third" || list[1].ID != "second" {
+		t.Errorf("Expected the 2 newest runs, newest first, got %+v", list)
+	}
+	if _, ok := runs.Get(run.ID); ok {
+		t.Errorf("Expected oldest run to be dropped from history")
+	}
+	if got, ok := runs.Get("second"); !ok || got.Trigger != TriggerAPI {
+		t.Errorf("Expected to find run 'second', got %+v", got)
+	}
+}
+
+// TestRunsKeepUnfinished tests that queued and running runs stay in a full history
+func TestRunsKeepUnfinished(t *testing.T) {
+	release := make(chan struct{})
+	runs := NewRuns(context.Background(), func(ctx context.Context, opts cleaner.Options) (*cleaner.Summary, error) {
+		<-release
+		return &cleaner.Summary{RunID: opts.RunID}, nil
+	}, 1)
+
+	first := runs.Start(TriggerAPI, cleaner.Options{RunID: "first"})
+	second := runs.Start(TriggerAPI, cleaner.Options{RunID: "second"})
+	for _, id := range []string{first.ID, second.ID} {
+		if _, ok := runs.Get(id); !ok {
+			t.Errorf("Expected unfinished run %s to stay in the history", id)
+		}
+	}
+	close(release)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if run, _ := runs.Get("second"); run.Status == StatusFinished {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Run second did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	runs.Execute(context.Background(), TriggerAPI, cleaner.Options{RunID: "third"})
+	if list := runs.List(); len(list) != 1 || list[0].ID != "third" {
+		t.Errorf("Expected finished runs to be dropped once over the limit, got %+v", list)
+	}
+}
+
+// TestRunsStart tests that background runs are serialized
+func TestRunsStart(t *testing.T) {
+	release := make(chan struct{})
+	running := 0
+	overlapped := false
+	runs := NewRuns(context.Background(), func(ctx context.Context, opts cleaner.Options) (*cleaner.Summary, error) {
+		running++
+		if running > 1 {
+			overlapped = true
+		}
+		<-release
+		running--
+		return &cleaner.Summary{RunID: opts.RunID}, nil
+	}, 10)
+
+	first := runs.Start(TriggerAPI, cleaner.Options{})
+	second := runs.Start(TriggerAPI, cleaner.Options{})
+	if first.ID == second.ID {
+		t.Errorf("Expected distinct run IDs, got %s", first.ID)
+	}
+	close(release)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for _, id := range []string{first.ID, second.ID} {
+		for {
+			run, _ := runs.Get(id)
+			if run.Status == StatusFinished {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Run %s did not finish, status %s", id, run.Status)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if overlapped {
+		t.Errorf("Expected runs not to overlap")
+	}
+}
@@ -0,0 +1,75 @@
+// Package server provides the HTTP endpoints served by the cleaner in daemon mode
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/mallox/qbittorrent-cleaner/cleaner"
+	"github.com/mallox/qbittorrent-cleaner/pending"
+)
+
+// Server routes the daemon's HTTP endpoints
+type Server struct {
+	Metrics http.Handler
+	Health  *Health
+
+	// Token is the bearer token required by the control API. The API is disabled if empty.
+	Token string
+	// Runs executes passes requested through the API
+	Runs *Runs
+	// Config is the effective configuration returned by the API, with secrets already redacted
+	Config any
+	// JournalPath is the audit journal shown by the API. The endpoint is disabled if empty.
+	JournalPath string
+	// Orphans lists files that don't belong to any torrent. The endpoint is disabled if nil.
+	Orphans func(ctx context.Context) ([]cleaner.Orphan, error)
+	// Exclusions holds the torrents excluded through the API. The endpoints are disabled if nil.
+	Exclusions *cleaner.Exclusions
+	// Pending is the queue of staged removals. The endpoints are disabled if nil.
+	Pending *pending.Queue
+	// SkipFor is how long a skipped torrent stays excluded
+	SkipFor time.Duration
+}
+
+// Handler returns the HTTP handler serving all configured endpoints
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	if s.Metrics != nil {
+		mux.Handle("GET /metrics", s.Metrics)
+	}
+	if s.Health != nil {
+		mux.HandleFunc("GET /healthz", s.Health.ServeLive)
+		mux.HandleFunc("GET /readyz", s.Health.ServeReady)
+	}
+
+	if s.Token != "" && s.Runs != nil {
+		mux.HandleFunc("POST /runs", s.authorize(s.serveStartRun))
+		mux.HandleFunc("GET /runs", s.authorize(s.serveListRuns))
+		mux.HandleFunc("GET /runs/{id}", s.authorize(s.serveGetRun))
+		mux.HandleFunc("GET /torrents/missing", s.authorize(s.serveMissing))
+		mux.HandleFunc("GET /config", s.authorize(s.serveConfig))
+		mux.Handle("GET /{$}", dashboard)
+
+		if s.JournalPath != "" {
+			mux.HandleFunc("GET /journal", s.authorize(s.serveJournal))
+		}
+		if s.Orphans != nil {
+			mux.HandleFunc("GET /orphans", s.authorize(s.serveOrphans))
+		}
+		if s.Exclusions != nil {
+			mux.HandleFunc("GET /exclusions", s.authorize(s.serveListExclusions))
+			mux.HandleFunc("POST /exclusions", s.authorize(s.serveAddExclusion))
+			mux.HandleFunc("DELETE /exclusions/{hash}", s.authorize(s.serveRemoveExclusion))
+		}
+		if s.Pending != nil {
+			mux.HandleFunc("GET /pending", s.authorize(s.serveListPending))
+			mux.HandleFunc("POST /pending/{hash}/approve", s.authorize(s.serveDecidePending(s.Pending.Approve)))
+			mux.HandleFunc("POST /pending/{hash}/reject", s.authorize(s.serveDecidePending(s.Pending.Reject)))
+		}
+	}
+
+	return mux
+}